@@ -21,7 +21,7 @@ var (
 // GetConfig returns the global config instance, initializing it if necessary
 func GetConfig() *Config {
 	once.Do(func() {
-		validate = validator.New()
+		validate = newValidator()
 		config = loadConfig()
 	})
 	return config
@@ -30,7 +30,7 @@ func GetConfig() *Config {
 // ReloadConfig forces a reload of the configuration (useful for testing)
 func ReloadConfig() *Config {
 	if validate == nil {
-		validate = validator.New()
+		validate = newValidator()
 	}
 	config = loadConfig()
 	return config
@@ -156,6 +156,18 @@ func mergeConfigFile(v *viper.Viper, configFile string) error {
 	return v.MergeInConfig()
 }
 
+// newValidator returns a validator with the rules that span several fields
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterStructValidation(func(sl validator.StructLevel) {
+		cache := sl.Current().Interface().(CacheObjectstore)
+		if cache.WriteBack.Enabled && cache.Backend != "local" {
+			sl.ReportError(cache.WriteBack.Enabled, "WriteBack.Enabled", "Enabled", "local_backend", cache.Backend)
+		}
+	}, CacheObjectstore{})
+	return v
+}
+
 // validateConfig performs validation using go-playground/validator
 func validateConfig(cfg *Config) error {
 	if err := validate.Struct(cfg); err != nil {
@@ -31,10 +31,65 @@ type Log struct {
 }
 
 type Objectstore struct {
-	PresignedDefaultTTL int64            `yaml:"presignedDefaultTTL" mapstructure:"presignedDefaultTTL" validate:"gte=1"`
-	Local               LocalObjectstore `yaml:"local" mapstructure:"local"`
-	Storj               StorjObjectstore `yaml:"storj" mapstructure:"storj"`
-	Cache               CacheObjectstore `yaml:"cache" mapstructure:"cache"`
+	PresignedDefaultTTL int64             `yaml:"presignedDefaultTTL" mapstructure:"presignedDefaultTTL" validate:"gte=1"`
+	PresignedSecret     string            `yaml:"presignedSecret" mapstructure:"presignedSecret" validate:"required"`
+	DownloadBaseURL     string            `yaml:"downloadBaseUrl" mapstructure:"downloadBaseUrl" validate:"required,url"`
+	Redirect            string            `yaml:"redirect" mapstructure:"redirect" validate:"required,oneof=never always uncached"`
+	Primary             string            `yaml:"primary" mapstructure:"primary" validate:"required,oneof=storj s3 memory"`
+	Resilience          Resilience        `yaml:"resilience" mapstructure:"resilience" validate:"required"`
+	Replication         Replication       `yaml:"replication" mapstructure:"replication"`
+	Multipart           Multipart         `yaml:"multipart" mapstructure:"multipart"`
+	GC                  GC                `yaml:"gc" mapstructure:"gc"`
+	Local               LocalObjectstore  `yaml:"local" mapstructure:"local"`
+	Storj               StorjObjectstore  `yaml:"storj" mapstructure:"storj"`
+	S3                  S3Objectstore     `yaml:"s3" mapstructure:"s3"`
+	Memory              MemoryObjectstore `yaml:"memory" mapstructure:"memory"`
+	Chunking            Chunking          `yaml:"chunking" mapstructure:"chunking" validate:"required"`
+	Compression         Compression       `yaml:"compression" mapstructure:"compression"`
+	Encryption          Encryption        `yaml:"encryption" mapstructure:"encryption"`
+	Cache               CacheObjectstore  `yaml:"cache" mapstructure:"cache"`
+}
+
+type Resilience struct {
+	MaxRetries       int   `yaml:"maxRetries" mapstructure:"maxRetries" validate:"gte=0"`
+	BaseDelay        int64 `yaml:"baseDelay" mapstructure:"baseDelay" validate:"required,gte=1"`
+	MaxDelay         int64 `yaml:"maxDelay" mapstructure:"maxDelay" validate:"required,gtefield=BaseDelay"`
+	Timeout          int64 `yaml:"timeout" mapstructure:"timeout" validate:"gte=0"`
+	UploadTimeout    int64 `yaml:"uploadTimeout" mapstructure:"uploadTimeout" validate:"gte=0"`
+	FailureThreshold int   `yaml:"failureThreshold" mapstructure:"failureThreshold" validate:"required,gte=1"`
+	Cooldown         int64 `yaml:"cooldown" mapstructure:"cooldown" validate:"required,gte=1"`
+}
+
+// Replication adds replicas next to the primary, which counts as the replica named primary.
+type Replication struct {
+	WriteQuorum    int       `yaml:"writeQuorum" mapstructure:"writeQuorum" validate:"gte=0"`
+	RepairInterval int64     `yaml:"repairInterval" mapstructure:"repairInterval" validate:"gte=0"`
+	Replicas       []Replica `yaml:"replicas" mapstructure:"replicas" validate:"dive"`
+}
+
+// Multipart sets when abandoned multipart sessions are cleaned up, and how
+// versions stored whole are split into parts uploaded in parallel. PartSize is
+// in MB, at least 5 as S3 refuses smaller parts.
+type Multipart struct {
+	Expiry          int64 `yaml:"expiry" mapstructure:"expiry" validate:"required,gte=1"`
+	JanitorInterval int64 `yaml:"janitorInterval" mapstructure:"janitorInterval" validate:"gte=0"`
+	PartSize        int64 `yaml:"partSize" mapstructure:"partSize" validate:"omitempty,gte=5"`
+	Concurrency     int   `yaml:"concurrency" mapstructure:"concurrency" validate:"required,gte=1"`
+}
+
+// GC sets when objects no version uses anymore are deleted from the object
+// store. Grace is how long a deleted object is kept before, in seconds.
+type GC struct {
+	Interval int64 `yaml:"interval" mapstructure:"interval" validate:"gte=0"`
+	Grace    int64 `yaml:"grace" mapstructure:"grace" validate:"gte=0"`
+}
+
+type Replica struct {
+	Name    string            `yaml:"name" mapstructure:"name" validate:"required,ne=primary"`
+	Backend string            `yaml:"backend" mapstructure:"backend" validate:"required,oneof=storj s3 memory"`
+	Storj   StorjObjectstore  `yaml:"storj" mapstructure:"storj"`
+	S3      S3Objectstore     `yaml:"s3" mapstructure:"s3"`
+	Memory  MemoryObjectstore `yaml:"memory" mapstructure:"memory"`
 }
 
 type LocalObjectstore struct {
@@ -42,12 +97,76 @@ type LocalObjectstore struct {
 	BaseURL string `yaml:"baseUrl" mapstructure:"baseUrl" validate:"required,url"`
 }
 
+// StorjObjectstore fields are only checked when storj is used, see stoj.NewClient.
 type StorjObjectstore struct {
-	Bucket      string `yaml:"bucket" mapstructure:"bucket" validate:"required"`
-	AccessGrant string `yaml:"accessGrant" mapstructure:"accessGrant" validate:"required"`
-	BaseURL     string `yaml:"baseUrl" mapstructure:"baseUrl" validate:"required,url"`
+	Bucket      string `yaml:"bucket" mapstructure:"bucket"`
+	AccessGrant string `yaml:"accessGrant" mapstructure:"accessGrant"`
+	BaseURL     string `yaml:"baseUrl" mapstructure:"baseUrl" validate:"omitempty,url"`
+	AuthService string `yaml:"authService" mapstructure:"authService"`
+}
+
+// S3Objectstore fields are only checked when s3 is used, see s3.NewClient.
+type S3Objectstore struct {
+	Endpoint        string `yaml:"endpoint" mapstructure:"endpoint" validate:"omitempty,url"`
+	Region          string `yaml:"region" mapstructure:"region"`
+	Bucket          string `yaml:"bucket" mapstructure:"bucket"`
+	AccessKeyID     string `yaml:"accessKeyId" mapstructure:"accessKeyId"`
+	SecretAccessKey string `yaml:"secretAccessKey" mapstructure:"secretAccessKey"`
+	UsePathStyle    bool   `yaml:"usePathStyle" mapstructure:"usePathStyle"`
+	PartSize        int64  `yaml:"partSize" mapstructure:"partSize" validate:"gte=0"`
+}
+
+type MemoryObjectstore struct {
+	MaxObjectSize int64 `yaml:"maxObjectSize" mapstructure:"maxObjectSize" validate:"gte=0"`
+	MaxTotalSize  int64 `yaml:"maxTotalSize" mapstructure:"maxTotalSize" validate:"gte=0"`
+	Latency       int64 `yaml:"latency" mapstructure:"latency" validate:"gte=0"`
+}
+
+// Chunking sizes are in KB, see fastcdc.Options. Without chunking, pushes are
+// stored whole.
+type Chunking struct {
+	Enabled     bool  `yaml:"enabled" mapstructure:"enabled"`
+	MinSize     int64 `yaml:"minSize" mapstructure:"minSize" validate:"required,gte=1"`
+	AvgSize     int64 `yaml:"avgSize" mapstructure:"avgSize" validate:"required,gtfield=MinSize"`
+	MaxSize     int64 `yaml:"maxSize" mapstructure:"maxSize" validate:"required,gtfield=AvgSize"`
+	Concurrency int   `yaml:"concurrency" mapstructure:"concurrency" validate:"required,gte=1"`
+	Prefetch    int   `yaml:"prefetch" mapstructure:"prefetch" validate:"gte=0"`
+}
+
+type Compression struct {
+	Enabled bool `yaml:"enabled" mapstructure:"enabled"`
+	Level   int  `yaml:"level" mapstructure:"level" validate:"required_if=Enabled true,omitempty,gte=1,lte=22"`
+}
+
+type Encryption struct {
+	Enabled        bool            `yaml:"enabled" mapstructure:"enabled"`
+	Cipher         string          `yaml:"cipher" mapstructure:"cipher" validate:"required_if=Enabled true,omitempty,oneof=aes256gcm xchacha20poly1305"`
+	CurrentKey     string          `yaml:"currentKey" mapstructure:"currentKey" validate:"required_if=Enabled true"`
+	Keys           []EncryptionKey `yaml:"keys" mapstructure:"keys" validate:"dive"`
+	AllowPlaintext bool            `yaml:"allowPlaintext" mapstructure:"allowPlaintext"`
+}
+
+type EncryptionKey struct {
+	ID  string `yaml:"id" mapstructure:"id" validate:"required,max=255"`
+	Key string `yaml:"key" mapstructure:"key" validate:"required,base64"`
 }
 
 type CacheObjectstore struct {
-	MaxSize int64 `yaml:"maxSize" mapstructure:"maxSize" validate:"required,gte=1"`
+	Backend string `yaml:"backend" mapstructure:"backend" validate:"required,oneof=local memory"`
+	MaxSize int64  `yaml:"maxSize" mapstructure:"maxSize" validate:"required,gte=1"`
+	Policy  string `yaml:"policy" mapstructure:"policy" validate:"required,oneof=lru lfu arc wtinylfu gdsf"`
+	// SpoolDir is where misses are spooled while they are fetched, empty for the system temp dir
+	SpoolDir string `yaml:"spoolDir" mapstructure:"spoolDir"`
+	// TouchInterval is in seconds, 0 writes the access time of every hit at once
+	TouchInterval int64          `yaml:"touchInterval" mapstructure:"touchInterval" validate:"gte=0"`
+	WriteBack     CacheWriteBack `yaml:"writeBack" mapstructure:"writeBack"`
+}
+
+// CacheWriteBack acknowledges uploads once they are in the cache, primary gets them in the background.
+// It needs the local cache backend, the only one that survives a restart.
+type CacheWriteBack struct {
+	Enabled     bool  `yaml:"enabled" mapstructure:"enabled"`
+	Concurrency int   `yaml:"concurrency" mapstructure:"concurrency" validate:"required_if=Enabled true,omitempty,gte=1"`
+	BaseDelay   int64 `yaml:"baseDelay" mapstructure:"baseDelay" validate:"required_if=Enabled true,omitempty,gte=1"`
+	MaxDelay    int64 `yaml:"maxDelay" mapstructure:"maxDelay" validate:"required_if=Enabled true,omitempty,gtefield=BaseDelay"`
 }
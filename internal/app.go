@@ -50,7 +50,8 @@ func SetupLogger() {
 }
 
 func SetupDatabase() (*sql.DB, error) {
-	db, err := sql.Open("sqlite", "templar.db")
+	// Wait on a locked database instead of failing, pushes and deletes run write transactions
+	db, err := sql.Open("sqlite", "templar.db?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
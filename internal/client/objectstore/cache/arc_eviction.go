@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// arcList is one of the four ARC lists, front = most recently used.
+type arcList struct {
+	order *list.List
+	size  int64
+}
+
+// arcEntry is an item in an arcList. Entries of the ghost lists are no longer cached.
+type arcEntry struct {
+	key  string
+	size int64
+	in   *arcList
+}
+
+// ARCEvictionPolicy implements the Adaptive Replacement Cache (Megiddo and
+// Modha, FAST '03), sized in bytes. Items seen once live in t1 and items seen
+// again in t2. The ghost lists b1 and b2 remember what was recently evicted
+// from each, and a miss on a ghost moves the target size of t1 towards the
+// list that would have kept it, so the split between recency and frequency
+// adapts to the workload. A one-off pull only churns t1.
+type ARCEvictionPolicy struct {
+	mu sync.Mutex
+
+	maxSizeBytes int64
+	// target is the byte size t1 is steered towards
+	target int64
+
+	t1, t2, b1, b2 arcList
+	items          map[string]*list.Element
+
+	pins pinSet
+}
+
+// NewARCEvictionPolicy creates a new ARC eviction policy. maxSizeBytes is the
+// soft limit for total cached size.
+func NewARCEvictionPolicy(maxSizeBytes int64) EvictionPolicy {
+	return &ARCEvictionPolicy{
+		maxSizeBytes: maxSizeBytes,
+		t1:           arcList{order: list.New()},
+		t2:           arcList{order: list.New()},
+		b1:           arcList{order: list.New()},
+		b2:           arcList{order: list.New()},
+		items:        make(map[string]*list.Element),
+		pins:         newPinSet(),
+	}
+}
+
+func (p *ARCEvictionPolicy) push(l *arcList, key string, size int64) {
+	p.items[key] = l.order.PushFront(&arcEntry{key: key, size: size, in: l})
+	l.size += size
+}
+
+func (p *ARCEvictionPolicy) unlink(elem *list.Element) *arcEntry {
+	entry := elem.Value.(*arcEntry)
+	entry.in.order.Remove(elem)
+	entry.in.size -= entry.size
+	delete(p.items, entry.key)
+	return entry
+}
+
+// Access moves a cached key to the front of t2.
+func (p *ARCEvictionPolicy) Access(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	elem, ok := p.items[key]
+	if !ok {
+		return
+	}
+	entry := elem.Value.(*arcEntry)
+	if entry.in == &p.t1 || entry.in == &p.t2 {
+		p.unlink(elem)
+		p.push(&p.t2, key, entry.size)
+	}
+}
+
+// Add adds a new item and returns the keys that should be evicted from the cache storage.
+func (p *ARCEvictionPolicy) Add(key string, size int64) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pins.cache(key, size) {
+		return nil
+	}
+	return p.add(key, size)
+}
+
+func (p *ARCEvictionPolicy) add(key string, size int64) []string {
+	elem, ok := p.items[key]
+	if !ok {
+		p.push(&p.t1, key, size)
+		return p.evictIfNeeded()
+	}
+
+	entry := p.unlink(elem)
+	switch entry.in {
+	case &p.b1:
+		// Evicted from t1 too early, give recency more room
+		p.target = min(p.maxSizeBytes, p.target+p.delta(size, p.b2.size, p.b1.size))
+	case &p.b2:
+		// Evicted from t2 too early, give frequency more room
+		p.target = max(0, p.target-p.delta(size, p.b1.size, p.b2.size))
+	}
+	p.push(&p.t2, key, size)
+	return p.evictIfNeeded()
+}
+
+// delta is the ARC adaptation step, scaled by how much larger the other ghost list is.
+func (p *ARCEvictionPolicy) delta(size, other, ghost int64) int64 {
+	if ghost <= 0 || other <= ghost {
+		return size
+	}
+	return size * (other / ghost)
+}
+
+// Remove removes an item, ghosts included.
+func (p *ARCEvictionPolicy) Remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pins.uncache(key) {
+		return
+	}
+	if elem, ok := p.items[key]; ok {
+		p.unlink(elem)
+	}
+}
+
+// Pin keeps key out of the ARC lists until it is unpinned.
+func (p *ARCEvictionPolicy) Pin(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.pins.pin(key) {
+		return
+	}
+	elem, ok := p.items[key]
+	if !ok {
+		return
+	}
+	entry := p.unlink(elem)
+	if entry.in == &p.t1 || entry.in == &p.t2 {
+		p.pins.cache(key, entry.size)
+	}
+}
+
+// Unpin drops a pin and returns the keys that should be evicted from the cache storage.
+func (p *ARCEvictionPolicy) Unpin(key string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	size, ok := p.pins.unpin(key)
+	if !ok {
+		return nil
+	}
+	// Pinned items were in demand, resume them as frequent
+	p.push(&p.t2, key, size)
+	return p.evictIfNeeded()
+}
+
+// evictIfNeeded moves items from t1 or t2 to their ghost list until the
+// cached size fits, then trims the ghost lists.
+func (p *ARCEvictionPolicy) evictIfNeeded() []string {
+	if p.maxSizeBytes <= 0 {
+		return nil
+	}
+
+	var evicted []string
+	for p.t1.size+p.t2.size > p.maxSizeBytes {
+		from, ghost := &p.t2, &p.b2
+		if p.t1.order.Len() > 0 && (p.t1.size > p.target || p.t2.order.Len() == 0) {
+			from, ghost = &p.t1, &p.b1
+		}
+		entry := p.unlink(from.order.Back())
+		p.push(ghost, entry.key, entry.size)
+		evicted = append(evicted, entry.key)
+	}
+
+	// Ghosts only hold keys, but are bounded like the cache they shadow
+	for p.t1.size+p.b1.size > p.maxSizeBytes && p.b1.order.Len() > 0 {
+		p.unlink(p.b1.order.Back())
+	}
+	for p.t1.size+p.t2.size+p.b1.size+p.b2.size > 2*p.maxSizeBytes && p.b2.order.Len() > 0 {
+		p.unlink(p.b2.order.Back())
+	}
+
+	return evicted
+}
+
+// Usage reports the cached size against the limit.
+func (p *ARCEvictionPolicy) Usage() Usage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Usage{
+		Size:       p.t1.size + p.t2.size,
+		PinnedSize: p.pins.size,
+		MaxSize:    p.maxSizeBytes,
+	}
+}
+
+// Pinned reports whether key is pinned.
+func (p *ARCEvictionPolicy) Pinned(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pins.has(key)
+}
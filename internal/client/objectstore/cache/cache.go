@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/utils/blake3"
 	"github.com/beanbocchi/templar/internal/utils/ioutil"
 )
 
@@ -19,6 +22,26 @@ type EvictionPolicy interface {
 	Add(key string, size int64) []string
 	// Remove removes an item from the LRU list and returns the keys that should be evicted from the cache storage.
 	Remove(key string)
+	// Pin keeps key from being evicted until a matching Unpin, whether it is
+	// cached yet or not. Pins are counted, and pinned items don't count
+	// toward the size limit.
+	Pin(key string)
+	// Unpin drops a pin on key and returns the keys that should be evicted
+	// from the cache storage once the item counts toward the limit again.
+	Unpin(key string) []string
+	// Usage reports the cached size against the limit.
+	Usage() Usage
+	// Pinned reports whether key is pinned.
+	Pinned(key string) bool
+}
+
+// Usage is the cached size an eviction policy tracks.
+type Usage struct {
+	// Size is the size of the evictable items, kept within MaxSize.
+	Size int64
+	// PinnedSize is the size of the cached pinned items, which don't count toward MaxSize.
+	PinnedSize int64
+	MaxSize    int64
 }
 
 // CacheConfig configures the cache storage.
@@ -29,13 +52,51 @@ type CacheConfig struct {
 	Primary objectstore.Client
 	// EvictionPolicy is the eviction policy for the cache (e.g., LRU with size management).
 	EvictionPolicy EvictionPolicy
+	// Index persists the eviction state across restarts. Optional, without it
+	// objects cached by a previous run are never tracked nor evicted.
+	Index Index
+	// TouchInterval is how often the access times of cache hits are written
+	// to Index. A restart loses at most one interval of access order. Zero
+	// writes each hit as it happens.
+	TouchInterval time.Duration
+	// Pinned are keys pinned from the start, applied before the index is
+	// restored so they are never evicted at boot.
+	Pinned []string
+	// Digests checks objects fetched from primary before they are cached.
+	// Optional, without it whatever primary returns is cached.
+	Digests Digests
+	// SpoolDir holds the objects being fetched from primary on a miss.
+	// Optional, defaults to the system temp directory. Leftovers from a
+	// previous run are removed when it is set.
+	SpoolDir string
+	// WriteBack acknowledges uploads once they are in the cache and writes
+	// them to primary in the background. Optional, without it uploads are
+	// written through to both.
+	WriteBack *WriteBackConfig
 }
 
 // CacheClient implements a caching layer over cache and primary storage with eviction support.
+// Templates are stored as one object per chunk, so entries are chunks: a chunk
+// shared by several versions is cached once, and eviction drops cold chunks
+// rather than whole templates.
 type CacheClient struct {
 	cache          objectstore.Client
 	primary        objectstore.Client
 	evictionPolicy EvictionPolicy
+	index          Index
+	digests        Digests
+	spoolDir       string
+	writeBack      *writeBack
+	counters       counters
+
+	// touched holds the access times not written to the index yet, by key
+	touchInterval time.Duration
+	touchedMu     sync.Mutex
+	touched       map[string]time.Time
+
+	// fills holds the cache misses in progress by key.
+	fillsMu sync.Mutex
+	fills   map[string]*fill
 }
 
 // NewCacheClient creates a new cache storage client.
@@ -50,11 +111,61 @@ func NewCacheClient(cfg CacheConfig) (*CacheClient, error) {
 		return nil, fmt.Errorf("eviction policy is required")
 	}
 
-	return &CacheClient{
+	c := &CacheClient{
 		cache:          cfg.Cache,
 		primary:        cfg.Primary,
 		evictionPolicy: cfg.EvictionPolicy,
-	}, nil
+		index:          cfg.Index,
+		digests:        cfg.Digests,
+		spoolDir:       cfg.SpoolDir,
+		fills:          make(map[string]*fill),
+		touchInterval:  cfg.TouchInterval,
+		touched:        make(map[string]time.Time),
+	}
+
+	if cfg.WriteBack != nil {
+		if cfg.WriteBack.Log == nil {
+			return nil, fmt.Errorf("write-back log is required")
+		}
+		if cfg.WriteBack.Concurrency < 1 {
+			return nil, fmt.Errorf("write-back concurrency must be at least 1")
+		}
+		c.writeBack = newWriteBack(*cfg.WriteBack)
+	}
+
+	if c.spoolDir != "" {
+		if err := os.MkdirAll(c.spoolDir, 0o755); err != nil {
+			return nil, fmt.Errorf("create spool dir: %w", err)
+		}
+		if err := removeSpools(c.spoolDir); err != nil {
+			return nil, fmt.Errorf("remove stale spools: %w", err)
+		}
+	}
+
+	for _, key := range cfg.Pinned {
+		c.evictionPolicy.Pin(key)
+	}
+
+	if c.writeBack != nil {
+		if err := c.restoreWriteBack(context.Background()); err != nil {
+			return nil, fmt.Errorf("restore cache write-back: %w", err)
+		}
+	}
+
+	if c.index != nil {
+		if err := c.restore(context.Background()); err != nil {
+			return nil, fmt.Errorf("restore cache index: %w", err)
+		}
+	}
+
+	if c.writeBack != nil {
+		go c.runWriteBack()
+	}
+	if c.index != nil && c.touchInterval > 0 {
+		go c.runTouches()
+	}
+
+	return c, nil
 }
 
 func (c *CacheClient) cacheUpload(ctx context.Context, key string, content io.Reader) error {
@@ -62,22 +173,70 @@ func (c *CacheClient) cacheUpload(ctx context.Context, key string, content io.Re
 	if err := c.cache.Upload(ctx, key, sizeReader); err != nil {
 		return fmt.Errorf("upload to cache: %w", err)
 	}
+
+	if c.index != nil {
+		entry := IndexEntry{Key: key, Size: sizeReader.Size, AccessedAt: time.Now()}
+		if err := c.index.Put(ctx, entry); err != nil {
+			slog.Warn("failed to record cache entry", "key", key, "error", err)
+		}
+	}
+
 	keys := c.evictionPolicy.Add(key, sizeReader.Size)
 	for _, evictKey := range keys {
-		if err := c.cache.Delete(ctx, evictKey); err != nil {
-			slog.Warn("failed to evict", "key", evictKey, "error", err)
-		}
+		c.evict(ctx, evictKey)
 	}
 	return nil
 }
 
-// Upload uploads to both cache and primary storage.
+// evict deletes an object the eviction policy dropped.
+func (c *CacheClient) evict(ctx context.Context, key string) {
+	if err := c.cache.Delete(ctx, key); err != nil {
+		slog.Warn("failed to evict", "key", key, "error", err)
+		return
+	}
+	c.counters.evictions.Add(1)
+	c.forget(ctx, key)
+}
+
+// forget removes key from the index.
+func (c *CacheClient) forget(ctx context.Context, key string) {
+	if c.index == nil {
+		return
+	}
+	// A hit from before doesn't carry over if the key is cached again
+	c.touchedMu.Lock()
+	delete(c.touched, key)
+	c.touchedMu.Unlock()
+
+	if err := c.index.Delete(ctx, key); err != nil {
+		slog.Warn("failed to forget cache entry", "key", key, "error", err)
+	}
+}
+
+// access records a cache hit.
+func (c *CacheClient) access(ctx context.Context, key string) {
+	c.evictionPolicy.Access(key)
+	if c.index == nil {
+		return
+	}
+	c.touch(ctx, key)
+}
+
+// Upload uploads to both cache and primary storage. In write-back mode it
+// returns once the object is in the cache, and primary gets it later.
 func (c *CacheClient) Upload(ctx context.Context, key string, content io.Reader) error {
+	if c.writeBack != nil {
+		return c.uploadWriteBack(ctx, key, content)
+	}
+
 	// Create a pipe for the cache
 	pr, pw := io.Pipe()
 
-	// one stream goes to primary, one to the pipe
-	teeReader := io.TeeReader(content, pw)
+	// one stream goes to primary, one to the pipe, and both are measured
+	// for the digest later fills are checked against
+	sizeReader := ioutil.NewSizeReader(content)
+	hasher := blake3.New()
+	teeReader := io.TeeReader(io.TeeReader(sizeReader, hasher), pw)
 
 	var cacheErr error
 	var wg sync.WaitGroup
@@ -112,11 +271,17 @@ func (c *CacheClient) Upload(ctx context.Context, key string, content io.Reader)
 		slog.Warn("failed to cache", "key", key, "error", cacheErr)
 	}
 
+	// Without a digest the object could still be cached, just not verified
+	if err := c.recordDigest(ctx, key, Digest{Size: sizeReader.Size, Hash: hasher.Sum()}); err != nil {
+		slog.Warn("failed to record digest", "key", key, "error", err)
+	}
+
 	return nil
 }
 
 // CreateMultipart starts a multipart upload on the primary store. We defer
-// caching until completion to avoid duplicating multipart state.
+// caching until completion to avoid duplicating multipart state, so multipart
+// uploads are written through even in write-back mode.
 func (c *CacheClient) CreateMultipart(ctx context.Context, key string) (string, error) {
 	return c.primary.CreateMultipart(ctx, key)
 }
@@ -139,7 +304,8 @@ func (c *CacheClient) CompleteMultipart(ctx context.Context, key string, uploadI
 		return fmt.Errorf("complete multipart on primary: %w", err)
 	}
 
-	// Refresh cache with the new object contents.
+	// Refresh cache with the new object contents. Parts may have been
+	// uploaded in any order, so the digest is taken from this read.
 	reader, err := c.primary.Download(ctx, key)
 	if err != nil {
 		slog.Warn("cache refresh after multipart complete failed (download)", "key", key, "error", err)
@@ -147,8 +313,15 @@ func (c *CacheClient) CompleteMultipart(ctx context.Context, key string, uploadI
 	}
 	defer reader.Close()
 
-	if err := c.cacheUpload(ctx, key, reader); err != nil {
+	sizeReader := ioutil.NewSizeReader(reader)
+	hasher := blake3.New()
+	if err := c.cacheUpload(ctx, key, io.TeeReader(sizeReader, hasher)); err != nil {
 		slog.Warn("cache refresh after multipart complete failed (upload)", "key", key, "error", err)
+		return nil
+	}
+
+	if err := c.recordDigest(ctx, key, Digest{Size: sizeReader.Size, Hash: hasher.Sum()}); err != nil {
+		slog.Warn("failed to record digest", "key", key, "error", err)
 	}
 
 	return nil
@@ -159,48 +332,52 @@ func (c *CacheClient) AbortMultipart(ctx context.Context, key, uploadID string)
 	return c.primary.AbortMultipart(ctx, key, uploadID)
 }
 
-// Get retrieves a file from cache first, then falls back to primary.
+// Download retrieves a file from cache first, then falls back to primary.
+//
+// A miss is streamed as primary sends it, so the fill can only be checked
+// against its digest after the last byte: a fill that doesn't match ends in
+// an error instead of io.EOF. Callers passing the object on must treat that
+// as a failed read, not a short object; a response streamed to a client is
+// cut short, so the client never sees a complete download.
 func (c *CacheClient) Download(ctx context.Context, key string) (io.ReadCloser, error) {
 	cacheReader, err := c.cache.Download(ctx, key)
 	if err == nil {
 		// Found in cache - update access time for LRU
-		c.evictionPolicy.Access(key)
-		return cacheReader, nil
+		c.access(ctx, key)
+		c.counters.hits.Add(1)
+		return &countingReader{ReadCloser: cacheReader, n: &c.counters.bytesFromCache}, nil
 	}
+	c.counters.misses.Add(1)
 
-	// teeReader(primaryReader) -> pipe -> cache
-
-	primaryReader, err := c.primary.Download(ctx, key)
+	// Concurrent misses share one primary fetch, which also fills the cache
+	reader, err := c.joinFill(key).reader(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("get from primary: %w", err)
+		return nil, err
 	}
+	return &countingReader{ReadCloser: reader, n: &c.counters.bytesFromPrimary}, nil
+}
 
-	pr, pw := io.Pipe()
-	teeReader := io.TeeReader(primaryReader, pw)
-
-	go func() {
-		if err := c.cacheUpload(ctx, key, pr); err != nil {
-			slog.Warn("failed to cache", "key", key, "error", err)
-			// Drain pipe to prevent blocking the download
-			_, _ = io.Copy(io.Discard, pr)
-		}
-	}()
+// DownloadRange serves a byte range from cache, falling back to primary. A miss
+// also fills the cache with the full object in the background, so a resumed
+// download is served locally.
+func (c *CacheClient) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	cacheReader, err := c.cache.DownloadRange(ctx, key, offset, length)
+	if err == nil {
+		c.access(ctx, key)
+		c.counters.hits.Add(1)
+		return &countingReader{ReadCloser: cacheReader, n: &c.counters.bytesFromCache}, nil
+	}
+	c.counters.misses.Add(1)
 
-	// Return a reader that will close the pipe when closed (if we dont close it, the background upload will hang)
-	return &teePipeReadCloser{
-		Reader: teeReader,
-		pipeW:  pw,
-	}, nil
-}
+	primaryReader, err := c.primary.DownloadRange(ctx, key, offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("get range from primary: %w", err)
+	}
 
-// teePipeReadCloser wraps a teeReader and closes the pipe when closed.
-type teePipeReadCloser struct {
-	io.Reader
-	pipeW *io.PipeWriter
-}
+	// Nobody reads this fill, it only brings the object into the cache
+	c.joinFill(key).release()
 
-func (c *teePipeReadCloser) Close() error {
-	return c.pipeW.Close()
+	return &countingReader{ReadCloser: primaryReader, n: &c.counters.bytesFromPrimary}, nil
 }
 
 // Delete deletes a file from both cache and primary storage.
@@ -209,11 +386,45 @@ func (c *CacheClient) Delete(ctx context.Context, key string) error {
 		slog.Warn("failed to delete from cache", "key", key, "error", err)
 	} else {
 		c.evictionPolicy.Remove(key)
+		c.forget(ctx, key)
 	}
 
-	if err := c.primary.Delete(ctx, key); err != nil {
+	// An object still waiting to be written back may not be in primary
+	pending := c.writeBack != nil && c.dropWriteBack(ctx, key)
+
+	if err := c.primary.Delete(ctx, key); err != nil && !pending {
 		return fmt.Errorf("delete from primary: %w", err)
 	}
 
+	if c.digests != nil {
+		if err := c.digests.Delete(ctx, key); err != nil {
+			slog.Warn("failed to delete digest", "key", key, "error", err)
+		}
+	}
+
 	return nil
 }
+
+// Stat serves metadata from the cache when the object is cached, otherwise from primary.
+func (c *CacheClient) Stat(ctx context.Context, key string) (objectstore.ObjectInfo, error) {
+	if info, err := c.cache.Stat(ctx, key); err == nil {
+		return info, nil
+	}
+
+	info, err := c.primary.Stat(ctx, key)
+	if err != nil {
+		return objectstore.ObjectInfo{}, fmt.Errorf("stat from primary: %w", err)
+	}
+	return info, nil
+}
+
+// Cached reports whether key is in the cache, without fetching it.
+func (c *CacheClient) Cached(ctx context.Context, key string) bool {
+	_, err := c.cache.Stat(ctx, key)
+	return err == nil
+}
+
+// List lists the primary store, which holds every object (the cache only holds a subset).
+func (c *CacheClient) List(ctx context.Context, prefix string) objectstore.ObjectIterator {
+	return c.primary.List(ctx, prefix)
+}
@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore/memory"
+)
+
+func newMemoryCacheClient(t *testing.T, policy EvictionPolicy) (*CacheClient, *memory.ClientImpl) {
+	t.Helper()
+	tier, err := memory.NewClient(memory.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("memory.NewClient: %v", err)
+	}
+	primary, err := memory.NewClient(memory.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("memory.NewClient: %v", err)
+	}
+	client, err := NewCacheClient(CacheConfig{Cache: tier, Primary: primary, EvictionPolicy: policy})
+	if err != nil {
+		t.Fatalf("NewCacheClient: %v", err)
+	}
+	return client, tier
+}
+
+func TestCacheClientEviction(t *testing.T) {
+	ctx := context.Background()
+	for name, newPolicy := range policies {
+		t.Run(name, func(t *testing.T) {
+			client, tier := newMemoryCacheClient(t, newPolicy(500))
+			content := func(i int) []byte { return bytes.Repeat([]byte{byte(i)}, 100) }
+
+			client.Pin("0")
+			for i := range 20 {
+				if err := client.Upload(ctx, fmt.Sprint(i), bytes.NewReader(content(i))); err != nil {
+					t.Fatalf("Upload: %v", err)
+				}
+			}
+
+			// The cache tier holds what the policy accounts for, no more
+			var size int64
+			objects := tier.List(ctx, "")
+			for objects.Next() {
+				size += objects.Item().Size
+			}
+			if err := objects.Err(); err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			usage := client.evictionPolicy.Usage()
+			if size != usage.Size+usage.PinnedSize {
+				t.Fatalf("cache tier holds %d bytes, the policy accounts for %d + %d pinned", size, usage.Size, usage.PinnedSize)
+			}
+			if usage.Size > 500 {
+				t.Fatalf("usage %d over the limit 500", usage.Size)
+			}
+			if !client.Cached(ctx, "0") {
+				t.Fatal("pinned key evicted")
+			}
+
+			// Evicted objects are still served from primary
+			for i := range 20 {
+				body, err := client.Download(ctx, fmt.Sprint(i))
+				if err != nil {
+					t.Fatalf("Download %d: %v", i, err)
+				}
+				got, err := io.ReadAll(body)
+				body.Close()
+				if err != nil {
+					t.Fatalf("read %d: %v", i, err)
+				}
+				if !bytes.Equal(got, content(i)) {
+					t.Fatalf("object %d read back wrong", i)
+				}
+			}
+		})
+	}
+}
+
+// stalledStore sends the first bytes of every download, then nothing until
+// resume is closed.
+type stalledStore struct {
+	*memory.ClientImpl
+	resume chan struct{}
+}
+
+func (s *stalledStore) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, err := s.ClientImpl.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer body.Close()
+		io.CopyN(pw, body, 10)
+		<-s.resume
+		_, err := io.Copy(pw, body)
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+func TestFillReaderContext(t *testing.T) {
+	tier, _ := memory.NewClient(memory.MemoryConfig{})
+	primary, _ := memory.NewClient(memory.MemoryConfig{})
+	stalled := &stalledStore{ClientImpl: primary, resume: make(chan struct{})}
+	client, err := NewCacheClient(CacheConfig{Cache: tier, Primary: stalled, EvictionPolicy: policies["lru"](1 << 20)})
+	if err != nil {
+		t.Fatalf("NewCacheClient: %v", err)
+	}
+	content := bytes.Repeat([]byte("x"), 100)
+	if err := primary.Upload(context.Background(), "key", bytes.NewReader(content)); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	body, err := client.Download(ctx, "key")
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	defer body.Close()
+	if _, err := io.ReadFull(body, make([]byte, 10)); err != nil {
+		t.Fatalf("read the bytes sent: %v", err)
+	}
+
+	// Waiting on the stalled primary gives up with the context
+	done := make(chan error, 1)
+	go func() {
+		_, err := body.Read(make([]byte, 10))
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Read error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read still waiting after its context was canceled")
+	}
+
+	// The fill goes on for other readers
+	close(stalled.resume)
+	other, err := client.Download(context.Background(), "key")
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	defer other.Close()
+	got, err := io.ReadAll(other)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("object read back wrong")
+	}
+}
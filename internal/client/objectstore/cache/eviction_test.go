@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+var policies = map[string]func(maxSizeBytes int64) EvictionPolicy{
+	"lru":      NewLRUEvictionPolicy,
+	"lfu":      NewLFUEvictionPolicy,
+	"arc":      NewARCEvictionPolicy,
+	"wtinylfu": NewTinyLFUEvictionPolicy,
+	"gdsf":     NewGDSFEvictionPolicy,
+}
+
+// tracked drives a policy like CacheClient does and keeps the items it holds,
+// to check the policy's accounting against.
+type tracked struct {
+	t      *testing.T
+	policy EvictionPolicy
+	cached map[string]int64
+}
+
+func newTracked(t *testing.T, newPolicy func(int64) EvictionPolicy, maxSizeBytes int64) *tracked {
+	return &tracked{t: t, policy: newPolicy(maxSizeBytes), cached: make(map[string]int64)}
+}
+
+func (tr *tracked) add(key string, size int64) {
+	tr.cached[key] = size
+	tr.evict(tr.policy.Add(key, size))
+}
+
+func (tr *tracked) remove(key string) {
+	delete(tr.cached, key)
+	tr.policy.Remove(key)
+}
+
+func (tr *tracked) unpin(key string) {
+	tr.evict(tr.policy.Unpin(key))
+}
+
+func (tr *tracked) evict(keys []string) {
+	tr.t.Helper()
+	for _, key := range keys {
+		if tr.policy.Pinned(key) {
+			tr.t.Fatalf("pinned key %s evicted", key)
+		}
+		delete(tr.cached, key)
+	}
+}
+
+// check compares the usage the policy reports with the items it holds.
+func (tr *tracked) check() {
+	tr.t.Helper()
+	var size, pinnedSize int64
+	for key, itemSize := range tr.cached {
+		if tr.policy.Pinned(key) {
+			pinnedSize += itemSize
+		} else {
+			size += itemSize
+		}
+	}
+
+	usage := tr.policy.Usage()
+	if usage.Size != size || usage.PinnedSize != pinnedSize {
+		tr.t.Fatalf("usage is %d + %d pinned, the cached items add up to %d + %d pinned", usage.Size, usage.PinnedSize, size, pinnedSize)
+	}
+	if usage.Size > usage.MaxSize {
+		tr.t.Fatalf("usage %d over the limit %d", usage.Size, usage.MaxSize)
+	}
+}
+
+func TestPoliciesStayWithinLimit(t *testing.T) {
+	for name, newPolicy := range policies {
+		t.Run(name, func(t *testing.T) {
+			tr := newTracked(t, newPolicy, 10_000)
+			rng := rand.New(rand.NewSource(1))
+
+			for i := range 5000 {
+				key := fmt.Sprint(rng.Intn(300))
+				switch {
+				case rng.Intn(10) == 0:
+					tr.remove(key)
+				case tr.cached[key] != 0:
+					tr.policy.Access(key)
+				default:
+					tr.add(key, int64(1+rng.Intn(500)))
+				}
+				if i%50 == 0 {
+					tr.check()
+				}
+			}
+			tr.check()
+		})
+	}
+}
+
+func TestPinnedItemsAreKept(t *testing.T) {
+	for name, newPolicy := range policies {
+		t.Run(name, func(t *testing.T) {
+			tr := newTracked(t, newPolicy, 1000)
+
+			tr.add("cached", 100)
+			tr.policy.Pin("cached")
+			// Pinned before it is cached, and pinned twice
+			tr.policy.Pin("later")
+			tr.policy.Pin("later")
+			tr.add("later", 200)
+			tr.check()
+			if usage := tr.policy.Usage(); usage.PinnedSize != 300 {
+				t.Fatalf("pinned size %d, want 300", usage.PinnedSize)
+			}
+
+			// Fill the cache several times over
+			for i := range 100 {
+				tr.add(fmt.Sprint(i), 90)
+				tr.policy.Access(fmt.Sprint(i))
+			}
+			tr.check()
+			for _, key := range []string{"cached", "later"} {
+				if _, ok := tr.cached[key]; !ok {
+					t.Fatalf("pinned key %s evicted", key)
+				}
+			}
+
+			// One pin is left on later
+			tr.unpin("later")
+			if !tr.policy.Pinned("later") {
+				t.Fatal("later unpinned while a pin is left")
+			}
+			tr.unpin("later")
+			tr.unpin("cached")
+			if tr.policy.Pinned("later") || tr.policy.Pinned("cached") {
+				t.Fatal("keys still pinned after their last unpin")
+			}
+			tr.check()
+			if usage := tr.policy.Usage(); usage.PinnedSize != 0 {
+				t.Fatalf("pinned size %d after every unpin, want 0", usage.PinnedSize)
+			}
+
+			// A pinned item removed from the cache is dropped from the pinned size
+			tr.policy.Pin("0")
+			tr.add("0", 50)
+			tr.remove("0")
+			tr.check()
+			if !tr.policy.Pinned("0") {
+				t.Fatal("removing an item dropped its pin")
+			}
+		})
+	}
+}
+
+func TestItemLargerThanLimit(t *testing.T) {
+	for name, newPolicy := range policies {
+		t.Run(name, func(t *testing.T) {
+			tr := newTracked(t, newPolicy, 1000)
+			tr.add("small", 100)
+			tr.add("huge", 5000)
+			tr.check()
+		})
+	}
+}
+
+// evictedAfter fills a policy holding three items of 10 bytes, uses them, and
+// returns what adding a fourth evicts.
+func evictedAfter(newPolicy func(int64) EvictionPolicy, accesses ...string) []string {
+	policy := newPolicy(30)
+	for _, key := range []string{"a", "b", "c"} {
+		policy.Add(key, 10)
+	}
+	for _, key := range accesses {
+		policy.Access(key)
+	}
+	return policy.Add("d", 10)
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	if evicted := evictedAfter(NewLRUEvictionPolicy, "a", "c"); !slices.Equal(evicted, []string{"b"}) {
+		t.Fatalf("evicted %v, want [b]", evicted)
+	}
+}
+
+func TestLFUEvictsLeastFrequentlyUsed(t *testing.T) {
+	// b is as frequent as the new item, but older
+	if evicted := evictedAfter(NewLFUEvictionPolicy, "a", "c", "a"); !slices.Equal(evicted, []string{"b"}) {
+		t.Fatalf("evicted %v, want [b]", evicted)
+	}
+}
+
+func TestGDSFEvictsLargeRarelyUsed(t *testing.T) {
+	policy := NewGDSFEvictionPolicy(150)
+	policy.Add("small", 10)
+	policy.Add("large", 100)
+	policy.Access("small")
+
+	if evicted := policy.Add("new", 50); !slices.Equal(evicted, []string{"large"}) {
+		t.Fatalf("evicted %v, want [large]", evicted)
+	}
+}
+
+// A scan of items used once doesn't flush the items used all the time.
+func TestScanResistance(t *testing.T) {
+	for _, name := range []string{"arc", "wtinylfu"} {
+		t.Run(name, func(t *testing.T) {
+			tr := newTracked(t, policies[name], 1000)
+			hot := []string{"hot0", "hot1", "hot2", "hot3", "hot4"}
+			for range 5 {
+				for _, key := range hot {
+					if _, ok := tr.cached[key]; !ok {
+						tr.add(key, 10)
+					}
+					tr.policy.Access(key)
+				}
+			}
+
+			for i := range 500 {
+				tr.add(fmt.Sprintf("scan%d", i), 10)
+			}
+			tr.check()
+			for _, key := range hot {
+				if _, ok := tr.cached[key]; !ok {
+					t.Fatalf("%s evicted by the scan", key)
+				}
+			}
+		})
+	}
+}
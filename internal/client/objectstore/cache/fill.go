@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/beanbocchi/templar/internal/utils/blake3"
+)
+
+// spoolPattern names the files fills are spooled to.
+const spoolPattern = "templar-fill-*"
+
+// fill is an in-progress cache miss. A single goroutine copies the object from
+// primary into a spool file as fast as primary sends it, and every reader of
+// the key, the cache upload included, tails that file at its own pace. A slow
+// client never holds up the fetch nor the cache, and concurrent misses cost
+// one primary fetch. The fill is only committed once the whole object is read
+// and verified. Readers get the bytes before that, and a failed verification
+// as the error in place of io.EOF.
+type fill struct {
+	// ready is closed once the primary stream is open, or failed to open.
+	ready   chan struct{}
+	openErr error
+
+	// spool is appended to by the fill only, readers use ReadAt.
+	spool *os.File
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	size int64
+	done bool
+	err  error
+	// refs counts the fill itself and its open readers, the spool is removed
+	// once the last one lets go.
+	refs int
+}
+
+func newFill() *fill {
+	f := &fill{ready: make(chan struct{}), refs: 1}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *fill) Write(p []byte) (int, error) {
+	n, err := f.spool.Write(p)
+
+	f.mu.Lock()
+	f.size += int64(n)
+	f.cond.Broadcast()
+	f.mu.Unlock()
+
+	return n, err
+}
+
+// finish marks the fill complete, err is what readers get after the last byte.
+func (f *fill) finish(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.done = true
+	f.err = err
+	f.cond.Broadcast()
+}
+
+// acquire takes a reference, which must be taken while the fill is still
+// registered so the spool can't be removed in between.
+func (f *fill) acquire() {
+	f.mu.Lock()
+	f.refs++
+	f.mu.Unlock()
+}
+
+// release drops a reference, removing the spool with the last one.
+func (f *fill) release() {
+	f.mu.Lock()
+	f.refs--
+	last := f.refs == 0
+	f.mu.Unlock()
+
+	if last && f.spool != nil {
+		f.spool.Close()
+		if err := os.Remove(f.spool.Name()); err != nil {
+			slog.Warn("failed to remove fill spool", "path", f.spool.Name(), "error", err)
+		}
+	}
+}
+
+// reader waits for the primary stream to open and returns a reader from the
+// start of the object. The reader owns the reference taken by acquire, which
+// is dropped right away if the stream can't be read. Like a download stream,
+// the reader stops waiting for bytes once ctx is done.
+func (f *fill) reader(ctx context.Context) (io.ReadCloser, error) {
+	select {
+	case <-f.ready:
+	case <-ctx.Done():
+		f.release()
+		return nil, ctx.Err()
+	}
+	if f.openErr != nil {
+		f.release()
+		return nil, f.openErr
+	}
+
+	// Wake the waiting readers, the one of ctx gives up
+	stop := context.AfterFunc(ctx, func() {
+		f.mu.Lock()
+		f.cond.Broadcast()
+		f.mu.Unlock()
+	})
+	return &fillReader{fill: f, ctx: ctx, stop: stop}, nil
+}
+
+// fillReader reads a fill from the start, waiting for bytes not yet fetched.
+type fillReader struct {
+	fill      *fill
+	ctx       context.Context
+	stop      func() bool
+	offset    int64
+	closeOnce sync.Once
+}
+
+func (r *fillReader) Read(p []byte) (int, error) {
+	f := r.fill
+	f.mu.Lock()
+	for r.offset >= f.size && !f.done {
+		if err := r.ctx.Err(); err != nil {
+			f.mu.Unlock()
+			return 0, err
+		}
+		f.cond.Wait()
+	}
+	avail := f.size - r.offset
+	done, err := f.done, f.err
+	f.mu.Unlock()
+
+	if avail > 0 {
+		n, err := f.spool.ReadAt(p[:min(int64(len(p)), avail)], r.offset)
+		r.offset += int64(n)
+		if err != nil && err != io.EOF {
+			return n, fmt.Errorf("read fill spool: %w", err)
+		}
+		return n, nil
+	}
+	if done && err != nil {
+		return 0, err
+	}
+	return 0, io.EOF
+}
+
+func (r *fillReader) Close() error {
+	r.closeOnce.Do(func() {
+		r.stop()
+		r.fill.release()
+	})
+	return nil
+}
+
+// joinFill returns the fill in progress for key, starting one if there is none.
+// The caller holds a reference on it, to hand to reader or to release.
+func (c *CacheClient) joinFill(key string) *fill {
+	c.fillsMu.Lock()
+	defer c.fillsMu.Unlock()
+
+	f, ok := c.fills[key]
+	if !ok {
+		f = newFill()
+		c.fills[key] = f
+		go c.runFill(key, f)
+	}
+	f.acquire()
+	return f
+}
+
+// runFill spools key from primary and uploads the spool to the cache as it grows.
+func (c *CacheClient) runFill(key string, f *fill) {
+	// The fill must outlive the request that started it
+	ctx := context.Background()
+	defer func() {
+		c.fillsMu.Lock()
+		delete(c.fills, key)
+		c.fillsMu.Unlock()
+		f.release()
+	}()
+
+	spool, err := os.CreateTemp(c.spoolDir, spoolPattern)
+	if err != nil {
+		f.openErr = fmt.Errorf("create fill spool: %w", err)
+		close(f.ready)
+		return
+	}
+	f.spool = spool
+
+	primaryReader, err := c.primary.Download(ctx, key)
+	if err != nil {
+		f.openErr = fmt.Errorf("get from primary: %w", err)
+		close(f.ready)
+		return
+	}
+	defer primaryReader.Close()
+	close(f.ready)
+
+	// The cache upload is one more reader of the spool. It gets the fill error
+	// instead of EOF, so a fill that fails or doesn't match is never committed.
+	f.acquire()
+	cacheReader, _ := f.reader(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cacheReader.Close()
+		if err := c.cacheUpload(ctx, key, cacheReader); err != nil {
+			slog.Warn("failed to cache", "key", key, "error", err)
+		}
+	}()
+
+	hasher := blake3.New()
+	size, err := io.Copy(io.MultiWriter(f, hasher), primaryReader)
+	if err != nil {
+		err = fmt.Errorf("read from primary: %w", err)
+	} else {
+		err = c.verify(ctx, key, size, hasher.Sum())
+		if err != nil {
+			slog.Error("cache fill does not match its digest, discarded", "key", key, "error", err)
+		}
+	}
+	f.finish(err)
+
+	// Keep the fill registered until the cache has the object, so a new
+	// reader either joins it or hits the cache
+	wg.Wait()
+}
+
+// removeSpools deletes the spool files left behind by fills cut short by a crash.
+func removeSpools(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, spoolPattern))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package cache
+
+import "sync"
+
+// gdsfCostUnit is the transfer size that costs as much as a request round
+// trip to primary when refetching an object.
+const gdsfCostUnit = 1024 * 1024
+
+// GDSFEvictionPolicy implements Greedy-Dual-Size-Frequency. An item's priority
+// is L + frequency * cost / size, where cost is the estimated time to fetch it
+// again from primary and L is the priority of the last evicted item, so items
+// that stop being used age out. Per byte, small items are worth more, but a
+// large item used often outranks a large one used once.
+type GDSFEvictionPolicy struct {
+	mu   sync.Mutex
+	set  prioritySet
+	pins pinSet
+	// inflation is L, raised to each evicted priority
+	inflation float64
+}
+
+// NewGDSFEvictionPolicy creates a new GDSF eviction policy. maxSizeBytes is
+// the soft limit for total cached size.
+func NewGDSFEvictionPolicy(maxSizeBytes int64) EvictionPolicy {
+	return &GDSFEvictionPolicy{set: newPrioritySet(maxSizeBytes), pins: newPinSet()}
+}
+
+func (p *GDSFEvictionPolicy) priority(entry *priorityEntry) float64 {
+	size := float64(max(entry.size, 1))
+	cost := 1 + size/gdsfCostUnit
+	return p.inflation + float64(entry.freq)*cost/size
+}
+
+// Access counts a use of key and raises its priority.
+func (p *GDSFEvictionPolicy) Access(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry, ok := p.set.items[key]; ok {
+		p.set.touch(entry, p.priority)
+	}
+}
+
+// Add adds a new item and returns the keys that should be evicted from the cache storage.
+func (p *GDSFEvictionPolicy) Add(key string, size int64) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pins.cache(key, size) {
+		return nil
+	}
+	return p.add(key, size)
+}
+
+func (p *GDSFEvictionPolicy) add(key string, size int64) []string {
+	if entry, ok := p.set.items[key]; ok {
+		p.set.touch(entry, p.priority)
+		return nil
+	}
+
+	p.set.add(key, size, p.priority)
+	return p.set.evictIfNeeded(func(entry *priorityEntry) {
+		p.inflation = entry.priority
+	})
+}
+
+// Remove removes an item.
+func (p *GDSFEvictionPolicy) Remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pins.uncache(key) {
+		return
+	}
+	p.set.remove(key)
+}
+
+// Pin keeps key out of eviction until it is unpinned. Its count starts over once unpinned.
+func (p *GDSFEvictionPolicy) Pin(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.pins.pin(key) {
+		return
+	}
+	if size, ok := p.set.remove(key); ok {
+		p.pins.cache(key, size)
+	}
+}
+
+// Unpin drops a pin and returns the keys that should be evicted from the cache storage.
+func (p *GDSFEvictionPolicy) Unpin(key string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	size, ok := p.pins.unpin(key)
+	if !ok {
+		return nil
+	}
+	return p.add(key, size)
+}
+
+// Usage reports the cached size against the limit.
+func (p *GDSFEvictionPolicy) Usage() Usage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Usage{
+		Size:       p.set.currentSize,
+		PinnedSize: p.pins.size,
+		MaxSize:    p.set.maxSizeBytes,
+	}
+}
+
+// Pinned reports whether key is pinned.
+func (p *GDSFEvictionPolicy) Pinned(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pins.has(key)
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// IndexEntry is a cached object as recorded in an Index.
+type IndexEntry struct {
+	Key        string
+	Size       int64
+	AccessedAt time.Time
+}
+
+// Index persists what the cache holds and when it was last read, so the
+// eviction policy can be rebuilt after a restart.
+type Index interface {
+	// List returns every recorded entry.
+	List(ctx context.Context) ([]IndexEntry, error)
+	// ListRecent returns limit entries from offset, most recently accessed first.
+	ListRecent(ctx context.Context, limit, offset int) ([]IndexEntry, error)
+	// Put records an entry, replacing any previous one.
+	Put(ctx context.Context, entry IndexEntry) error
+	// Touch updates the access times of entries, in one batch. Keys that
+	// aren't recorded are skipped.
+	Touch(ctx context.Context, accessed map[string]time.Time) error
+	// Delete forgets an entry.
+	Delete(ctx context.Context, key string) error
+}
+
+// restore feeds the eviction policy with the objects already in the cache,
+// least recently used first. The cache tier is the source of truth for what
+// exists: objects missing from the index (a crash between the write and the
+// index update) are added with their modification time, and entries whose
+// object is gone are dropped.
+func (c *CacheClient) restore(ctx context.Context) error {
+	entries, err := c.index.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list index: %w", err)
+	}
+	recorded := make(map[string]IndexEntry, len(entries))
+	for _, entry := range entries {
+		recorded[entry.Key] = entry
+	}
+
+	var restored []IndexEntry
+	it := c.cache.List(ctx, "")
+	for it.Next() {
+		info := it.Item()
+		entry, ok := recorded[info.Key]
+		delete(recorded, info.Key)
+		if !ok || entry.Size != info.Size {
+			entry = IndexEntry{Key: info.Key, Size: info.Size, AccessedAt: info.ModTime}
+			if err := c.index.Put(ctx, entry); err != nil {
+				return fmt.Errorf("record %s: %w", info.Key, err)
+			}
+		}
+		restored = append(restored, entry)
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("list cache: %w", err)
+	}
+
+	for key := range recorded {
+		if err := c.index.Delete(ctx, key); err != nil {
+			return fmt.Errorf("forget %s: %w", key, err)
+		}
+	}
+
+	sort.Slice(restored, func(i, j int) bool {
+		return restored[i].AccessedAt.Before(restored[j].AccessedAt)
+	})
+
+	// The limit may have shrunk since the last run
+	evicted := 0
+	for _, entry := range restored {
+		for _, key := range c.evictionPolicy.Add(entry.Key, entry.Size) {
+			c.evict(ctx, key)
+			evicted++
+		}
+	}
+
+	slog.Info("cache index restored", "entries", len(restored)-evicted, "stale", len(recorded), "evicted", evicted)
+	return nil
+}
+
+// touch records a cache hit in the index. With a touch interval the access
+// time is kept in memory and written with the other hits of the interval by
+// runTouches, so hits don't each cost a write.
+func (c *CacheClient) touch(ctx context.Context, key string) {
+	if c.touchInterval <= 0 {
+		if err := c.index.Touch(ctx, map[string]time.Time{key: time.Now()}); err != nil {
+			slog.Warn("failed to touch cache entry", "key", key, "error", err)
+		}
+		return
+	}
+
+	c.touchedMu.Lock()
+	c.touched[key] = time.Now()
+	c.touchedMu.Unlock()
+}
+
+// runTouches writes the buffered access times every touch interval.
+func (c *CacheClient) runTouches() {
+	ticker := time.NewTicker(c.touchInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.flushTouches(context.Background())
+	}
+}
+
+// flushTouches writes the access times buffered since the last flush. They
+// are dropped on failure, the entries only look older than they are.
+func (c *CacheClient) flushTouches(ctx context.Context) {
+	c.touchedMu.Lock()
+	touched := c.touched
+	c.touched = make(map[string]time.Time)
+	c.touchedMu.Unlock()
+
+	if len(touched) == 0 {
+		return
+	}
+	if err := c.index.Touch(ctx, touched); err != nil {
+		slog.Warn("failed to touch cache entries", "entries", len(touched), "error", err)
+	}
+}
@@ -0,0 +1,109 @@
+package cache
+
+import "sync"
+
+// LFUEvictionPolicy evicts the least frequently used items first, the least
+// recently used among equals. Counts only grow, so items that were hot once
+// stay until they are outnumbered.
+type LFUEvictionPolicy struct {
+	mu   sync.Mutex
+	set  prioritySet
+	pins pinSet
+}
+
+// NewLFUEvictionPolicy creates a new LFU eviction policy. maxSizeBytes is the
+// soft limit for total cached size.
+func NewLFUEvictionPolicy(maxSizeBytes int64) EvictionPolicy {
+	return &LFUEvictionPolicy{set: newPrioritySet(maxSizeBytes), pins: newPinSet()}
+}
+
+func lfuPriority(entry *priorityEntry) float64 {
+	return float64(entry.freq)
+}
+
+// Access counts a use of key.
+func (p *LFUEvictionPolicy) Access(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry, ok := p.set.items[key]; ok {
+		p.set.touch(entry, lfuPriority)
+	}
+}
+
+// Add adds a new item and returns the keys that should be evicted from the cache storage.
+func (p *LFUEvictionPolicy) Add(key string, size int64) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pins.cache(key, size) {
+		return nil
+	}
+	return p.add(key, size)
+}
+
+func (p *LFUEvictionPolicy) add(key string, size int64) []string {
+	if entry, ok := p.set.items[key]; ok {
+		p.set.touch(entry, lfuPriority)
+		return nil
+	}
+
+	p.set.add(key, size, lfuPriority)
+	return p.set.evictIfNeeded(nil)
+}
+
+// Remove removes an item.
+func (p *LFUEvictionPolicy) Remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pins.uncache(key) {
+		return
+	}
+	p.set.remove(key)
+}
+
+// Pin keeps key out of eviction until it is unpinned. Its count starts over once unpinned.
+func (p *LFUEvictionPolicy) Pin(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.pins.pin(key) {
+		return
+	}
+	if size, ok := p.set.remove(key); ok {
+		p.pins.cache(key, size)
+	}
+}
+
+// Unpin drops a pin and returns the keys that should be evicted from the cache storage.
+func (p *LFUEvictionPolicy) Unpin(key string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	size, ok := p.pins.unpin(key)
+	if !ok {
+		return nil
+	}
+	return p.add(key, size)
+}
+
+// Usage reports the cached size against the limit.
+func (p *LFUEvictionPolicy) Usage() Usage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Usage{
+		Size:       p.set.currentSize,
+		PinnedSize: p.pins.size,
+		MaxSize:    p.set.maxSizeBytes,
+	}
+}
+
+// Pinned reports whether key is pinned.
+func (p *LFUEvictionPolicy) Pinned(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pins.has(key)
+}
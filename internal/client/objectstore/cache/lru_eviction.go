@@ -12,7 +12,7 @@ type lruEntry struct {
 }
 
 // LRUEvictionPolicy is an in-memory LRU implementation that tracks cache usage
-// and total size, backed by template metadata stored in the database.
+// and total size. CacheClient rebuilds it at boot from its Index.
 type LRUEvictionPolicy struct {
 	mu sync.Mutex
 
@@ -23,16 +23,18 @@ type LRUEvictionPolicy struct {
 	items map[string]*list.Element
 	// order keeps items ordered by recency (front = most recently used).
 	order *list.List
+
+	pins pinSet
 }
 
-// NewLRUEvictionPolicy creates a new LRU eviction policy implementation that
-// uses the provided storage to look up object metadata (e.g. file size) in the
-// database. maxSizeBytes is the soft limit for total cached size.
+// NewLRUEvictionPolicy creates a new LRU eviction policy implementation.
+// maxSizeBytes is the soft limit for total cached size.
 func NewLRUEvictionPolicy(maxSizeBytes int64) EvictionPolicy {
 	return &LRUEvictionPolicy{
 		maxSizeBytes: maxSizeBytes,
 		items:        make(map[string]*list.Element),
 		order:        list.New(),
+		pins:         newPinSet(),
 	}
 }
 
@@ -51,6 +53,13 @@ func (p *LRUEvictionPolicy) Add(key string, size int64) []string {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if p.pins.cache(key, size) {
+		return nil
+	}
+	return p.add(key, size)
+}
+
+func (p *LRUEvictionPolicy) add(key string, size int64) []string {
 	// If the key already exists, treat as access.
 	if elem, ok := p.items[key]; ok {
 		p.order.MoveToFront(elem)
@@ -68,23 +77,59 @@ func (p *LRUEvictionPolicy) Add(key string, size int64) []string {
 	return p.evictIfNeeded()
 }
 
-// Remove removes an item from the LRU list and returns the keys that should be evicted from the cache storage.
+// Remove removes an item from the LRU list.
 func (p *LRUEvictionPolicy) Remove(key string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if p.pins.uncache(key) {
+		return
+	}
+	p.remove(key)
+}
+
+// remove drops key from the LRU list and returns its size if it was there.
+func (p *LRUEvictionPolicy) remove(key string) (int64, bool) {
 	elem, ok := p.items[key]
 	if !ok {
-		return
+		return 0, false
 	}
 
+	var size int64
 	entry, _ := elem.Value.(*lruEntry)
 	if entry != nil {
-		p.currentSize -= entry.size
+		size = entry.size
+		p.currentSize -= size
 	}
 
 	p.order.Remove(elem)
 	delete(p.items, key)
+	return size, true
+}
+
+// Pin keeps key out of the LRU list until it is unpinned.
+func (p *LRUEvictionPolicy) Pin(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.pins.pin(key) {
+		return
+	}
+	if size, ok := p.remove(key); ok {
+		p.pins.cache(key, size)
+	}
+}
+
+// Unpin drops a pin and returns the keys that should be evicted from the cache storage.
+func (p *LRUEvictionPolicy) Unpin(key string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	size, ok := p.pins.unpin(key)
+	if !ok {
+		return nil
+	}
+	return p.add(key, size)
 }
 
 // evictIfNeeded trims the LRU list so that total size stays within maxSizeBytes.
@@ -117,3 +162,23 @@ func (p *LRUEvictionPolicy) evictIfNeeded() []string {
 
 	return evicted
 }
+
+// Usage reports the cached size against the limit.
+func (p *LRUEvictionPolicy) Usage() Usage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Usage{
+		Size:       p.currentSize,
+		PinnedSize: p.pins.size,
+		MaxSize:    p.maxSizeBytes,
+	}
+}
+
+// Pinned reports whether key is pinned.
+func (p *LRUEvictionPolicy) Pinned(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pins.has(key)
+}
@@ -0,0 +1,84 @@
+package cache
+
+// pin is a pinned key. It may be pinned before it is cached.
+type pin struct {
+	count  int
+	size   int64
+	cached bool
+}
+
+// pinSet holds the pinned keys of a policy. Pinned items are taken out of the
+// policy's own structures, so they are never eviction candidates and don't
+// count toward its size limit.
+type pinSet struct {
+	pins map[string]*pin
+	// size is the total size of the pinned items that are cached
+	size int64
+}
+
+func newPinSet() pinSet {
+	return pinSet{pins: make(map[string]*pin)}
+}
+
+func (s *pinSet) has(key string) bool {
+	_, ok := s.pins[key]
+	return ok
+}
+
+// pin counts a pin on key and reports whether it is the first one.
+func (s *pinSet) pin(key string) bool {
+	if p, ok := s.pins[key]; ok {
+		p.count++
+		return false
+	}
+	s.pins[key] = &pin{count: 1}
+	return true
+}
+
+// unpin drops a pin on key. After the last one, a cached item is returned
+// with its size to be handed back to the policy.
+func (s *pinSet) unpin(key string) (int64, bool) {
+	p, ok := s.pins[key]
+	if !ok {
+		return 0, false
+	}
+	p.count--
+	if p.count > 0 {
+		return 0, false
+	}
+
+	delete(s.pins, key)
+	if !p.cached {
+		return 0, false
+	}
+	s.size -= p.size
+	return p.size, true
+}
+
+// cache records that a pinned key is cached, it reports whether key is pinned.
+func (s *pinSet) cache(key string, size int64) bool {
+	p, ok := s.pins[key]
+	if !ok {
+		return false
+	}
+	if p.cached {
+		s.size -= p.size
+	}
+	p.size = size
+	p.cached = true
+	s.size += size
+	return true
+}
+
+// uncache records that a pinned key left the cache, it reports whether key is pinned.
+func (s *pinSet) uncache(key string) bool {
+	p, ok := s.pins[key]
+	if !ok {
+		return false
+	}
+	if p.cached {
+		s.size -= p.size
+		p.cached = false
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Pin keeps key in the cache until it is unpinned. It doesn't fetch it, see Warm.
+func (c *CacheClient) Pin(key string) {
+	c.evictionPolicy.Pin(key)
+}
+
+// Unpin makes key evictable again, which may evict other entries right away.
+func (c *CacheClient) Unpin(ctx context.Context, key string) {
+	for _, evictKey := range c.evictionPolicy.Unpin(key) {
+		c.evict(ctx, evictKey)
+	}
+}
+
+// Warm fetches key from primary into the cache unless it is cached already,
+// and returns once the object has been read.
+func (c *CacheClient) Warm(ctx context.Context, key string) error {
+	if _, err := c.cache.Stat(ctx, key); err == nil {
+		return nil
+	}
+
+	reader, err := c.joinFill(key).reader(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return fmt.Errorf("warm %s: %w", key, err)
+	}
+	return nil
+}
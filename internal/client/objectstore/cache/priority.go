@@ -0,0 +1,115 @@
+package cache
+
+import "container/heap"
+
+// priorityEntry is a cached item ranked by a priority, lowest evicted first.
+type priorityEntry struct {
+	key      string
+	size     int64
+	freq     int64
+	priority float64
+	// tick orders entries of equal priority, older first
+	tick  uint64
+	index int
+}
+
+// priorityQueue is a min-heap of entries, shared by the frequency based policies.
+type priorityQueue []*priorityEntry
+
+func (q priorityQueue) Len() int { return len(q) }
+
+func (q priorityQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority < q[j].priority
+	}
+	return q[i].tick < q[j].tick
+}
+
+func (q priorityQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *priorityQueue) Push(x any) {
+	entry := x.(*priorityEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *priorityQueue) Pop() any {
+	old := *q
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*q = old[:n-1]
+	return entry
+}
+
+// prioritySet tracks entries by key in a priorityQueue, within a byte budget.
+type prioritySet struct {
+	maxSizeBytes int64
+	currentSize  int64
+
+	items map[string]*priorityEntry
+	queue priorityQueue
+	ticks uint64
+}
+
+func newPrioritySet(maxSizeBytes int64) prioritySet {
+	return prioritySet{
+		maxSizeBytes: maxSizeBytes,
+		items:        make(map[string]*priorityEntry),
+	}
+}
+
+// touch counts an access to entry and reranks it with priority.
+func (s *prioritySet) touch(entry *priorityEntry, priority func(*priorityEntry) float64) {
+	s.ticks++
+	entry.freq++
+	entry.tick = s.ticks
+	entry.priority = priority(entry)
+	heap.Fix(&s.queue, entry.index)
+}
+
+func (s *prioritySet) add(key string, size int64, priority func(*priorityEntry) float64) {
+	s.ticks++
+	entry := &priorityEntry{key: key, size: size, freq: 1, tick: s.ticks}
+	entry.priority = priority(entry)
+	heap.Push(&s.queue, entry)
+	s.items[key] = entry
+	s.currentSize += size
+}
+
+// remove drops key and returns its size if it was there.
+func (s *prioritySet) remove(key string) (int64, bool) {
+	entry, ok := s.items[key]
+	if !ok {
+		return 0, false
+	}
+	heap.Remove(&s.queue, entry.index)
+	delete(s.items, key)
+	s.currentSize -= entry.size
+	return entry.size, true
+}
+
+// evictIfNeeded pops the lowest priority entries until the set fits its
+// budget. onEvict sees each entry as it goes.
+func (s *prioritySet) evictIfNeeded(onEvict func(*priorityEntry)) []string {
+	if s.maxSizeBytes <= 0 {
+		return nil
+	}
+
+	var evicted []string
+	for s.currentSize > s.maxSizeBytes && s.queue.Len() > 0 {
+		entry := heap.Pop(&s.queue).(*priorityEntry)
+		delete(s.items, entry.key)
+		s.currentSize -= entry.size
+		if onEvict != nil {
+			onEvict(entry)
+		}
+		evicted = append(evicted, entry.key)
+	}
+	return evicted
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+)
+
+// ErrPinned is returned when evicting a pinned object, including one still
+// waiting to be written back.
+var ErrPinned = errors.New("object is pinned")
+
+// counters are the cache activity since start.
+type counters struct {
+	hits             atomic.Int64
+	misses           atomic.Int64
+	bytesFromCache   atomic.Int64
+	bytesFromPrimary atomic.Int64
+	evictions        atomic.Int64
+}
+
+// Stats is a snapshot of the cache activity since start and of its size.
+type Stats struct {
+	Hits   int64
+	Misses int64
+	// BytesFromCache and BytesFromPrimary count the bytes read by clients,
+	// not those fetched to fill the cache.
+	BytesFromCache   int64
+	BytesFromPrimary int64
+	// Evictions counts the objects dropped by the eviction policy.
+	Evictions int64
+	Usage     Usage
+	// PendingWriteBack is the number of objects not in primary yet.
+	PendingWriteBack int
+}
+
+// Stats returns the cache counters and usage.
+func (c *CacheClient) Stats() Stats {
+	stats := Stats{
+		Hits:             c.counters.hits.Load(),
+		Misses:           c.counters.misses.Load(),
+		BytesFromCache:   c.counters.bytesFromCache.Load(),
+		BytesFromPrimary: c.counters.bytesFromPrimary.Load(),
+		Evictions:        c.counters.evictions.Load(),
+		Usage:            c.evictionPolicy.Usage(),
+	}
+	if c.writeBack != nil {
+		c.writeBack.mu.Lock()
+		stats.PendingWriteBack = len(c.writeBack.pending)
+		c.writeBack.mu.Unlock()
+	}
+	return stats
+}
+
+// countingReader adds the bytes read through it to a counter.
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// Entry is a cached object.
+type Entry struct {
+	Key        string
+	Size       int64
+	AccessedAt time.Time
+	Pinned     bool
+}
+
+// Entries lists the cached objects, most recently used first. Without an
+// index the access time is the time the object was cached.
+func (c *CacheClient) Entries(ctx context.Context) ([]Entry, error) {
+	var entries []Entry
+	if c.index != nil {
+		recorded, err := c.index.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list index: %w", err)
+		}
+		for _, entry := range recorded {
+			entries = append(entries, Entry{Key: entry.Key, Size: entry.Size, AccessedAt: entry.AccessedAt})
+		}
+	} else {
+		it := c.cache.List(ctx, "")
+		for it.Next() {
+			info := it.Item()
+			entries = append(entries, Entry{Key: info.Key, Size: info.Size, AccessedAt: info.ModTime})
+		}
+		if err := it.Err(); err != nil {
+			return nil, fmt.Errorf("list cache: %w", err)
+		}
+	}
+
+	for i := range entries {
+		entries[i].Pinned = c.evictionPolicy.Pinned(entries[i].Key)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].AccessedAt.After(entries[j].AccessedAt)
+	})
+	return entries, nil
+}
+
+// RecentEntries lists limit cached objects from offset, most recently used
+// first. The index pages through its entries, without one the whole cache is
+// listed and sorted.
+func (c *CacheClient) RecentEntries(ctx context.Context, limit, offset int) ([]Entry, error) {
+	if c.index == nil {
+		entries, err := c.Entries(ctx)
+		if err != nil {
+			return nil, err
+		}
+		offset = min(offset, len(entries))
+		return entries[offset:min(offset+limit, len(entries))], nil
+	}
+
+	// Order by the latest hits
+	c.flushTouches(ctx)
+
+	recorded, err := c.index.ListRecent(ctx, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("list index: %w", err)
+	}
+	entries := make([]Entry, len(recorded))
+	for i, entry := range recorded {
+		entries[i] = Entry{
+			Key:        entry.Key,
+			Size:       entry.Size,
+			AccessedAt: entry.AccessedAt,
+			Pinned:     c.evictionPolicy.Pinned(entry.Key),
+		}
+	}
+	return entries, nil
+}
+
+// Evict drops key from the cache. Pinned objects are refused with ErrPinned,
+// and a key that isn't cached fails with an error wrapping objectstore.ErrNotFound.
+func (c *CacheClient) Evict(ctx context.Context, key string) error {
+	if c.evictionPolicy.Pinned(key) {
+		return fmt.Errorf("evict %s: %w", key, ErrPinned)
+	}
+	if _, err := c.cache.Stat(ctx, key); err != nil {
+		return fmt.Errorf("evict %s: %w", key, err)
+	}
+
+	if err := c.cache.Delete(ctx, key); err != nil {
+		return fmt.Errorf("delete from cache: %w", err)
+	}
+	c.evictionPolicy.Remove(key)
+	c.forget(ctx, key)
+	return nil
+}
+
+// Purge drops every object that isn't pinned from the cache and returns how
+// many were dropped.
+func (c *CacheClient) Purge(ctx context.Context) (int, error) {
+	entries, err := c.Entries(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	var errs []error
+	for _, entry := range entries {
+		if entry.Pinned {
+			continue
+		}
+		if err := c.Evict(ctx, entry.Key); err != nil {
+			// Gone already, such as evicted since it was listed
+			if errors.Is(err, objectstore.ErrNotFound) {
+				continue
+			}
+			errs = append(errs, err)
+			continue
+		}
+		purged++
+	}
+
+	slog.Info("cache purged", "entries", purged, "failed", len(errs))
+	return purged, errors.Join(errs...)
+}
@@ -0,0 +1,269 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+	"sync"
+)
+
+const (
+	// sketchWidth is the number of counters per row of the frequency sketch
+	sketchWidth = 1 << 16
+	sketchDepth = 4
+	// sketchSample is the number of increments after which all counts are halved
+	sketchSample   = 10 * sketchWidth
+	sketchMaxCount = 15
+)
+
+// frequencySketch is a count-min sketch of recent access frequencies. Counts
+// are halved every sketchSample increments, so old popularity fades.
+type frequencySketch struct {
+	seed      maphash.Seed
+	counters  [sketchDepth][sketchWidth]uint8
+	additions int
+}
+
+func (s *frequencySketch) indexes(key string) [sketchDepth]uint32 {
+	h := maphash.String(s.seed, key)
+	h1, h2 := uint32(h), uint32(h>>32)
+	var idx [sketchDepth]uint32
+	for i := range idx {
+		idx[i] = (h1 + uint32(i)*h2) & (sketchWidth - 1)
+	}
+	return idx
+}
+
+func (s *frequencySketch) increment(key string) {
+	for row, i := range s.indexes(key) {
+		if s.counters[row][i] < sketchMaxCount {
+			s.counters[row][i]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= sketchSample {
+		for row := range s.counters {
+			for i := range s.counters[row] {
+				s.counters[row][i] /= 2
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *frequencySketch) estimate(key string) uint8 {
+	est := uint8(sketchMaxCount)
+	for row, i := range s.indexes(key) {
+		est = min(est, s.counters[row][i])
+	}
+	return est
+}
+
+// tinyLFUSegment is one LRU segment of the W-TinyLFU policy.
+type tinyLFUSegment struct {
+	order    *list.List
+	size     int64
+	capacity int64
+}
+
+type tinyLFUEntry struct {
+	key  string
+	size int64
+	in   *tinyLFUSegment
+}
+
+// TinyLFUEvictionPolicy implements W-TinyLFU (Einziger et al., 2017), sized in
+// bytes. New items enter a small LRU window. Items leaving the window only get
+// into the main cache if the frequency sketch says they are used more often
+// than the main cache's eviction victim, so a large one-off pull can't flush
+// items that are pulled constantly. The main cache is a segmented LRU: items
+// used again in probation are promoted to protected.
+type TinyLFUEvictionPolicy struct {
+	mu sync.Mutex
+
+	sketch frequencySketch
+
+	window, probation, protected tinyLFUSegment
+	items                        map[string]*list.Element
+
+	pins pinSet
+}
+
+// NewTinyLFUEvictionPolicy creates a new W-TinyLFU eviction policy.
+// maxSizeBytes is the soft limit for total cached size, 1% of which is the
+// window and 80% of the rest the protected segment.
+func NewTinyLFUEvictionPolicy(maxSizeBytes int64) EvictionPolicy {
+	window := maxSizeBytes / 100
+	main := maxSizeBytes - window
+	protected := main * 8 / 10
+
+	return &TinyLFUEvictionPolicy{
+		sketch:    frequencySketch{seed: maphash.MakeSeed()},
+		window:    tinyLFUSegment{order: list.New(), capacity: window},
+		probation: tinyLFUSegment{order: list.New(), capacity: main - protected},
+		protected: tinyLFUSegment{order: list.New(), capacity: protected},
+		items:     make(map[string]*list.Element),
+		pins:      newPinSet(),
+	}
+}
+
+func (p *TinyLFUEvictionPolicy) push(seg *tinyLFUSegment, entry *tinyLFUEntry) {
+	entry.in = seg
+	p.items[entry.key] = seg.order.PushFront(entry)
+	seg.size += entry.size
+}
+
+func (p *TinyLFUEvictionPolicy) unlink(elem *list.Element) *tinyLFUEntry {
+	entry := elem.Value.(*tinyLFUEntry)
+	entry.in.order.Remove(elem)
+	entry.in.size -= entry.size
+	delete(p.items, entry.key)
+	return entry
+}
+
+// Access counts a use of key and promotes it within its segment.
+func (p *TinyLFUEvictionPolicy) Access(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sketch.increment(key)
+	if elem, ok := p.items[key]; ok {
+		p.promote(elem)
+	}
+}
+
+func (p *TinyLFUEvictionPolicy) promote(elem *list.Element) {
+	entry := elem.Value.(*tinyLFUEntry)
+	if entry.in != &p.probation {
+		entry.in.order.MoveToFront(elem)
+		return
+	}
+
+	p.unlink(elem)
+	p.push(&p.protected, entry)
+	// Demote the protected overflow back to probation
+	for p.protected.size > p.protected.capacity && p.protected.order.Len() > 1 {
+		p.push(&p.probation, p.unlink(p.protected.order.Back()))
+	}
+}
+
+// Add adds a new item and returns the keys that should be evicted from the cache storage.
+func (p *TinyLFUEvictionPolicy) Add(key string, size int64) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sketch.increment(key)
+	if p.pins.cache(key, size) {
+		return nil
+	}
+	if elem, ok := p.items[key]; ok {
+		p.promote(elem)
+		return nil
+	}
+	return p.add(key, size)
+}
+
+func (p *TinyLFUEvictionPolicy) add(key string, size int64) []string {
+	p.push(&p.window, &tinyLFUEntry{key: key, size: size})
+	if p.window.capacity+p.probation.capacity+p.protected.capacity <= 0 {
+		return nil
+	}
+
+	var evicted []string
+	for p.window.size > p.window.capacity && p.window.order.Len() > 0 {
+		candidate := p.unlink(p.window.order.Back())
+		evicted = append(evicted, p.admit(candidate)...)
+	}
+	return evicted
+}
+
+// admit moves candidate from the window into the main cache if it is worth
+// more than the items it would displace, and returns what was evicted.
+func (p *TinyLFUEvictionPolicy) admit(candidate *tinyLFUEntry) []string {
+	capacity := p.probation.capacity + p.protected.capacity
+	if candidate.size > capacity {
+		return []string{candidate.key}
+	}
+
+	// Pick the victims first, so a rejected candidate leaves the main cache untouched
+	var victims []*list.Element
+	freed := int64(0)
+	for _, seg := range []*tinyLFUSegment{&p.probation, &p.protected} {
+		for elem := seg.order.Back(); elem != nil; elem = elem.Prev() {
+			if p.probation.size+p.protected.size-freed+candidate.size <= capacity {
+				break
+			}
+			victim := elem.Value.(*tinyLFUEntry)
+			if p.sketch.estimate(candidate.key) <= p.sketch.estimate(victim.key) {
+				return []string{candidate.key}
+			}
+			victims = append(victims, elem)
+			freed += victim.size
+		}
+	}
+
+	evicted := make([]string, 0, len(victims))
+	for _, elem := range victims {
+		evicted = append(evicted, p.unlink(elem).key)
+	}
+	p.push(&p.probation, candidate)
+	return evicted
+}
+
+// Remove removes an item.
+func (p *TinyLFUEvictionPolicy) Remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pins.uncache(key) {
+		return
+	}
+	if elem, ok := p.items[key]; ok {
+		p.unlink(elem)
+	}
+}
+
+// Pin keeps key out of the segments until it is unpinned. The sketch keeps counting its uses.
+func (p *TinyLFUEvictionPolicy) Pin(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.pins.pin(key) {
+		return
+	}
+	if elem, ok := p.items[key]; ok {
+		p.pins.cache(key, p.unlink(elem).size)
+	}
+}
+
+// Unpin drops a pin and returns the keys that should be evicted from the cache storage.
+func (p *TinyLFUEvictionPolicy) Unpin(key string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	size, ok := p.pins.unpin(key)
+	if !ok {
+		return nil
+	}
+	return p.add(key, size)
+}
+
+// Usage reports the cached size against the limit.
+func (p *TinyLFUEvictionPolicy) Usage() Usage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Usage{
+		Size:       p.window.size + p.probation.size + p.protected.size,
+		PinnedSize: p.pins.size,
+		MaxSize:    p.window.capacity + p.probation.capacity + p.protected.capacity,
+	}
+}
+
+// Pinned reports whether key is pinned.
+func (p *TinyLFUEvictionPolicy) Pinned(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pins.has(key)
+}
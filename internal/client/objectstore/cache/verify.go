@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoDigest is returned by Digests.Get when nothing is known about a key.
+var ErrNoDigest = errors.New("no digest")
+
+// Digest is what an object holds as stored, after any compression or
+// encryption above the cache. Hash is the BLAKE3 hex digest, empty when only
+// the size is known.
+type Digest struct {
+	Size int64
+	Hash string
+}
+
+// Digests records the digest of every object written through the cache, so a
+// fill from primary is only committed when it is complete and intact.
+type Digests interface {
+	// Get returns the digest of key, or ErrNoDigest.
+	Get(ctx context.Context, key string) (Digest, error)
+	// Put records the digest of key.
+	Put(ctx context.Context, key string, digest Digest) error
+	// Delete forgets key.
+	Delete(ctx context.Context, key string) error
+}
+
+// verify checks a fill of key that read size bytes hashing to hash.
+func (c *CacheClient) verify(ctx context.Context, key string, size int64, hash string) error {
+	if c.digests == nil {
+		return nil
+	}
+
+	want, err := c.digests.Get(ctx, key)
+	if errors.Is(err, ErrNoDigest) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get digest of %s: %w", key, err)
+	}
+
+	if size != want.Size {
+		return fmt.Errorf("%s from primary has %d bytes, expected %d", key, size, want.Size)
+	}
+	if want.Hash != "" && hash != want.Hash {
+		return fmt.Errorf("%s from primary has hash %s, expected %s", key, hash, want.Hash)
+	}
+	return nil
+}
+
+// recordDigest saves the digest of an object written through the cache.
+func (c *CacheClient) recordDigest(ctx context.Context, key string, digest Digest) error {
+	if c.digests == nil {
+		return nil
+	}
+	if err := c.digests.Put(ctx, key, digest); err != nil {
+		return fmt.Errorf("record digest of %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/utils/blake3"
+	"github.com/beanbocchi/templar/internal/utils/ioutil"
+)
+
+// writeBackPoll is how often due retries are picked up when nothing new was written.
+const writeBackPoll = time.Second
+
+// WriteBackEntry is an object in the cache that isn't in primary yet.
+type WriteBackEntry struct {
+	Key      string
+	Attempts int64
+}
+
+// WriteBackLog persists the objects waiting to be written back, so an
+// acknowledged upload still reaches primary after a restart.
+type WriteBackLog interface {
+	List(ctx context.Context) ([]WriteBackEntry, error)
+	Put(ctx context.Context, key string) error
+	// Fail records a failed attempt.
+	Fail(ctx context.Context, key string, err error) error
+	Delete(ctx context.Context, key string) error
+}
+
+// WriteBackConfig turns on write-back: uploads are acknowledged once they are
+// in the cache and written to primary in the background. The cache tier must
+// have the object on disk when its Upload returns, a local client with Fsync.
+type WriteBackConfig struct {
+	Log WriteBackLog
+	// Concurrency is the number of objects written to primary at once.
+	Concurrency int
+	// BaseDelay is the delay before retrying a failed write, doubled on each
+	// attempt up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// pendingWrite is the retry state of an object waiting to be written back.
+type pendingWrite struct {
+	attempts int64
+	next     time.Time
+	running  bool
+	// uploading counts uploads of the key still writing the cached copy,
+	// which is only written back once they are done.
+	uploading int
+}
+
+// writeBack tracks the objects waiting to be written to primary. Each one is
+// pinned in the eviction policy until it is.
+type writeBack struct {
+	cfg  WriteBackConfig
+	wake chan struct{}
+
+	mu       sync.Mutex
+	pending  map[string]*pendingWrite
+	inflight int
+}
+
+func newWriteBack(cfg WriteBackConfig) *writeBack {
+	return &writeBack{
+		cfg:     cfg,
+		wake:    make(chan struct{}, 1),
+		pending: make(map[string]*pendingWrite),
+	}
+}
+
+func (w *writeBack) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// backoff returns the delay before the next attempt after attempts failures.
+func (w *writeBack) backoff(attempts int64) time.Duration {
+	delay := w.cfg.BaseDelay
+	for i := int64(1); i < attempts && delay < w.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, w.cfg.MaxDelay)
+}
+
+// restoreWriteBack pins the objects a previous run left waiting, before the
+// index is restored so none is evicted at boot.
+func (c *CacheClient) restoreWriteBack(ctx context.Context) error {
+	entries, err := c.writeBack.cfg.Log.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		c.writeBack.pending[entry.Key] = &pendingWrite{attempts: entry.Attempts}
+		c.evictionPolicy.Pin(entry.Key)
+	}
+	if len(entries) > 0 {
+		slog.Info("resuming cache write-back", "objects", len(entries))
+	}
+	return nil
+}
+
+// uploadWriteBack stores content in the cache only and queues it for primary.
+func (c *CacheClient) uploadWriteBack(ctx context.Context, key string, content io.Reader) error {
+	w := c.writeBack
+
+	// Pin first, the object must never count toward eviction while it only
+	// lives in the cache
+	w.mu.Lock()
+	p, queued := w.pending[key]
+	if !queued {
+		p = &pendingWrite{}
+		w.pending[key] = p
+		c.evictionPolicy.Pin(key)
+	}
+	p.uploading++
+	w.mu.Unlock()
+
+	sizeReader := ioutil.NewSizeReader(content)
+	hasher := blake3.New()
+	err := c.cacheUpload(ctx, key, io.TeeReader(sizeReader, hasher))
+
+	w.mu.Lock()
+	p.uploading--
+	w.mu.Unlock()
+
+	if err != nil {
+		if !queued {
+			c.dropWriteBack(ctx, key)
+		}
+		return err
+	}
+
+	// The cache tier synced the object to disk, it can be recorded and acked
+	if err := w.cfg.Log.Put(ctx, key); err != nil {
+		// Without a record the object could be lost on restart, write it
+		// through instead
+		slog.Warn("failed to record write-back, writing through", "key", key, "error", err)
+		if err := c.copyToPrimary(ctx, key); err != nil {
+			return err
+		}
+		c.dropWriteBack(ctx, key)
+	}
+
+	if err := c.recordDigest(ctx, key, Digest{Size: sizeReader.Size, Hash: hasher.Sum()}); err != nil {
+		slog.Warn("failed to record digest", "key", key, "error", err)
+	}
+
+	w.signal()
+	return nil
+}
+
+// dropWriteBack stops tracking key and lets it be evicted. It reports whether
+// key was waiting to be written back.
+func (c *CacheClient) dropWriteBack(ctx context.Context, key string) bool {
+	w := c.writeBack
+	w.mu.Lock()
+	_, ok := w.pending[key]
+	delete(w.pending, key)
+	w.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	if err := w.cfg.Log.Delete(ctx, key); err != nil {
+		slog.Warn("failed to delete write-back record", "key", key, "error", err)
+	}
+	for _, evictKey := range c.evictionPolicy.Unpin(key) {
+		c.evict(ctx, evictKey)
+	}
+	return true
+}
+
+// copyToPrimary uploads the cached copy of key to primary.
+func (c *CacheClient) copyToPrimary(ctx context.Context, key string) error {
+	reader, err := c.cache.Download(ctx, key)
+	if err != nil {
+		return fmt.Errorf("get from cache: %w", err)
+	}
+	defer reader.Close()
+
+	if err := c.primary.Upload(ctx, key, reader); err != nil {
+		return fmt.Errorf("upload to primary: %w", err)
+	}
+	return nil
+}
+
+// runWriteBack writes queued objects to primary, retrying failures with backoff.
+func (c *CacheClient) runWriteBack() {
+	w := c.writeBack
+	ticker := time.NewTicker(writeBackPoll)
+	defer ticker.Stop()
+
+	for {
+		w.mu.Lock()
+		now := time.Now()
+		for key, p := range w.pending {
+			if w.inflight >= w.cfg.Concurrency {
+				break
+			}
+			if p.running || p.uploading > 0 || now.Before(p.next) {
+				continue
+			}
+			p.running = true
+			w.inflight++
+			go c.writeBackObject(key)
+		}
+		w.mu.Unlock()
+
+		select {
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeBackObject makes one attempt at writing key to primary.
+func (c *CacheClient) writeBackObject(key string) {
+	ctx := context.Background()
+	w := c.writeBack
+	defer w.signal()
+
+	err := c.copyToPrimary(ctx, key)
+
+	w.mu.Lock()
+	w.inflight--
+	p, ok := w.pending[key]
+	if !ok {
+		w.mu.Unlock()
+		// Deleted while it was being written, don't leave it behind
+		if err == nil {
+			if err := c.primary.Delete(ctx, key); err != nil {
+				slog.Warn("failed to delete object written back after its deletion", "key", key, "error", err)
+			}
+		}
+		return
+	}
+	if err == nil {
+		w.mu.Unlock()
+		c.dropWriteBack(ctx, key)
+		slog.Debug("object written back", "key", key)
+		return
+	}
+	p.running = false
+	p.attempts++
+	p.next = time.Now().Add(w.backoff(p.attempts))
+	attempts := p.attempts
+	w.mu.Unlock()
+
+	// Nothing left to write if the cached copy is gone
+	if _, statErr := c.cache.Stat(ctx, key); errors.Is(statErr, objectstore.ErrNotFound) {
+		slog.Error("object lost before it was written back", "key", key, "error", err)
+		c.dropWriteBack(ctx, key)
+		return
+	}
+
+	slog.Warn("failed to write back", "key", key, "attempts", attempts, "error", err)
+	if err := w.cfg.Log.Fail(ctx, key, err); err != nil {
+		slog.Warn("failed to record write-back failure", "key", key, "error", err)
+	}
+}
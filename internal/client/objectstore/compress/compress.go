@@ -0,0 +1,196 @@
+package compress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/utils/ioutil"
+)
+
+// CompressConfig configures the compressing objectstore wrapper.
+type CompressConfig struct {
+	// Client is the underlying objectstore client to store compressed content in.
+	Client objectstore.Client
+	// Level is the zstd compression level, 1 (fastest) to 22 (smallest).
+	Level int
+}
+
+// CompressClient wraps an objectstore client with zstd compression. Content is
+// compressed on Upload and UploadPart and decompressed on Download. Parts are
+// compressed independently, a multipart object is a sequence of zstd frames,
+// which decodes as one stream.
+//
+// Every object read through it must have been written through it, the caller
+// records which objects are compressed and picks the client accordingly.
+//
+// Sizes reported by Stat and List are stored (compressed) sizes.
+type CompressClient struct {
+	client objectstore.Client
+	level  zstd.EncoderLevel
+}
+
+// NewCompressClient creates a new compressing objectstore client wrapper.
+func NewCompressClient(cfg CompressConfig) (*CompressClient, error) {
+	if cfg.Client == nil {
+		return nil, fmt.Errorf("client is required")
+	}
+	if cfg.Level < 1 || cfg.Level > 22 {
+		return nil, fmt.Errorf("compression level must be between 1 and 22, got %d", cfg.Level)
+	}
+
+	return &CompressClient{
+		client: cfg.Client,
+		level:  zstd.EncoderLevelFromZstd(cfg.Level),
+	}, nil
+}
+
+// compress returns a reader of the compressed content. Closing it stops the encoder.
+func (c *CompressClient) compress(content io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		encoder, err := zstd.NewWriter(pw, zstd.WithEncoderLevel(c.level), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("create encoder: %w", err))
+			return
+		}
+		if _, err := io.Copy(encoder, content); err != nil {
+			encoder.Close()
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(encoder.Close())
+	}()
+
+	return pr
+}
+
+// decompress wraps a stored object with a zstd decoder.
+func decompress(body io.ReadCloser) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("create decoder: %w", err)
+	}
+
+	return &decompressReader{decoder: decoder, body: body}, nil
+}
+
+type decompressReader struct {
+	decoder *zstd.Decoder
+	body    io.ReadCloser
+}
+
+func (r *decompressReader) Read(p []byte) (int, error) {
+	return r.decoder.Read(p)
+}
+
+func (r *decompressReader) Close() error {
+	r.decoder.Close()
+	return r.body.Close()
+}
+
+// CreateMultipart starts a multipart upload on the wrapped client.
+func (c *CompressClient) CreateMultipart(ctx context.Context, key string) (string, error) {
+	return c.client.CreateMultipart(ctx, key)
+}
+
+// UploadPart compresses a single part and uploads it.
+func (c *CompressClient) UploadPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	content io.Reader,
+) error {
+	compressed := c.compress(content)
+	defer compressed.Close()
+
+	return c.client.UploadPart(ctx, key, uploadID, partNumber, compressed)
+}
+
+// UploadLastPart compresses the last part and uploads it, marked as the last
+// one if the wrapped client marks it.
+func (c *CompressClient) UploadLastPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	content io.Reader,
+) error {
+	compressed := c.compress(content)
+	defer compressed.Close()
+
+	return objectstore.UploadPart(ctx, c.client, key, uploadID, partNumber, compressed, true)
+}
+
+// CompleteMultipart finalizes a multipart upload on the wrapped client.
+func (c *CompressClient) CompleteMultipart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	return c.client.CompleteMultipart(ctx, key, uploadID)
+}
+
+// AbortMultipart cancels a multipart upload on the wrapped client.
+func (c *CompressClient) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	return c.client.AbortMultipart(ctx, key, uploadID)
+}
+
+// Upload compresses content and uploads it.
+func (c *CompressClient) Upload(ctx context.Context, key string, content io.Reader) error {
+	compressed := c.compress(content)
+	defer compressed.Close()
+
+	return c.client.Upload(ctx, key, compressed)
+}
+
+// Download downloads and decompresses an object.
+func (c *CompressClient) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, err := c.client.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(body)
+}
+
+// DownloadRange serves a range of the decompressed content. zstd streams can't
+// be seeked, so the object is decoded from the start and the bytes before
+// offset are discarded.
+func (c *CompressClient) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := objectstore.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+
+	body, err := c.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, body, offset); err != nil && !errors.Is(err, io.EOF) {
+		body.Close()
+		return nil, fmt.Errorf("skip to offset: %w", err)
+	}
+
+	return ioutil.NewLimitedReadCloser(body, length), nil
+}
+
+// Delete deletes an object from the wrapped client.
+func (c *CompressClient) Delete(ctx context.Context, key string) error {
+	return c.client.Delete(ctx, key)
+}
+
+// Stat returns the object metadata, Size is the stored (compressed) size.
+func (c *CompressClient) Stat(ctx context.Context, key string) (objectstore.ObjectInfo, error) {
+	return c.client.Stat(ctx, key)
+}
+
+// List lists objects on the wrapped client, sizes are stored (compressed) sizes.
+func (c *CompressClient) List(ctx context.Context, prefix string) objectstore.ObjectIterator {
+	return c.client.List(ctx, prefix)
+}
@@ -0,0 +1,272 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/utils/ioutil"
+)
+
+// EncryptConfig configures the encrypting objectstore wrapper.
+type EncryptConfig struct {
+	// Client is the underlying objectstore client to store ciphertext in.
+	Client objectstore.Client
+	// Keyring holds the master keys, new objects use the current one.
+	Keyring *Keyring
+	// Cipher seals new objects. Existing objects record their own cipher.
+	Cipher Cipher
+	// AllowPlaintext reads objects that aren't encrypted as is, while a store
+	// written before encryption was enabled is migrated. Otherwise they fail
+	// with ErrCorrupt, so stored ciphertext can't be swapped for plaintext.
+	AllowPlaintext bool
+}
+
+// EncryptClient wraps an objectstore client with authenticated encryption.
+// Content is encrypted in 64 KiB segments on Upload and UploadPart, and
+// decrypted on Download, so nothing is buffered whole. Each object records
+// the ID of the key it was encrypted with, see Keyring for rotation. Parts
+// of a multipart upload are encrypted as separate streams, numbered, and the
+// last one is marked by UploadLastPart.
+//
+// Sizes reported by Stat and List are stored (ciphertext) sizes.
+type EncryptClient struct {
+	client         objectstore.Client
+	keyring        *Keyring
+	cipher         Cipher
+	allowPlaintext bool
+}
+
+// NewEncryptClient creates a new encrypting objectstore client wrapper.
+func NewEncryptClient(cfg EncryptConfig) (*EncryptClient, error) {
+	if cfg.Client == nil {
+		return nil, fmt.Errorf("client is required")
+	}
+	if cfg.Keyring == nil {
+		return nil, fmt.Errorf("keyring is required")
+	}
+	if cfg.Cipher != CipherAES256GCM && cfg.Cipher != CipherXChaCha20Poly1305 {
+		return nil, fmt.Errorf("unknown cipher %d", cfg.Cipher)
+	}
+
+	return &EncryptClient{
+		client:         cfg.Client,
+		keyring:        cfg.Keyring,
+		cipher:         cfg.Cipher,
+		allowPlaintext: cfg.AllowPlaintext,
+	}, nil
+}
+
+// encrypt returns a reader of the encrypted content. Closing it stops the encryption.
+func (c *EncryptClient) encrypt(key string, content io.Reader, flags byte, part uint32) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		hdr, err := newHeader(c.cipher, flags, c.keyring.Current(), part)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		aead, err := hdr.aead(c.keyring)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(encryptStream(pw, content, key, hdr, aead))
+	}()
+
+	return pr
+}
+
+// decrypt wraps a stored object, decrypting it. An object that isn't encrypted
+// is only read as is with allowPlaintext.
+func (c *EncryptClient) decrypt(key string, body io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(body)
+	head, err := buffered.Peek(len(magic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		body.Close()
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	reader := &readCloser{Reader: buffered, Closer: body}
+	if !bytes.Equal(head, magic) {
+		if c.allowPlaintext {
+			return reader, nil
+		}
+		body.Close()
+		return nil, fmt.Errorf("object %s isn't encrypted: %w", key, ErrCorrupt)
+	}
+	return newDecryptReader(reader, key, c.keyring), nil
+}
+
+// readCloser reads from a buffered view of a body and closes the body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// CreateMultipart starts a multipart upload on the wrapped client.
+func (c *EncryptClient) CreateMultipart(ctx context.Context, key string) (string, error) {
+	return c.client.CreateMultipart(ctx, key)
+}
+
+// UploadPart encrypts a single part as its own stream and uploads it. The
+// object must end with a part uploaded by UploadLastPart to be read back.
+func (c *EncryptClient) UploadPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	content io.Reader,
+) error {
+	return c.uploadPart(ctx, key, uploadID, partNumber, content, flagPart)
+}
+
+// UploadLastPart encrypts the part the object ends with and uploads it.
+func (c *EncryptClient) UploadLastPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	content io.Reader,
+) error {
+	return c.uploadPart(ctx, key, uploadID, partNumber, content, flagPart|flagLastPart)
+}
+
+func (c *EncryptClient) uploadPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	content io.Reader,
+	flags byte,
+) error {
+	if partNumber < 1 || partNumber > math.MaxUint32 {
+		return fmt.Errorf("invalid part number %d", partNumber)
+	}
+
+	encrypted := c.encrypt(key, content, flags, uint32(partNumber))
+	defer encrypted.Close()
+
+	return c.client.UploadPart(ctx, key, uploadID, partNumber, encrypted)
+}
+
+// CompleteMultipart finalizes a multipart upload on the wrapped client.
+func (c *EncryptClient) CompleteMultipart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	return c.client.CompleteMultipart(ctx, key, uploadID)
+}
+
+// AbortMultipart cancels a multipart upload on the wrapped client.
+func (c *EncryptClient) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	return c.client.AbortMultipart(ctx, key, uploadID)
+}
+
+// Upload encrypts content and uploads it.
+func (c *EncryptClient) Upload(ctx context.Context, key string, content io.Reader) error {
+	encrypted := c.encrypt(key, content, 0, 0)
+	defer encrypted.Close()
+
+	return c.client.Upload(ctx, key, encrypted)
+}
+
+// Download downloads and decrypts an object.
+func (c *EncryptClient) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, err := c.client.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.decrypt(key, body)
+}
+
+// DownloadRange serves a range of the plaintext. Segments have a fixed size,
+// so only the ciphertext from the segment holding offset is downloaded.
+// Multipart objects are decrypted from the start, as part boundaries aren't
+// known up front.
+func (c *EncryptClient) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := objectstore.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+	if offset == 0 {
+		return c.downloadFrom(ctx, key, 0, length)
+	}
+
+	probe, err := c.client.DownloadRange(ctx, key, 0, maxHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	head, err := io.ReadAll(probe)
+	probe.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	if !bytes.HasPrefix(head, magic) {
+		if c.allowPlaintext {
+			return c.client.DownloadRange(ctx, key, offset, length)
+		}
+		return nil, fmt.Errorf("object %s isn't encrypted: %w", key, ErrCorrupt)
+	}
+	hdr, err := readHeader(bytes.NewReader(head))
+	if err != nil {
+		return nil, err
+	}
+	if hdr.flags&flagPart != 0 {
+		return c.downloadFrom(ctx, key, offset, length)
+	}
+
+	aead, err := hdr.aead(c.keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	segment := offset / segmentSize
+	body, err := c.client.DownloadRange(ctx, key, int64(len(hdr.raw))+segment*stride, -1)
+	if err != nil {
+		return nil, err
+	}
+	reader := newDecryptReader(body, key, c.keyring)
+	reader.resume(aead, hdr, uint32(segment))
+
+	return skip(reader, offset-segment*segmentSize, length)
+}
+
+// downloadFrom decrypts the object from the start, discarding the bytes before offset.
+func (c *EncryptClient) downloadFrom(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	body, err := c.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return skip(body, offset, length)
+}
+
+func skip(body io.ReadCloser, n, length int64) (io.ReadCloser, error) {
+	if _, err := io.CopyN(io.Discard, body, n); err != nil && !errors.Is(err, io.EOF) {
+		body.Close()
+		return nil, fmt.Errorf("skip to offset: %w", err)
+	}
+	return ioutil.NewLimitedReadCloser(body, length), nil
+}
+
+// Delete deletes an object from the wrapped client.
+func (c *EncryptClient) Delete(ctx context.Context, key string) error {
+	return c.client.Delete(ctx, key)
+}
+
+// Stat returns the object metadata, Size is the stored (ciphertext) size.
+func (c *EncryptClient) Stat(ctx context.Context, key string) (objectstore.ObjectInfo, error) {
+	return c.client.Stat(ctx, key)
+}
+
+// List lists objects on the wrapped client, sizes are stored (ciphertext) sizes.
+func (c *EncryptClient) List(ctx context.Context, prefix string) objectstore.ObjectIterator {
+	return c.client.List(ctx, prefix)
+}
@@ -0,0 +1,313 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/client/objectstore/memory"
+)
+
+func newTestClient(t *testing.T, backend objectstore.Client, cipher Cipher, allowPlaintext bool) *EncryptClient {
+	t.Helper()
+	keyring, err := NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, KeySize)})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	client, err := NewEncryptClient(EncryptConfig{
+		Client:         backend,
+		Keyring:        keyring,
+		Cipher:         cipher,
+		AllowPlaintext: allowPlaintext,
+	})
+	if err != nil {
+		t.Fatalf("NewEncryptClient: %v", err)
+	}
+	return client
+}
+
+func newBackend(t *testing.T) *memory.ClientImpl {
+	t.Helper()
+	backend, err := memory.NewClient(memory.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("memory.NewClient: %v", err)
+	}
+	return backend
+}
+
+func randomContent(n int) []byte {
+	content := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(content)
+	return content
+}
+
+func readAll(client objectstore.Client, key string) ([]byte, error) {
+	body, err := client.Download(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func readRange(client objectstore.Client, key string, offset, length int64) ([]byte, error) {
+	body, err := client.DownloadRange(context.Background(), key, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// uploadParts uploads parts as a multipart upload, marking the last one when
+// markLast is set.
+func uploadParts(t *testing.T, client *EncryptClient, key string, parts [][]byte, markLast bool) {
+	t.Helper()
+	ctx := context.Background()
+	uploadID, err := client.CreateMultipart(ctx, key)
+	if err != nil {
+		t.Fatalf("CreateMultipart: %v", err)
+	}
+	for i, part := range parts {
+		last := markLast && i == len(parts)-1
+		if err := objectstore.UploadPart(ctx, client, key, uploadID, i+1, bytes.NewReader(part), last); err != nil {
+			t.Fatalf("UploadPart %d: %v", i+1, err)
+		}
+	}
+	if err := client.CompleteMultipart(ctx, key, uploadID); err != nil {
+		t.Fatalf("CompleteMultipart: %v", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 17}
+	for _, cipher := range []Cipher{CipherAES256GCM, CipherXChaCha20Poly1305} {
+		for _, size := range sizes {
+			t.Run(fmt.Sprintf("%d/%d", cipher, size), func(t *testing.T) {
+				backend := newBackend(t)
+				client := newTestClient(t, backend, cipher, false)
+				content := randomContent(size)
+
+				if err := client.Upload(context.Background(), "object", bytes.NewReader(content)); err != nil {
+					t.Fatalf("Upload: %v", err)
+				}
+				stored, err := readAll(backend, "object")
+				if err != nil {
+					t.Fatalf("read stored object: %v", err)
+				}
+				if size >= 16 && bytes.Contains(stored, content) {
+					t.Fatal("stored object contains the plaintext")
+				}
+
+				got, err := readAll(client, "object")
+				if err != nil {
+					t.Fatalf("Download: %v", err)
+				}
+				if !bytes.Equal(got, content) {
+					t.Fatalf("read %d bytes, want %d", len(got), len(content))
+				}
+			})
+		}
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	client := newTestClient(t, newBackend(t), CipherXChaCha20Poly1305, false)
+	content := randomContent(3*segmentSize + 17)
+	if err := client.Upload(context.Background(), "object", bytes.NewReader(content)); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	// Within a segment, across segment boundaries, and up to the end
+	for _, r := range [][2]int64{
+		{0, 10},
+		{5, segmentSize},
+		{segmentSize - 3, 6},
+		{2*segmentSize + 5, segmentSize + 12},
+		{int64(len(content)) - 1, 1},
+	} {
+		got, err := readRange(client, "object", r[0], r[1])
+		if err != nil {
+			t.Fatalf("DownloadRange(%d, %d): %v", r[0], r[1], err)
+		}
+		if !bytes.Equal(got, content[r[0]:r[0]+r[1]]) {
+			t.Fatalf("DownloadRange(%d, %d) returned the wrong %d bytes", r[0], r[1], len(got))
+		}
+	}
+}
+
+func TestTamperedObjectsFail(t *testing.T) {
+	ctx := context.Background()
+	content := randomContent(2*segmentSize + 100)
+
+	tests := []struct {
+		name   string
+		tamper func(stored []byte) (key string, tampered []byte)
+		want   error
+	}{
+		{"flipped byte", func(stored []byte) (string, []byte) {
+			tampered := bytes.Clone(stored)
+			tampered[len(tampered)/2] ^= 1
+			return "object", tampered
+		}, ErrAuthentication},
+		{"truncated", func(stored []byte) (string, []byte) {
+			return "object", stored[:len(stored)-segmentSize/2]
+		}, io.ErrUnexpectedEOF},
+		// The segment before isn't marked last, the stream must go on
+		{"last segment dropped", func(stored []byte) (string, []byte) {
+			return "object", stored[:len(stored)-(4+100+tagSize)]
+		}, io.ErrUnexpectedEOF},
+		{"appended", func(stored []byte) (string, []byte) {
+			return "object", append(bytes.Clone(stored), stored...)
+		}, ErrCorrupt},
+		{"moved", func(stored []byte) (string, []byte) {
+			return "other", stored
+		}, ErrAuthentication},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := newBackend(t)
+			client := newTestClient(t, backend, CipherAES256GCM, false)
+			if err := client.Upload(ctx, "object", bytes.NewReader(content)); err != nil {
+				t.Fatalf("Upload: %v", err)
+			}
+			stored, err := readAll(backend, "object")
+			if err != nil {
+				t.Fatalf("read stored object: %v", err)
+			}
+
+			key, tampered := test.tamper(stored)
+			if err := backend.Upload(ctx, key, bytes.NewReader(tampered)); err != nil {
+				t.Fatalf("Upload tampered: %v", err)
+			}
+			if _, err := readAll(client, key); !errors.Is(err, test.want) {
+				t.Fatalf("Download error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	parts := [][]byte{randomContent(segmentSize + 3), randomContent(10), randomContent(2 * segmentSize)}
+	whole := bytes.Join(parts, nil)
+
+	t.Run("complete", func(t *testing.T) {
+		client := newTestClient(t, newBackend(t), CipherXChaCha20Poly1305, false)
+		uploadParts(t, client, "object", parts, true)
+
+		got, err := readAll(client, "object")
+		if err != nil {
+			t.Fatalf("Download: %v", err)
+		}
+		if !bytes.Equal(got, whole) {
+			t.Fatalf("read %d bytes, want %d", len(got), len(whole))
+		}
+
+		// A range starting in the second part
+		offset := int64(len(parts[0]) + 4)
+		got, err = readRange(client, "object", offset, 20)
+		if err != nil {
+			t.Fatalf("DownloadRange: %v", err)
+		}
+		if !bytes.Equal(got, whole[offset:offset+20]) {
+			t.Fatal("DownloadRange returned the wrong bytes")
+		}
+	})
+
+	t.Run("last part unmarked", func(t *testing.T) {
+		client := newTestClient(t, newBackend(t), CipherXChaCha20Poly1305, false)
+		uploadParts(t, client, "object", parts, false)
+
+		if _, err := readAll(client, "object"); !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("Download error = %v, want ErrCorrupt", err)
+		}
+	})
+
+	t.Run("part missing", func(t *testing.T) {
+		ctx := context.Background()
+		client := newTestClient(t, newBackend(t), CipherXChaCha20Poly1305, false)
+		uploadID, err := client.CreateMultipart(ctx, "object")
+		if err != nil {
+			t.Fatalf("CreateMultipart: %v", err)
+		}
+		if err := client.UploadPart(ctx, "object", uploadID, 1, bytes.NewReader(parts[0])); err != nil {
+			t.Fatalf("UploadPart: %v", err)
+		}
+		if err := client.UploadLastPart(ctx, "object", uploadID, 3, bytes.NewReader(parts[2])); err != nil {
+			t.Fatalf("UploadLastPart: %v", err)
+		}
+		if err := client.CompleteMultipart(ctx, "object", uploadID); err != nil {
+			t.Fatalf("CompleteMultipart: %v", err)
+		}
+
+		if _, err := readAll(client, "object"); !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("Download error = %v, want ErrCorrupt", err)
+		}
+	})
+}
+
+func TestPlaintext(t *testing.T) {
+	backend := newBackend(t)
+	if err := backend.Upload(context.Background(), "object", bytes.NewReader([]byte("plaintext object"))); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	client := newTestClient(t, backend, CipherAES256GCM, false)
+	if _, err := readAll(client, "object"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Download error = %v, want ErrCorrupt", err)
+	}
+	if _, err := readRange(client, "object", 2, 3); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("DownloadRange error = %v, want ErrCorrupt", err)
+	}
+
+	migrating := newTestClient(t, backend, CipherAES256GCM, true)
+	got, err := readAll(migrating, "object")
+	if err != nil || string(got) != "plaintext object" {
+		t.Fatalf("Download = %q, %v, want the plaintext", got, err)
+	}
+	got, err = readRange(migrating, "object", 2, 3)
+	if err != nil || string(got) != "ain" {
+		t.Fatalf("DownloadRange = %q, %v, want %q", got, err, "ain")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	backend := newBackend(t)
+	oldKey, newKey := bytes.Repeat([]byte{1}, KeySize), bytes.Repeat([]byte{2}, KeySize)
+
+	old := newTestClient(t, backend, CipherAES256GCM, false)
+	if err := old.Upload(context.Background(), "object", bytes.NewReader([]byte("written with k1"))); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	keyring, err := NewKeyring("k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	rotated, err := NewEncryptClient(EncryptConfig{Client: backend, Keyring: keyring, Cipher: CipherAES256GCM})
+	if err != nil {
+		t.Fatalf("NewEncryptClient: %v", err)
+	}
+	got, err := readAll(rotated, "object")
+	if err != nil || string(got) != "written with k1" {
+		t.Fatalf("Download = %q, %v, want the content written with k1", got, err)
+	}
+
+	// Without the old key the object can't be read
+	keyring, err = NewKeyring("k2", map[string][]byte{"k2": newKey})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	dropped, err := NewEncryptClient(EncryptConfig{Client: backend, Keyring: keyring, Cipher: CipherAES256GCM})
+	if err != nil {
+		t.Fatalf("NewEncryptClient: %v", err)
+	}
+	if _, err := readAll(dropped, "object"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Download error = %v, want ErrUnknownKey", err)
+	}
+}
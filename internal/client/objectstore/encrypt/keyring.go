@@ -0,0 +1,53 @@
+package encrypt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// KeySize is the size of master keys in bytes.
+const KeySize = 32
+
+var ErrUnknownKey = errors.New("unknown key id")
+
+// Keyring holds the master keys by ID. New objects are encrypted with the
+// current key, any key in the ring can decrypt. Rotating means adding a key,
+// making it current, and keeping the old ones until nothing uses them.
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeyring creates a keyring encrypting with the key named current.
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("key id must be 1 to 255 bytes, got %q", id)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key %s must be %d bytes, got %d", id, KeySize, len(key))
+		}
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current key %s: %w", current, ErrUnknownKey)
+	}
+
+	return &Keyring{
+		current: current,
+		keys:    keys,
+	}, nil
+}
+
+// Current returns the ID of the key used to encrypt new objects.
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// Key returns the key with the given ID.
+func (k *Keyring) Key(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("key %s: %w", id, ErrUnknownKey)
+	}
+	return key, nil
+}
@@ -0,0 +1,341 @@
+package encrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Stream format. An encrypted object is one or more streams (one per
+// multipart part), each made of a header and sealed segments:
+//
+//	header:  magic "TPLE" | version | cipher | flags | key id length | key id | salt | uint32 big endian part number, parts only
+//	segment: uint32 big endian sealed length, high bit set on the last segment | sealed bytes
+//
+// Every segment but the last holds segmentSize plaintext bytes, so segment i
+// of a single stream starts at len(header) + i*stride. Each stream uses its
+// own key derived from the master key and the random salt, so nonces are just
+// the segment counter and the last segment flag. The header and the object
+// key are authenticated as additional data of every segment, so a stream
+// can't be moved to another key, and as the header holds the part number and
+// the last part flag, parts can't be reordered, dropped or cut off the end.
+const (
+	formatVersion = 1
+	saltSize      = 32
+	segmentSize   = 64 * 1024
+	tagSize       = 16
+	stride        = 4 + segmentSize + tagSize
+	lastSegment   = 1 << 31
+
+	// flagPart marks a stream that is one part of a multipart object, segment
+	// offsets can't be computed past the first part.
+	flagPart = 1 << 0
+	// flagLastPart marks the part a multipart object ends with.
+	flagLastPart = 1 << 1
+
+	maxHeaderSize = 8 + 255 + saltSize + 4
+)
+
+var magic = []byte("TPLE")
+
+var (
+	ErrCorrupt        = errors.New("encrypted object is corrupt")
+	ErrAuthentication = errors.New("message authentication failed")
+)
+
+// Cipher is the AEAD used to seal segments.
+type Cipher byte
+
+const (
+	CipherAES256GCM         Cipher = 1
+	CipherXChaCha20Poly1305 Cipher = 2
+)
+
+// ParseCipher parses a cipher name as used in the config.
+func ParseCipher(name string) (Cipher, error) {
+	switch name {
+	case "aes256gcm":
+		return CipherAES256GCM, nil
+	case "xchacha20poly1305":
+		return CipherXChaCha20Poly1305, nil
+	default:
+		return 0, fmt.Errorf("unknown cipher %q", name)
+	}
+}
+
+type header struct {
+	cipher Cipher
+	flags  byte
+	keyID  string
+	salt   []byte
+	// part is the part number, 0 for a single stream
+	part uint32
+	// raw is the encoded header
+	raw []byte
+}
+
+func newHeader(c Cipher, flags byte, keyID string, part uint32) (header, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return header{}, fmt.Errorf("generate salt: %w", err)
+	}
+
+	raw := make([]byte, 0, maxHeaderSize)
+	raw = append(raw, magic...)
+	raw = append(raw, formatVersion, byte(c), flags, byte(len(keyID)))
+	raw = append(raw, keyID...)
+	raw = append(raw, salt...)
+	if flags&flagPart != 0 {
+		raw = binary.BigEndian.AppendUint32(raw, part)
+	}
+
+	return header{cipher: c, flags: flags, keyID: keyID, salt: salt, part: part, raw: raw}, nil
+}
+
+// final reports whether the object ends with this stream.
+func (h header) final() bool {
+	return h.flags&flagPart == 0 || h.flags&flagLastPart != 0
+}
+
+func readHeader(r io.Reader) (header, error) {
+	fixed := make([]byte, 8)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return header{}, fmt.Errorf("read header: %w", unexpected(err))
+	}
+	if !bytes.Equal(fixed[:4], magic) {
+		return header{}, fmt.Errorf("bad magic: %w", ErrCorrupt)
+	}
+	if fixed[4] != formatVersion {
+		return header{}, fmt.Errorf("unsupported format version %d", fixed[4])
+	}
+
+	flags := fixed[6]
+	rest := make([]byte, int(fixed[7])+saltSize)
+	if flags&flagPart != 0 {
+		rest = make([]byte, len(rest)+4)
+	}
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return header{}, fmt.Errorf("read header: %w", unexpected(err))
+	}
+
+	hdr := header{
+		cipher: Cipher(fixed[5]),
+		flags:  flags,
+		keyID:  string(rest[:fixed[7]]),
+		salt:   rest[fixed[7] : int(fixed[7])+saltSize],
+		raw:    append(fixed, rest...),
+	}
+	if flags&flagPart != 0 {
+		hdr.part = binary.BigEndian.Uint32(rest[int(fixed[7])+saltSize:])
+	}
+	return hdr, nil
+}
+
+// aead derives the stream key and returns the cipher sealing its segments.
+func (h header) aead(keyring *Keyring) (cipher.AEAD, error) {
+	master, err := keyring.Key(h.keyID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hkdf.Key(sha256.New, master, h.salt, "templar objectstore stream", KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+
+	switch h.cipher {
+	case CipherAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, fmt.Errorf("unknown cipher %d: %w", h.cipher, ErrCorrupt)
+	}
+}
+
+func additionalData(hdr header, key string) []byte {
+	ad := make([]byte, 0, len(hdr.raw)+len(key))
+	ad = append(ad, hdr.raw...)
+	return append(ad, key...)
+}
+
+func nonce(aead cipher.AEAD, counter uint32, last bool) []byte {
+	n := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint32(n[len(n)-5:], counter)
+	if last {
+		n[len(n)-1] = 1
+	}
+	return n
+}
+
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// encryptStream writes content to w as a single stream of object key.
+func encryptStream(w io.Writer, content io.Reader, key string, hdr header, aead cipher.AEAD) error {
+	ad := additionalData(hdr, key)
+	if _, err := w.Write(hdr.raw); err != nil {
+		return err
+	}
+
+	src := bufio.NewReaderSize(content, segmentSize)
+	plain := make([]byte, segmentSize)
+	sealed := make([]byte, 4, 4+segmentSize+aead.Overhead())
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(src, plain)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		last := n < segmentSize
+		if !last {
+			if _, err := src.Peek(1); errors.Is(err, io.EOF) {
+				last = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		sealed = aead.Seal(sealed[:4], nonce(aead, counter, last), plain[:n], ad)
+		length := uint32(len(sealed) - 4)
+		if last {
+			length |= lastSegment
+		}
+		binary.BigEndian.PutUint32(sealed[:4], length)
+		if _, err := w.Write(sealed); err != nil {
+			return err
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
+
+// decryptReader decrypts a sequence of streams.
+type decryptReader struct {
+	src     *bufio.Reader
+	body    io.Closer
+	key     string
+	keyring *Keyring
+
+	// aead is nil between streams
+	aead    cipher.AEAD
+	ad      []byte
+	counter uint32
+	// part is the number of the last part opened, final is set while reading
+	// the stream the object ends with and ended once it was read
+	part  uint32
+	final bool
+	ended bool
+
+	plain []byte
+	buf   []byte
+}
+
+func newDecryptReader(body io.ReadCloser, key string, keyring *Keyring) *decryptReader {
+	return &decryptReader{
+		src:     bufio.NewReader(body),
+		body:    body,
+		key:     key,
+		keyring: keyring,
+		buf:     make([]byte, segmentSize+tagSize),
+	}
+}
+
+// resume continues a stream at segment counter, for reads starting mid-object.
+func (r *decryptReader) resume(aead cipher.AEAD, hdr header, counter uint32) {
+	r.aead = aead
+	r.ad = additionalData(hdr, r.key)
+	r.counter = counter
+	r.part = hdr.part
+	r.final = hdr.final()
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next segment, reading a stream header first if needed.
+func (r *decryptReader) next() error {
+	if r.aead == nil {
+		if _, err := r.src.Peek(1); err != nil {
+			if errors.Is(err, io.EOF) && !r.ended {
+				return fmt.Errorf("object ends after part %d: %w", r.part, ErrCorrupt)
+			}
+			return err
+		}
+		if r.ended {
+			return fmt.Errorf("data after the last stream: %w", ErrCorrupt)
+		}
+		hdr, err := readHeader(r.src)
+		if err != nil {
+			return err
+		}
+		// A single stream is the whole object, parts follow each other from 1
+		if (hdr.flags&flagPart == 0 && r.part != 0) || (hdr.flags&flagPart != 0 && hdr.part != r.part+1) {
+			return fmt.Errorf("stream of part %d after part %d: %w", hdr.part, r.part, ErrCorrupt)
+		}
+		aead, err := hdr.aead(r.keyring)
+		if err != nil {
+			return err
+		}
+		r.resume(aead, hdr, 0)
+	}
+
+	var prefix [4]byte
+	if _, err := io.ReadFull(r.src, prefix[:]); err != nil {
+		return unexpected(err)
+	}
+	length := binary.BigEndian.Uint32(prefix[:])
+	last := length&lastSegment != 0
+	size := int(length &^ lastSegment)
+	if size < r.aead.Overhead() || size > len(r.buf) {
+		return fmt.Errorf("segment %d has length %d: %w", r.counter, size, ErrCorrupt)
+	}
+
+	if _, err := io.ReadFull(r.src, r.buf[:size]); err != nil {
+		return unexpected(err)
+	}
+	plain, err := r.aead.Open(r.buf[:0], nonce(r.aead, r.counter, last), r.buf[:size], r.ad)
+	if err != nil {
+		return fmt.Errorf("segment %d: %w", r.counter, ErrAuthentication)
+	}
+
+	r.plain = plain
+	r.counter++
+	if last {
+		r.aead = nil
+		r.ended = r.final
+	}
+	return nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.body.Close()
+}
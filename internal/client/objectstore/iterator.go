@@ -0,0 +1,67 @@
+package objectstore
+
+import "context"
+
+// PageFunc fetches the page of objects starting at cursor. An empty next
+// cursor means the returned page is the last one.
+type PageFunc func(ctx context.Context, cursor string) (page []ObjectInfo, next string, err error)
+
+type pageIterator struct {
+	ctx    context.Context
+	fetch  PageFunc
+	cursor string
+	page   []ObjectInfo
+	idx    int
+	item   ObjectInfo
+	done   bool
+	err    error
+}
+
+// NewPageIterator returns an iterator that calls fetch lazily, one page at a time.
+func NewPageIterator(ctx context.Context, fetch PageFunc) ObjectIterator {
+	return &pageIterator{ctx: ctx, fetch: fetch}
+}
+
+// NewSliceIterator returns an iterator over an already materialized listing.
+func NewSliceIterator(items []ObjectInfo) ObjectIterator {
+	return &pageIterator{page: items, done: true}
+}
+
+// NewErrorIterator returns an iterator that yields nothing and reports err.
+func NewErrorIterator(err error) ObjectIterator {
+	return &pageIterator{done: true, err: err}
+}
+
+func (it *pageIterator) Next() bool {
+	for {
+		if it.idx < len(it.page) {
+			it.item = it.page[it.idx]
+			it.idx++
+			return true
+		}
+		if it.done || it.err != nil {
+			return false
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+
+		page, next, err := it.fetch(it.ctx, it.cursor)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.idx = page, 0
+		it.cursor = next
+		it.done = next == ""
+	}
+}
+
+func (it *pageIterator) Item() ObjectInfo {
+	return it.item
+}
+
+func (it *pageIterator) Err() error {
+	return it.err
+}
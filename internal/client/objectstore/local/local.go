@@ -2,18 +2,27 @@ package local
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/utils/blake3"
+	"github.com/beanbocchi/templar/internal/utils/ioutil"
 )
 
 type ClientImpl struct {
 	root    string
 	baseURL string
+	fsync   bool
 }
 
 type LocalConfig struct {
@@ -22,6 +31,9 @@ type LocalConfig struct {
 	// BaseURL is the public base URL used to construct public URLs, e.g., http://localhost:8080/api/v1/shared/files
 	// If empty, GetURL will return an error and Upload(private=false) will return the key only.
 	BaseURL string
+	// Fsync flushes each upload and the directories leading to it to disk
+	// before Upload returns, so an acknowledged upload survives a crash.
+	Fsync bool
 }
 
 func NewClient(cfg LocalConfig) (*ClientImpl, error) {
@@ -31,7 +43,7 @@ func NewClient(cfg LocalConfig) (*ClientImpl, error) {
 	if err := os.MkdirAll(cfg.Root, 0o755); err != nil {
 		return nil, fmt.Errorf("create root: %w", err)
 	}
-	return &ClientImpl{root: cfg.Root, baseURL: strings.TrimRight(cfg.BaseURL, "/")}, nil
+	return &ClientImpl{root: cfg.Root, baseURL: strings.TrimRight(cfg.BaseURL, "/"), fsync: cfg.Fsync}, nil
 }
 
 func (c *ClientImpl) fullPath(key string) string {
@@ -45,7 +57,8 @@ func (c *ClientImpl) multipartPath(uploadID string) string {
 }
 
 // CreateMultipart starts a multipart upload by allocating a temporary directory
-// on disk where individual parts will be stored before assembly.
+// on disk where individual parts will be stored before assembly. The key is
+// recorded next to them so the session can be listed.
 func (c *ClientImpl) CreateMultipart(ctx context.Context, key string) (string, error) {
 	uploadID := uuid.New().String()
 
@@ -54,11 +67,17 @@ func (c *ClientImpl) CreateMultipart(ctx context.Context, key string) (string, e
 		return "", fmt.Errorf("create multipart dir: %w", err)
 	}
 
+	if err := writeSession(path, session{Key: key, CreatedAt: time.Now()}); err != nil {
+		_ = os.RemoveAll(path)
+		return "", fmt.Errorf("write multipart session: %w", err)
+	}
+
 	return uploadID, nil
 }
 
-// UploadPart writes a single part to a temporary file on disk. We ignore the
-// provided key and rely on uploadID for locating the multipart session.
+// UploadPart writes a single part to a temporary file on disk, along with its
+// BLAKE3 checksum for ListParts. We ignore the provided key and rely on
+// uploadID for locating the multipart session, which must still exist.
 func (c *ClientImpl) UploadPart(
 	ctx context.Context,
 	key string,
@@ -68,12 +87,12 @@ func (c *ClientImpl) UploadPart(
 ) error {
 	_ = ctx
 
-	dir := c.multipartPath(uploadID)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("ensure multipart dir: %w", err)
+	dir, err := c.sessionDir(uploadID)
+	if err != nil {
+		return err
 	}
 
-	partPath := filepath.Join(dir, fmt.Sprintf("part-%06d", partNumber))
+	partPath := filepath.Join(dir, partName(partNumber))
 	tmpPath := partPath + ".tmp"
 
 	f, err := os.Create(tmpPath)
@@ -81,7 +100,8 @@ func (c *ClientImpl) UploadPart(
 		return fmt.Errorf("create part file: %w", err)
 	}
 
-	if _, err := io.Copy(f, content); err != nil {
+	hasher := blake3.New()
+	if _, err := io.Copy(io.MultiWriter(f, hasher), content); err != nil {
 		f.Close()
 		_ = os.Remove(tmpPath)
 		return fmt.Errorf("write part: %w", err)
@@ -97,6 +117,9 @@ func (c *ClientImpl) UploadPart(
 		return fmt.Errorf("rename part: %w", err)
 	}
 
+	// A missing checksum is recomputed by ListParts, so a failure here doesn't fail the part
+	_ = os.WriteFile(partPath+checksumSuffix, []byte(hasher.Sum()), 0o644)
+
 	return nil
 }
 
@@ -109,7 +132,10 @@ func (c *ClientImpl) CompleteMultipart(
 ) error {
 	_ = ctx
 
-	dir := c.multipartPath(uploadID)
+	dir, err := c.sessionDir(uploadID)
+	if err != nil {
+		return err
+	}
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return fmt.Errorf("read multipart dir: %w", err)
@@ -129,7 +155,8 @@ func (c *ClientImpl) CompleteMultipart(
 
 	wroteAny := false
 	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "part-") {
+		// Skip the session file, checksums and parts still being written
+		if _, ok := parsePartName(entry.Name()); entry.IsDir() || !ok {
 			continue
 		}
 
@@ -210,6 +237,14 @@ func (c *ClientImpl) Upload(ctx context.Context, key string, content io.Reader)
 		return fmt.Errorf("write file: %w", err)
 	}
 
+	if c.fsync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("sync file: %w", err)
+		}
+	}
+
 	if err := f.Close(); err != nil {
 		os.Remove(tmpPath)
 		return fmt.Errorf("close file: %w", err)
@@ -226,16 +261,72 @@ func (c *ClientImpl) Upload(ctx context.Context, key string, content io.Reader)
 		return fmt.Errorf("rename file: %w", err)
 	}
 
+	if c.fsync {
+		if err := c.syncDirs(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("sync dir: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// syncDirs flushes dir and its parents up to the root, so the rename and any
+// directory MkdirAll created are on disk.
+func (c *ClientImpl) syncDirs(dir string) error {
+	root := filepath.Clean(c.root)
+	for {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
 func (c *ClientImpl) Download(ctx context.Context, key string) (io.ReadCloser, error) {
-	path := c.fullPath(key)
-	file, err := os.Open(path)
+	return c.open(key)
+}
+
+// DownloadRange opens the file and seeks to offset.
+func (c *ClientImpl) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := objectstore.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+
+	file, err := c.open(key)
 	if err != nil {
-		return nil, fmt.Errorf("open file: %w", err)
+		return nil, err
 	}
 
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("seek file: %w", err)
+	}
+
+	return ioutil.NewLimitedReadCloser(file, length), nil
+}
+
+// open opens the file of key, a missing file is reported as objectstore.ErrNotFound.
+func (c *ClientImpl) open(key string) (*os.File, error) {
+	file, err := os.Open(c.fullPath(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("open %s: %w", key, objectstore.ErrNotFound)
+		}
+		return nil, fmt.Errorf("open file: %w", err)
+	}
 	return file, nil
 }
 
@@ -246,3 +337,77 @@ func (c *ClientImpl) Delete(ctx context.Context, key string) error {
 	}
 	return nil
 }
+
+func (c *ClientImpl) Stat(ctx context.Context, key string) (objectstore.ObjectInfo, error) {
+	info, err := os.Stat(c.fullPath(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return objectstore.ObjectInfo{}, fmt.Errorf("stat %s: %w", key, objectstore.ErrNotFound)
+		}
+		return objectstore.ObjectInfo{}, fmt.Errorf("stat file: %w", err)
+	}
+	if info.IsDir() {
+		return objectstore.ObjectInfo{}, fmt.Errorf("stat %s: %w", key, objectstore.ErrNotFound)
+	}
+
+	return fileInfo(key, info), nil
+}
+
+// List walks the root directory, skipping multipart sessions and in-flight .tmp files.
+func (c *ClientImpl) List(ctx context.Context, prefix string) objectstore.ObjectIterator {
+	return objectstore.NewPageIterator(ctx, func(ctx context.Context, _ string) ([]objectstore.ObjectInfo, string, error) {
+		var items []objectstore.ObjectInfo
+		err := filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path == c.multipartPath("") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(path, ".tmp") {
+				return nil
+			}
+
+			rel, err := filepath.Rel(c.root, path)
+			if err != nil {
+				return err
+			}
+			key := filepath.ToSlash(rel)
+			if !strings.HasPrefix(key, prefix) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				// Removed between listing and stat
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			items = append(items, fileInfo(key, info))
+			return nil
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("walk root: %w", err)
+		}
+
+		sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+		return items, "", nil
+	})
+}
+
+func fileInfo(key string, info fs.FileInfo) objectstore.ObjectInfo {
+	return objectstore.ObjectInfo{
+		Key:     key,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		ETag:    fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+	}
+}
@@ -0,0 +1,278 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/utils/blake3"
+)
+
+const (
+	// sessionFile holds the key and start time of a multipart session
+	sessionFile = "session.json"
+	// checksumSuffix names the file holding the checksum of a part
+	checksumSuffix = ".blake3"
+)
+
+type session struct {
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func writeSession(dir string, s session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, sessionFile), data, 0o644)
+}
+
+func readSession(dir string) (session, error) {
+	var s session
+	data, err := os.ReadFile(filepath.Join(dir, sessionFile))
+	if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal(data, &s)
+}
+
+func partName(partNumber int) string {
+	return fmt.Sprintf("part-%06d", partNumber)
+}
+
+// parsePartName returns the part number of a part file, rejecting anything
+// else found in a session directory.
+func parsePartName(name string) (int, bool) {
+	digits, ok := strings.CutPrefix(name, "part-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// sessionDir returns the directory of a session, or an error wrapping
+// objectstore.ErrNotFound. Upload IDs are UUIDs, anything else could escape
+// the multipart directory.
+func (c *ClientImpl) sessionDir(uploadID string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", fmt.Errorf("multipart session %s: %w", uploadID, objectstore.ErrNotFound)
+	}
+
+	dir := c.multipartPath(uploadID)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("multipart session %s: %w", uploadID, objectstore.ErrNotFound)
+	}
+	return dir, nil
+}
+
+// ListMultipart lists the session directories. Sessions started before keys
+// were recorded are listed with an empty key and their directory time.
+func (c *ClientImpl) ListMultipart(ctx context.Context, prefix string) ([]objectstore.MultipartSession, error) {
+	entries, err := os.ReadDir(c.multipartPath(""))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read multipart dir: %w", err)
+	}
+
+	var sessions []objectstore.MultipartSession
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		s, err := readSession(c.multipartPath(entry.Name()))
+		if err != nil {
+			info, err := entry.Info()
+			if err != nil {
+				// Completed or aborted since it was listed
+				continue
+			}
+			s = session{CreatedAt: info.ModTime()}
+		}
+		if !strings.HasPrefix(s.Key, prefix) {
+			continue
+		}
+
+		sessions = append(sessions, objectstore.MultipartSession{
+			Key:       s.Key,
+			UploadID:  entry.Name(),
+			CreatedAt: s.CreatedAt,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.Before(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+// ListParts lists the parts written so far. A checksum missing after a crash
+// is computed from the part.
+func (c *ClientImpl) ListParts(ctx context.Context, key, uploadID string) ([]objectstore.PartInfo, error) {
+	dir, err := c.sessionDir(uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read multipart dir: %w", err)
+	}
+
+	var parts []objectstore.PartInfo
+	for _, entry := range entries {
+		partNumber, ok := parsePartName(entry.Name())
+		if entry.IsDir() || !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("stat part %s: %w", entry.Name(), err)
+		}
+
+		partPath := filepath.Join(dir, entry.Name())
+		checksum, err := os.ReadFile(partPath + checksumSuffix)
+		if err != nil {
+			checksum, err = checksumFile(partPath)
+			if err != nil {
+				return nil, fmt.Errorf("checksum part %s: %w", entry.Name(), err)
+			}
+		}
+
+		parts = append(parts, objectstore.PartInfo{
+			PartNumber: partNumber,
+			Size:       info.Size(),
+			Checksum:   string(checksum),
+			ModTime:    info.ModTime(),
+		})
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+func checksumFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sum, err := blake3.Compute(f)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sum), nil
+}
+
+// ExpireMultipart removes the sessions that received nothing since before,
+// and the .tmp files crashed uploads left next to objects.
+func (c *ClientImpl) ExpireMultipart(ctx context.Context, before time.Time) (int, error) {
+	entries, err := os.ReadDir(c.multipartPath(""))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("read multipart dir: %w", err)
+	}
+
+	expired := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := c.multipartPath(entry.Name())
+		active, err := lastModified(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return expired, fmt.Errorf("stat multipart session %s: %w", entry.Name(), err)
+		}
+		if !active.Before(before) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return expired, fmt.Errorf("remove multipart session %s: %w", entry.Name(), err)
+		}
+		expired++
+	}
+
+	if err := c.removeStaleTemp(ctx, before); err != nil {
+		return expired, err
+	}
+	return expired, nil
+}
+
+// lastModified returns the latest modification time in a session directory.
+func lastModified(dir string) (time.Time, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+	latest := info.ModTime()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (c *ClientImpl) removeStaleTemp(ctx context.Context, before time.Time) error {
+	err := filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == c.multipartPath("") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("remove stale temp files: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/utils/blake3"
+)
+
+var (
+	ErrUploadNotFound = fmt.Errorf("multipart upload %w", objectstore.ErrNotFound)
+	ErrTooLarge       = errors.New("object exceeds size limit")
+	ErrStoreFull      = errors.New("store size limit reached")
+)
+
+type object struct {
+	data    []byte
+	modTime time.Time
+	etag    string
+}
+
+type multipartSession struct {
+	key   string
+	parts map[int][]byte
+	// size is the bytes held by parts.
+	size int64
+}
+
+type ClientImpl struct {
+	mu sync.RWMutex
+
+	objects   map[string]*object
+	uploads   map[string]*multipartSession
+	totalSize int64
+	// stagedSize is the bytes held by the parts of open multipart sessions,
+	// which count against MaxTotalSize until the session ends.
+	stagedSize int64
+
+	maxObjectSize int64
+	maxTotalSize  int64
+	latency       time.Duration
+}
+
+type MemoryConfig struct {
+	// MaxObjectSize is the largest object (or multipart part) accepted in bytes, 0 means unlimited
+	MaxObjectSize int64
+	// MaxTotalSize is the total bytes the store may hold, parts of open multipart uploads included, 0 means unlimited
+	MaxTotalSize int64
+	// Latency is an artificial delay added to every operation, useful to simulate a remote backend
+	Latency time.Duration
+}
+
+// NewClient creates a new in-memory objectstore client. Contents are lost when
+// the process exits.
+func NewClient(cfg MemoryConfig) (*ClientImpl, error) {
+	if cfg.MaxObjectSize < 0 || cfg.MaxTotalSize < 0 {
+		return nil, fmt.Errorf("size limits must not be negative")
+	}
+	if cfg.Latency < 0 {
+		return nil, fmt.Errorf("latency must not be negative")
+	}
+
+	return &ClientImpl{
+		objects:       make(map[string]*object),
+		uploads:       make(map[string]*multipartSession),
+		maxObjectSize: cfg.MaxObjectSize,
+		maxTotalSize:  cfg.MaxTotalSize,
+		latency:       cfg.Latency,
+	}, nil
+}
+
+// wait applies the configured artificial latency, returning early if ctx is done.
+func (c *ClientImpl) wait(ctx context.Context) error {
+	if c.latency <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(c.latency)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// readAll reads content while enforcing MaxObjectSize.
+func (c *ClientImpl) readAll(content io.Reader) ([]byte, error) {
+	if c.maxObjectSize <= 0 {
+		return io.ReadAll(content)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(content, c.maxObjectSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > c.maxObjectSize {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// fits reports whether growing the store by delta bytes keeps it within
+// MaxTotalSize. Callers must hold mu.
+func (c *ClientImpl) fits(delta int64) bool {
+	return c.maxTotalSize <= 0 || c.totalSize+c.stagedSize+delta <= c.maxTotalSize
+}
+
+// put stores data under key, replacing any existing object. Callers must hold mu.
+func (c *ClientImpl) put(key string, data []byte) error {
+	var existing int64
+	if obj, ok := c.objects[key]; ok {
+		existing = int64(len(obj.data))
+	}
+
+	delta := int64(len(data)) - existing
+	if !c.fits(delta) {
+		return ErrStoreFull
+	}
+
+	etag, err := blake3.Compute(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("compute etag: %w", err)
+	}
+
+	c.objects[key] = &object{data: data, modTime: time.Now(), etag: etag}
+	c.totalSize += delta
+	return nil
+}
+
+// CreateMultipart starts a multipart session held in memory until completed or aborted.
+func (c *ClientImpl) CreateMultipart(ctx context.Context, key string) (string, error) {
+	if err := c.wait(ctx); err != nil {
+		return "", err
+	}
+
+	uploadID := uuid.New().String()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.uploads[uploadID] = &multipartSession{
+		key:   key,
+		parts: make(map[int][]byte),
+	}
+
+	return uploadID, nil
+}
+
+// UploadPart stores a single part, replacing any part with the same number.
+func (c *ClientImpl) UploadPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	content io.Reader,
+) error {
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+	if partNumber < 1 {
+		return fmt.Errorf("invalid part number %d", partNumber)
+	}
+
+	data, err := c.readAll(content)
+	if err != nil {
+		return fmt.Errorf("read part: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	session, ok := c.uploads[uploadID]
+	if !ok || session.key != key {
+		return fmt.Errorf("upload part %s: %w", uploadID, ErrUploadNotFound)
+	}
+	delta := int64(len(data)) - int64(len(session.parts[partNumber]))
+	if !c.fits(delta) {
+		return fmt.Errorf("upload part %s: %w", uploadID, ErrStoreFull)
+	}
+	session.parts[partNumber] = data
+	session.size += delta
+	c.stagedSize += delta
+
+	return nil
+}
+
+// CompleteMultipart concatenates the parts in part number order into the final object.
+func (c *ClientImpl) CompleteMultipart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	session, ok := c.uploads[uploadID]
+	if !ok || session.key != key {
+		return fmt.Errorf("complete multipart %s: %w", uploadID, ErrUploadNotFound)
+	}
+	if len(session.parts) == 0 {
+		return fmt.Errorf("no parts found")
+	}
+
+	numbers := make([]int, 0, len(session.parts))
+	for n := range session.parts {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	if c.maxObjectSize > 0 && session.size > c.maxObjectSize {
+		return fmt.Errorf("complete multipart %s: %w", uploadID, ErrTooLarge)
+	}
+
+	data := make([]byte, 0, session.size)
+	for _, n := range numbers {
+		data = append(data, session.parts[n]...)
+	}
+
+	// The parts become the object, they must not be counted twice
+	c.stagedSize -= session.size
+	if err := c.put(key, data); err != nil {
+		c.stagedSize += session.size
+		return fmt.Errorf("complete multipart %s: %w", uploadID, err)
+	}
+	delete(c.uploads, uploadID)
+
+	return nil
+}
+
+// AbortMultipart discards a multipart session and its parts.
+func (c *ClientImpl) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if session, ok := c.uploads[uploadID]; ok {
+		c.stagedSize -= session.size
+		delete(c.uploads, uploadID)
+	}
+	return nil
+}
+
+func (c *ClientImpl) Upload(ctx context.Context, key string, content io.Reader) error {
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+
+	data, err := c.readAll(content)
+	if err != nil {
+		return fmt.Errorf("read content: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.put(key, data); err != nil {
+		return fmt.Errorf("upload %s: %w", key, err)
+	}
+	return nil
+}
+
+func (c *ClientImpl) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	obj, ok := c.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("download %s: %w", key, objectstore.ErrNotFound)
+	}
+
+	// Stored slices are never mutated in place, so readers can share them.
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (c *ClientImpl) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := objectstore.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	obj, ok := c.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("download %s: %w", key, objectstore.ErrNotFound)
+	}
+
+	size := int64(len(obj.data))
+	start := min(offset, size)
+	end := size
+	if length > 0 {
+		end = min(start+length, size)
+	}
+
+	return io.NopCloser(bytes.NewReader(obj.data[start:end])), nil
+}
+
+func (c *ClientImpl) Delete(ctx context.Context, key string) error {
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if obj, ok := c.objects[key]; ok {
+		c.totalSize -= int64(len(obj.data))
+		delete(c.objects, key)
+	}
+	return nil
+}
+
+func (c *ClientImpl) Stat(ctx context.Context, key string) (objectstore.ObjectInfo, error) {
+	if err := c.wait(ctx); err != nil {
+		return objectstore.ObjectInfo{}, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	obj, ok := c.objects[key]
+	if !ok {
+		return objectstore.ObjectInfo{}, fmt.Errorf("stat %s: %w", key, objectstore.ErrNotFound)
+	}
+
+	return obj.info(key), nil
+}
+
+// List snapshots the matching keys at call time.
+func (c *ClientImpl) List(ctx context.Context, prefix string) objectstore.ObjectIterator {
+	if err := c.wait(ctx); err != nil {
+		return objectstore.NewErrorIterator(err)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var items []objectstore.ObjectInfo
+	for key, obj := range c.objects {
+		if strings.HasPrefix(key, prefix) {
+			items = append(items, obj.info(key))
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+
+	return objectstore.NewSliceIterator(items)
+}
+
+func (o *object) info(key string) objectstore.ObjectInfo {
+	return objectstore.ObjectInfo{
+		Key:     key,
+		Size:    int64(len(o.data)),
+		ModTime: o.modTime,
+		ETag:    o.etag,
+	}
+}
@@ -0,0 +1,262 @@
+package memory_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/client/objectstore/memory"
+)
+
+func newClient(t *testing.T, cfg memory.MemoryConfig) *memory.ClientImpl {
+	t.Helper()
+	client, err := memory.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func read(t *testing.T, client objectstore.Client, key string) string {
+	t.Helper()
+	body, err := client.Download(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Download %s: %v", key, err)
+	}
+	defer body.Close()
+	content, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return string(content)
+}
+
+func TestObjects(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t, memory.MemoryConfig{})
+	for _, key := range []string{"chunks/b", "chunks/a", "blobs/c"} {
+		if err := client.Upload(ctx, key, strings.NewReader("content of "+key)); err != nil {
+			t.Fatalf("Upload %s: %v", key, err)
+		}
+	}
+
+	if got := read(t, client, "chunks/a"); got != "content of chunks/a" {
+		t.Fatalf("Download = %q", got)
+	}
+	body, err := client.DownloadRange(ctx, "chunks/a", 3, 4)
+	if err != nil {
+		t.Fatalf("DownloadRange: %v", err)
+	}
+	got, _ := io.ReadAll(body)
+	if string(got) != "tent" {
+		t.Fatalf("DownloadRange = %q, want %q", got, "tent")
+	}
+
+	info, err := client.Stat(ctx, "chunks/a")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len("content of chunks/a")) || info.ETag == "" {
+		t.Fatalf("Stat = %+v", info)
+	}
+
+	var keys []string
+	it := client.List(ctx, "chunks/")
+	for it.Next() {
+		keys = append(keys, it.Item().Key)
+	}
+	if strings.Join(keys, ",") != "chunks/a,chunks/b" {
+		t.Fatalf("List = %v", keys)
+	}
+
+	if err := client.Delete(ctx, "chunks/a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := client.Stat(ctx, "chunks/a"); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("Stat after Delete error = %v, want ErrNotFound", err)
+	}
+	if _, err := client.Download(ctx, "chunks/a"); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("Download after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t, memory.MemoryConfig{})
+
+	uploadID, err := client.CreateMultipart(ctx, "multi")
+	if err != nil {
+		t.Fatalf("CreateMultipart: %v", err)
+	}
+	// Out of order, and part 1 is sent twice, the second one wins
+	for _, part := range []struct {
+		number  int
+		content string
+	}{{3, "!"}, {1, "bye "}, {2, "world"}, {1, "hello "}} {
+		if err := client.UploadPart(ctx, "multi", uploadID, part.number, strings.NewReader(part.content)); err != nil {
+			t.Fatalf("UploadPart %d: %v", part.number, err)
+		}
+	}
+	if _, err := client.Stat(ctx, "multi"); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("object visible before completion: %v", err)
+	}
+	if err := client.UploadPart(ctx, "other", uploadID, 4, strings.NewReader("x")); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("UploadPart under another key error = %v, want ErrNotFound", err)
+	}
+
+	if err := client.CompleteMultipart(ctx, "multi", uploadID); err != nil {
+		t.Fatalf("CompleteMultipart: %v", err)
+	}
+	if got := read(t, client, "multi"); got != "hello world!" {
+		t.Fatalf("assembled object = %q", got)
+	}
+
+	// The session ends with completion
+	if err := client.UploadPart(ctx, "multi", uploadID, 4, strings.NewReader("x")); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("UploadPart after completion error = %v, want ErrNotFound", err)
+	}
+	if err := client.CompleteMultipart(ctx, "multi", uploadID); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("CompleteMultipart twice error = %v, want ErrNotFound", err)
+	}
+
+	empty, err := client.CreateMultipart(ctx, "empty")
+	if err != nil {
+		t.Fatalf("CreateMultipart: %v", err)
+	}
+	if err := client.CompleteMultipart(ctx, "empty", empty); err == nil {
+		t.Fatal("CompleteMultipart without parts succeeded")
+	}
+
+	aborted, err := client.CreateMultipart(ctx, "aborted")
+	if err != nil {
+		t.Fatalf("CreateMultipart: %v", err)
+	}
+	if err := client.UploadPart(ctx, "aborted", aborted, 1, strings.NewReader("x")); err != nil {
+		t.Fatalf("UploadPart: %v", err)
+	}
+	if err := client.AbortMultipart(ctx, "aborted", aborted); err != nil {
+		t.Fatalf("AbortMultipart: %v", err)
+	}
+	if err := client.CompleteMultipart(ctx, "aborted", aborted); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("CompleteMultipart after abort error = %v, want ErrNotFound", err)
+	}
+	if _, err := client.Stat(ctx, "aborted"); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("aborted upload left an object: %v", err)
+	}
+}
+
+func TestMaxObjectSize(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t, memory.MemoryConfig{MaxObjectSize: 10})
+
+	if err := client.Upload(ctx, "fits", bytes.NewReader(make([]byte, 10))); err != nil {
+		t.Fatalf("Upload at the limit: %v", err)
+	}
+	if err := client.Upload(ctx, "large", bytes.NewReader(make([]byte, 11))); !errors.Is(err, memory.ErrTooLarge) {
+		t.Fatalf("Upload over the limit error = %v, want ErrTooLarge", err)
+	}
+
+	uploadID, err := client.CreateMultipart(ctx, "multi")
+	if err != nil {
+		t.Fatalf("CreateMultipart: %v", err)
+	}
+	if err := client.UploadPart(ctx, "multi", uploadID, 1, bytes.NewReader(make([]byte, 11))); !errors.Is(err, memory.ErrTooLarge) {
+		t.Fatalf("UploadPart over the limit error = %v, want ErrTooLarge", err)
+	}
+	// Parts within the limit that add up to more than it
+	for n := 1; n <= 2; n++ {
+		if err := client.UploadPart(ctx, "multi", uploadID, n, bytes.NewReader(make([]byte, 6))); err != nil {
+			t.Fatalf("UploadPart %d: %v", n, err)
+		}
+	}
+	if err := client.CompleteMultipart(ctx, "multi", uploadID); !errors.Is(err, memory.ErrTooLarge) {
+		t.Fatalf("CompleteMultipart over the limit error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestMaxTotalSize(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t, memory.MemoryConfig{MaxTotalSize: 20})
+
+	if err := client.Upload(ctx, "a", bytes.NewReader(make([]byte, 15))); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if err := client.Upload(ctx, "b", bytes.NewReader(make([]byte, 6))); !errors.Is(err, memory.ErrStoreFull) {
+		t.Fatalf("Upload over the limit error = %v, want ErrStoreFull", err)
+	}
+	// Replacing an object only counts the difference
+	if err := client.Upload(ctx, "a", bytes.NewReader(make([]byte, 20))); err != nil {
+		t.Fatalf("Upload replacing an object: %v", err)
+	}
+	if err := client.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// Staged parts count until their session ends
+	uploadID, err := client.CreateMultipart(ctx, "multi")
+	if err != nil {
+		t.Fatalf("CreateMultipart: %v", err)
+	}
+	if err := client.UploadPart(ctx, "multi", uploadID, 1, bytes.NewReader(make([]byte, 15))); err != nil {
+		t.Fatalf("UploadPart: %v", err)
+	}
+	if err := client.Upload(ctx, "b", bytes.NewReader(make([]byte, 6))); !errors.Is(err, memory.ErrStoreFull) {
+		t.Fatalf("Upload next to staged parts error = %v, want ErrStoreFull", err)
+	}
+	other, err := client.CreateMultipart(ctx, "other")
+	if err != nil {
+		t.Fatalf("CreateMultipart: %v", err)
+	}
+	if err := client.UploadPart(ctx, "other", other, 1, bytes.NewReader(make([]byte, 6))); !errors.Is(err, memory.ErrStoreFull) {
+		t.Fatalf("UploadPart next to staged parts error = %v, want ErrStoreFull", err)
+	}
+	// A part sent again replaces the bytes it staged
+	if err := client.UploadPart(ctx, "multi", uploadID, 1, bytes.NewReader(make([]byte, 10))); err != nil {
+		t.Fatalf("UploadPart again: %v", err)
+	}
+	if err := client.UploadPart(ctx, "other", other, 1, bytes.NewReader(make([]byte, 6))); err != nil {
+		t.Fatalf("UploadPart after the part shrank: %v", err)
+	}
+
+	// Aborting releases the staged bytes, completing turns them into the object
+	if err := client.AbortMultipart(ctx, "other", other); err != nil {
+		t.Fatalf("AbortMultipart: %v", err)
+	}
+	if err := client.CompleteMultipart(ctx, "multi", uploadID); err != nil {
+		t.Fatalf("CompleteMultipart: %v", err)
+	}
+	if err := client.Upload(ctx, "b", bytes.NewReader(make([]byte, 10))); err != nil {
+		t.Fatalf("Upload after the sessions ended: %v", err)
+	}
+	if err := client.Upload(ctx, "c", bytes.NewReader(make([]byte, 1))); !errors.Is(err, memory.ErrStoreFull) {
+		t.Fatalf("Upload over the limit error = %v, want ErrStoreFull", err)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	const latency = 50 * time.Millisecond
+	client := newClient(t, memory.MemoryConfig{Latency: latency})
+
+	start := time.Now()
+	if err := client.Upload(context.Background(), "a", strings.NewReader("a")); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if _, err := client.Stat(context.Background(), "a"); err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*latency {
+		t.Fatalf("two calls took %v, want at least %v", elapsed, 2*latency)
+	}
+
+	// The delay gives up with the context
+	ctx, cancel := context.WithTimeout(context.Background(), latency/10)
+	defer cancel()
+	if _, err := client.Stat(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stat error = %v, want DeadlineExceeded", err)
+	}
+}
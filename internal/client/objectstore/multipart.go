@@ -0,0 +1,55 @@
+package objectstore
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// MultipartSession is a multipart upload that is neither completed nor aborted.
+type MultipartSession struct {
+	Key       string    `json:"key"`
+	UploadID  string    `json:"upload_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PartInfo describes a part received by a multipart session.
+type PartInfo struct {
+	PartNumber int   `json:"part_number"`
+	Size       int64 `json:"size"`
+	// Checksum is the hex BLAKE3 hash of the part, empty if the backend
+	// doesn't have one (a part uploaded by another client).
+	Checksum string    `json:"checksum"`
+	ModTime  time.Time `json:"mod_time"`
+}
+
+// MultipartSessions is implemented by backends that can list their multipart
+// sessions, so an interrupted upload can find out which parts to resend, and
+// clean up the ones nobody came back for.
+type MultipartSessions interface {
+	// ListMultipart returns the sessions whose key starts with prefix.
+	ListMultipart(ctx context.Context, prefix string) ([]MultipartSession, error)
+	// ListParts returns the parts a session received, by part number.
+	ListParts(ctx context.Context, key, uploadID string) ([]PartInfo, error)
+	// ExpireMultipart aborts the sessions without activity since before, and
+	// returns how many were aborted.
+	ExpireMultipart(ctx context.Context, before time.Time) (int, error)
+}
+
+// LastPartUploader is implemented by clients that mark the last part of a
+// multipart upload. Encryption does, so an object can't be cut short after
+// one of its parts without failing to decrypt.
+type LastPartUploader interface {
+	// UploadLastPart uploads the part with the highest number, the one the
+	// object ends with.
+	UploadLastPart(ctx context.Context, key, uploadID string, partNumber int, content io.Reader) error
+}
+
+// UploadPart uploads a part through client, with UploadLastPart when it is
+// the last one and the client marks it.
+func UploadPart(ctx context.Context, client Client, key, uploadID string, partNumber int, content io.Reader, last bool) error {
+	if uploader, ok := client.(LastPartUploader); ok && last {
+		return uploader.UploadLastPart(ctx, key, uploadID, partNumber, content)
+	}
+	return client.UploadPart(ctx, key, uploadID, partNumber, content)
+}
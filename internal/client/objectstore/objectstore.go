@@ -2,9 +2,56 @@ package objectstore
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"time"
 )
 
+// ErrNotFound is returned (wrapped) by Stat, Download and DownloadRange when
+// the key doesn't exist, and by UploadPart and CompleteMultipart when the
+// multipart session doesn't, such as after it expired.
+var ErrNotFound = errors.New("object not found")
+
+// ErrInvalidRange is returned (wrapped) by DownloadRange when the range is
+// invalid, or when the backend can't satisfy it, such as an offset past the end.
+var ErrInvalidRange = errors.New("invalid range")
+
+// ValidateRange checks the arguments of DownloadRange.
+func ValidateRange(offset, length int64) error {
+	if offset < 0 {
+		return fmt.Errorf("%w offset %d", ErrInvalidRange, offset)
+	}
+	if length == 0 {
+		return fmt.Errorf("%w length 0", ErrInvalidRange)
+	}
+	return nil
+}
+
+// ObjectInfo describes a stored object without reading its content.
+type ObjectInfo struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// ETag changes whenever the content changes. Its format is backend specific.
+	ETag string `json:"etag"`
+}
+
+// ObjectIterator iterates over a listing, fetching further pages on demand.
+//
+//	for it.Next() {
+//		info := it.Item()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type ObjectIterator interface {
+	// Next advances to the next object and reports whether there is one.
+	Next() bool
+	// Item returns the current object.
+	Item() ObjectInfo
+	// Err returns the error that stopped the iteration, if any.
+	Err() error
+}
+
 type Client interface {
 	// Start a multipart upload session
 	CreateMultipart(ctx context.Context, key string) (uploadID string, err error)
@@ -34,5 +81,12 @@ type Client interface {
 
 	Upload(ctx context.Context, key string, content io.Reader) error
 	Download(ctx context.Context, key string) (io.ReadCloser, error)
+	// DownloadRange reads length bytes starting at offset, a negative length reads to the end
+	DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
 	Delete(ctx context.Context, key string) error
+
+	// Stat returns object metadata, or an error wrapping ErrNotFound
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List iterates over objects whose key starts with prefix, in key order
+	List(ctx context.Context, prefix string) ObjectIterator
 }
@@ -0,0 +1,162 @@
+package objectstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ParallelOptions sets how UploadParallel and UploadStream split an object.
+type ParallelOptions struct {
+	// PartSize is the size of every part but the last. Objects no larger are
+	// uploaded in one piece, and 0 uploads everything in one piece.
+	PartSize int64
+	// Concurrency is the number of parts uploaded at once.
+	Concurrency int
+}
+
+// UploadParallel uploads size bytes of content as a multipart upload, sending
+// up to Concurrency parts at once, so one object isn't limited to the
+// throughput of a single stream. Parts are read straight from content, which
+// must be safe for concurrent ReadAt (a bytes.Reader or an os.File is), so
+// nothing is buffered. On failure the multipart upload is aborted.
+func UploadParallel(ctx context.Context, client Client, key string, content io.ReaderAt, size int64, opts ParallelOptions) error {
+	if opts.PartSize <= 0 || size <= opts.PartSize {
+		return client.Upload(ctx, key, io.NewSectionReader(content, 0, size))
+	}
+
+	uploadID, err := client.CreateMultipart(ctx, key)
+	if err != nil {
+		return fmt.Errorf("create multipart: %w", err)
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(opts.Concurrency, 1))
+	for offset, partNumber := int64(0), 1; offset < size; offset, partNumber = offset+opts.PartSize, partNumber+1 {
+		part := io.NewSectionReader(content, offset, min(opts.PartSize, size-offset))
+		last := offset+opts.PartSize >= size
+		g.Go(func() error {
+			if err := UploadPart(gctx, client, key, uploadID, partNumber, part, last); err != nil {
+				return fmt.Errorf("upload part %d: %w", partNumber, err)
+			}
+			return nil
+		})
+	}
+
+	return completeParallel(ctx, client, key, uploadID, g.Wait())
+}
+
+// UploadStream is UploadParallel for content that can only be read once, such
+// as a request body. Parts are read into buffers while the previous ones are
+// sent, so at most Concurrency+1 parts are held in memory.
+func UploadStream(ctx context.Context, client Client, key string, content io.Reader, opts ParallelOptions) error {
+	if opts.PartSize <= 0 {
+		return client.Upload(ctx, key, content)
+	}
+
+	concurrency := max(opts.Concurrency, 1)
+	free := make(chan []byte, concurrency+1)
+	for range concurrency + 1 {
+		free <- make([]byte, opts.PartSize)
+	}
+
+	// The first part tells whether there is more than one
+	stream := bufio.NewReader(content)
+	part := <-free
+	n, eof, err := readPart(stream, part)
+	if err != nil {
+		return fmt.Errorf("read part 1: %w", err)
+	}
+	if eof {
+		return client.Upload(ctx, key, bytes.NewReader(part[:n]))
+	}
+
+	uploadID, err := client.CreateMultipart(ctx, key)
+	if err != nil {
+		return fmt.Errorf("create multipart: %w", err)
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	var readErr error
+	for partNumber := 1; ; partNumber++ {
+		data, last := part[:n], eof
+		g.Go(func() error {
+			// The buffer is only reused once its part is sent
+			defer func() { free <- data[:cap(data)] }()
+			if err := UploadPart(gctx, client, key, uploadID, partNumber, bytes.NewReader(data), last); err != nil {
+				return fmt.Errorf("upload part %d: %w", partNumber, err)
+			}
+			return nil
+		})
+		if last {
+			break
+		}
+
+		select {
+		case part = <-free:
+		case <-gctx.Done():
+			part = nil
+		}
+		if part == nil {
+			break
+		}
+		if n, eof, readErr = readPart(stream, part); readErr != nil {
+			readErr = fmt.Errorf("read part %d: %w", partNumber+1, readErr)
+			break
+		}
+	}
+
+	err = g.Wait()
+	if err == nil {
+		err = readErr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return completeParallel(ctx, client, key, uploadID, err)
+}
+
+// readPart fills part from stream, eof reports that the stream ends with it.
+func readPart(stream *bufio.Reader, part []byte) (n int, eof bool, err error) {
+	n, err = io.ReadFull(stream, part)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, true, nil
+	}
+	if err != nil {
+		return n, false, err
+	}
+	// A full part may still be the last one
+	if _, err := stream.Peek(1); err != nil {
+		if errors.Is(err, io.EOF) {
+			return n, true, nil
+		}
+		return n, false, err
+	}
+	return n, false, nil
+}
+
+// completeParallel completes the multipart upload once its parts are sent
+// with err, or aborts it.
+func completeParallel(ctx context.Context, client Client, key, uploadID string, err error) error {
+	if err == nil {
+		err = client.CompleteMultipart(ctx, key, uploadID)
+		if err != nil {
+			err = fmt.Errorf("complete multipart: %w", err)
+		}
+	}
+	if err != nil {
+		// Abort even when ctx is why we failed, the parts would be left behind
+		if abortErr := client.AbortMultipart(context.WithoutCancel(ctx), key, uploadID); abortErr != nil && !errors.Is(abortErr, ErrNotFound) {
+			slog.Warn("failed to abort multipart upload", "key", key, "error", abortErr)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package objectstore_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/client/objectstore/memory"
+)
+
+// partsClient records the parts uploaded, and fails the part numbered failPart.
+type partsClient struct {
+	objectstore.Client
+	failPart int
+
+	mu       sync.Mutex
+	uploads  int
+	parts    int
+	inFlight int
+	maxParts int
+	aborted  bool
+}
+
+func (c *partsClient) Upload(ctx context.Context, key string, content io.Reader) error {
+	c.mu.Lock()
+	c.uploads++
+	c.mu.Unlock()
+	return c.Client.Upload(ctx, key, content)
+}
+
+func (c *partsClient) UploadPart(ctx context.Context, key, uploadID string, partNumber int, content io.Reader) error {
+	c.mu.Lock()
+	c.parts++
+	c.inFlight++
+	c.maxParts = max(c.maxParts, c.inFlight)
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+
+	if partNumber == c.failPart {
+		return errors.New("part failed")
+	}
+	return c.Client.UploadPart(ctx, key, uploadID, partNumber, content)
+}
+
+func (c *partsClient) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	c.mu.Lock()
+	c.aborted = true
+	c.mu.Unlock()
+	return c.Client.AbortMultipart(ctx, key, uploadID)
+}
+
+// upload runs UploadParallel or UploadStream.
+type upload func(ctx context.Context, client objectstore.Client, key string, content []byte, opts objectstore.ParallelOptions) error
+
+var uploads = map[string]upload{
+	"parallel": func(ctx context.Context, client objectstore.Client, key string, content []byte, opts objectstore.ParallelOptions) error {
+		return objectstore.UploadParallel(ctx, client, key, bytes.NewReader(content), int64(len(content)), opts)
+	},
+	"stream": func(ctx context.Context, client objectstore.Client, key string, content []byte, opts objectstore.ParallelOptions) error {
+		// Hide ReaderAt, a stream can only be read once
+		return objectstore.UploadStream(ctx, client, key, io.MultiReader(bytes.NewReader(content)), opts)
+	},
+}
+
+func TestUploadParallel(t *testing.T) {
+	ctx := context.Background()
+	opts := objectstore.ParallelOptions{PartSize: 100, Concurrency: 2}
+	for name, upload := range uploads {
+		t.Run(name, func(t *testing.T) {
+			for _, tt := range []struct {
+				size  int
+				parts int
+			}{
+				{0, 0},
+				{99, 0},
+				{100, 0},
+				{101, 2},
+				{300, 3},
+				{1050, 11},
+			} {
+				store, _ := memory.NewClient(memory.MemoryConfig{})
+				client := &partsClient{Client: store}
+				content := make([]byte, tt.size)
+				rand.New(rand.NewSource(int64(tt.size))).Read(content)
+
+				if err := upload(ctx, client, "key", content, opts); err != nil {
+					t.Fatalf("%d bytes: %v", tt.size, err)
+				}
+				if client.parts != tt.parts {
+					t.Fatalf("%d bytes uploaded in %d parts, want %d", tt.size, client.parts, tt.parts)
+				}
+				if tt.parts == 0 && client.uploads != 1 {
+					t.Fatalf("%d bytes uploaded in %d single uploads, want 1", tt.size, client.uploads)
+				}
+				if client.maxParts > opts.Concurrency {
+					t.Fatalf("%d parts uploaded at once, concurrency is %d", client.maxParts, opts.Concurrency)
+				}
+
+				body, err := store.Download(ctx, "key")
+				if err != nil {
+					t.Fatalf("Download: %v", err)
+				}
+				got, _ := io.ReadAll(body)
+				body.Close()
+				if !bytes.Equal(got, content) {
+					t.Fatalf("%d bytes read back wrong", tt.size)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadParallelAbort(t *testing.T) {
+	ctx := context.Background()
+	for name, upload := range uploads {
+		t.Run(name, func(t *testing.T) {
+			store, _ := memory.NewClient(memory.MemoryConfig{})
+			client := &partsClient{Client: store, failPart: 3}
+
+			err := upload(ctx, client, "key", make([]byte, 1000), objectstore.ParallelOptions{PartSize: 100, Concurrency: 2})
+			if err == nil {
+				t.Fatal("upload with a failing part succeeded")
+			}
+			if !client.aborted {
+				t.Fatal("failed upload not aborted")
+			}
+			if _, err := store.Stat(ctx, "key"); !errors.Is(err, objectstore.ErrNotFound) {
+				t.Fatalf("failed upload left an object: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// rangeReadSeeker exposes an object as an io.ReadSeekCloser. Nothing is
+// downloaded until the first Read, and a Seek to a new position reopens the
+// stream with DownloadRange, so only the bytes actually read are fetched.
+type rangeReadSeeker struct {
+	ctx    context.Context
+	client Client
+	key    string
+	size   int64
+
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewReadSeeker returns a lazy io.ReadSeekCloser over key, which must be size bytes long.
+func NewReadSeeker(ctx context.Context, client Client, key string, size int64) io.ReadSeekCloser {
+	return &rangeReadSeeker{
+		ctx:    ctx,
+		client: client,
+		key:    key,
+		size:   size,
+	}
+}
+
+func (r *rangeReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		var body io.ReadCloser
+		var err error
+		// Reading from the start uses a plain Download, which lets a cache tier
+		// tee the stream into the cache instead of fetching the object twice.
+		if r.offset == 0 {
+			body, err = r.client.Download(r.ctx, r.key)
+		} else {
+			body, err = r.client.DownloadRange(r.ctx, r.key, r.offset, -1)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("open %s at %d: %w", r.key, r.offset, err)
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *rangeReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if abs != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = abs
+	return abs, nil
+}
+
+func (r *rangeReadSeeker) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// Segment is one object in a stream stored as a sequence of objects.
+type Segment struct {
+	Key  string
+	Size int64
+	// Client reads this segment instead of the stream's client when set
+	Client Client
+}
+
+// multiReadSeeker exposes segments laid end to end as one io.ReadSeekCloser.
+// Each segment is read through a rangeReadSeeker, so it is just as lazy,
+// except that reading a segment opens the next prefetch ones in the
+// background, hiding their time to first byte behind the current one.
+type multiReadSeeker struct {
+	ctx      context.Context
+	client   Client
+	segments []Segment
+	// starts[i] is the offset of segments[i] in the stream
+	starts   []int64
+	size     int64
+	prefetch int
+
+	offset int64
+	cur    io.ReadSeekCloser
+	curIdx int
+	// pending holds the segments opened ahead, by index
+	pending map[int]*prefetched
+}
+
+// prefetched is a segment being opened ahead of the reader.
+type prefetched struct {
+	done   chan struct{}
+	body   io.ReadCloser
+	err    error
+	cancel context.CancelFunc
+}
+
+// release drops a prefetched segment the reader won't use.
+func (p *prefetched) release() {
+	p.cancel()
+	go func() {
+		<-p.done
+		if p.body != nil {
+			p.body.Close()
+		}
+	}()
+}
+
+// prefetchedBody cancels the context of a prefetched segment when closed.
+type prefetchedBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *prefetchedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// NewMultiReadSeeker returns a lazy io.ReadSeekCloser over the concatenation
+// of segments, opening up to prefetch segments ahead of the one being read.
+func NewMultiReadSeeker(ctx context.Context, client Client, segments []Segment, prefetch int) io.ReadSeekCloser {
+	starts := make([]int64, len(segments))
+	var size int64
+	for i, seg := range segments {
+		starts[i] = size
+		size += seg.Size
+	}
+
+	return &multiReadSeeker{
+		ctx:      ctx,
+		client:   client,
+		segments: segments,
+		starts:   starts,
+		size:     size,
+		prefetch: prefetch,
+		pending:  make(map[int]*prefetched),
+	}
+}
+
+func (m *multiReadSeeker) Read(p []byte) (int, error) {
+	if m.offset >= m.size {
+		return 0, io.EOF
+	}
+
+	idx := sort.Search(len(m.starts), func(i int) bool { return m.starts[i] > m.offset }) - 1
+	if m.cur == nil || m.curIdx != idx {
+		m.closeCurrent()
+		cur, err := m.openSegment(idx, m.offset-m.starts[idx])
+		if err != nil {
+			return 0, err
+		}
+		m.cur = cur
+		m.curIdx = idx
+	}
+
+	n, err := m.cur.Read(p)
+	m.offset += int64(n)
+	if errors.Is(err, io.EOF) {
+		// The end of a segment is not the end of the stream
+		if m.offset < m.starts[idx]+m.segments[idx].Size {
+			return n, fmt.Errorf("segment %s: %w", m.segments[idx].Key, io.ErrUnexpectedEOF)
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// openSegment opens segment idx at pos, taking over its prefetched stream
+// when reading from its start, and prefetches the segments after it.
+func (m *multiReadSeeker) openSegment(idx int, pos int64) (io.ReadSeekCloser, error) {
+	seg := m.segments[idx]
+	r := &rangeReadSeeker{
+		ctx:    m.ctx,
+		client: m.segmentClient(idx),
+		key:    seg.Key,
+		size:   seg.Size,
+	}
+
+	if p, ok := m.pending[idx]; ok && pos == 0 {
+		delete(m.pending, idx)
+		<-p.done
+		if p.err == nil {
+			r.body = &prefetchedBody{ReadCloser: p.body, cancel: p.cancel}
+		} else {
+			// Opened again below, reporting its own error if it still fails
+			p.cancel()
+		}
+	}
+
+	// Keep only the segments right after this one
+	for i, p := range m.pending {
+		if i <= idx || i > idx+m.prefetch {
+			p.release()
+			delete(m.pending, i)
+		}
+	}
+	for i := idx + 1; i <= idx+m.prefetch && i < len(m.segments); i++ {
+		if _, ok := m.pending[i]; !ok {
+			m.pending[i] = m.startPrefetch(i)
+		}
+	}
+
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// startPrefetch opens segment idx in the background.
+func (m *multiReadSeeker) startPrefetch(idx int) *prefetched {
+	ctx, cancel := context.WithCancel(m.ctx)
+	p := &prefetched{done: make(chan struct{}), cancel: cancel}
+	client, key := m.segmentClient(idx), m.segments[idx].Key
+	go func() {
+		defer close(p.done)
+		p.body, p.err = client.Download(ctx, key)
+	}()
+	return p
+}
+
+func (m *multiReadSeeker) segmentClient(idx int) Client {
+	if client := m.segments[idx].Client; client != nil {
+		return client
+	}
+	return m.client
+}
+
+func (m *multiReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = m.offset + offset
+	case io.SeekEnd:
+		abs = m.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	// Stay on the open segment if the new position is inside it
+	if m.cur != nil {
+		start := m.starts[m.curIdx]
+		if abs >= start && abs < start+m.segments[m.curIdx].Size {
+			if _, err := m.cur.Seek(abs-start, io.SeekStart); err != nil {
+				return 0, err
+			}
+		} else {
+			m.closeCurrent()
+		}
+	}
+	m.offset = abs
+	return abs, nil
+}
+
+func (m *multiReadSeeker) Close() error {
+	for i, p := range m.pending {
+		p.release()
+		delete(m.pending, i)
+	}
+	return m.closeCurrent()
+}
+
+func (m *multiReadSeeker) closeCurrent() error {
+	if m.cur == nil {
+		return nil
+	}
+	err := m.cur.Close()
+	m.cur = nil
+	return err
+}
@@ -0,0 +1,124 @@
+package objectstore_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/client/objectstore/memory"
+)
+
+// countingClient tracks how many downloads are open at once.
+type countingClient struct {
+	objectstore.Client
+
+	mu      sync.Mutex
+	open    int
+	maxOpen int
+}
+
+func (c *countingClient) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, err := c.Client.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.open++
+	c.maxOpen = max(c.maxOpen, c.open)
+	c.mu.Unlock()
+	return &countedBody{ReadCloser: body, client: c}, nil
+}
+
+type countedBody struct {
+	io.ReadCloser
+	client *countingClient
+	once   sync.Once
+}
+
+func (b *countedBody) Close() error {
+	b.once.Do(func() {
+		b.client.mu.Lock()
+		b.client.open--
+		b.client.mu.Unlock()
+	})
+	return b.ReadCloser.Close()
+}
+
+func newSegments(t *testing.T, n int) (*countingClient, []objectstore.Segment, []byte) {
+	t.Helper()
+	backend, err := memory.NewClient(memory.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("memory.NewClient: %v", err)
+	}
+
+	var segments []objectstore.Segment
+	var all []byte
+	for i := range n {
+		content := bytes.Repeat([]byte{byte('a' + i)}, 100+i)
+		key := fmt.Sprintf("chunks/%d", i)
+		if err := backend.Upload(context.Background(), key, bytes.NewReader(content)); err != nil {
+			t.Fatalf("Upload: %v", err)
+		}
+		segments = append(segments, objectstore.Segment{Key: key, Size: int64(len(content))})
+		all = append(all, content...)
+	}
+	return &countingClient{Client: backend}, segments, all
+}
+
+func TestMultiReadSeekerPrefetch(t *testing.T) {
+	for _, prefetch := range []int{0, 1, 3} {
+		t.Run(fmt.Sprint(prefetch), func(t *testing.T) {
+			client, segments, want := newSegments(t, 8)
+			reader := objectstore.NewMultiReadSeeker(context.Background(), client, segments, prefetch)
+
+			// Small reads, so segments are crossed mid-read
+			var got []byte
+			buf := make([]byte, 37)
+			for {
+				n, err := reader.Read(buf)
+				got = append(got, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Read: %v", err)
+				}
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("read %d bytes, want %d", len(got), len(want))
+			}
+
+			if err := reader.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			// The segment being read plus the ones opened ahead of it
+			if client.maxOpen > prefetch+1 {
+				t.Fatalf("%d downloads open at once, want at most %d", client.maxOpen, prefetch+1)
+			}
+		})
+	}
+}
+
+func TestMultiReadSeekerSeek(t *testing.T) {
+	client, segments, want := newSegments(t, 6)
+	reader := objectstore.NewMultiReadSeeker(context.Background(), client, segments, 2)
+	defer reader.Close()
+
+	// Forward into a later segment, back into an earlier one, then to the end
+	for _, offset := range []int64{350, 20, 510, int64(len(want)) - 5} {
+		if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+			t.Fatalf("Seek(%d): %v", offset, err)
+		}
+		got := make([]byte, 5)
+		if _, err := io.ReadFull(reader, got); err != nil {
+			t.Fatalf("read at %d: %v", offset, err)
+		}
+		if !bytes.Equal(got, want[offset:offset+5]) {
+			t.Fatalf("read at %d = %q, want %q", offset, got, want[offset:offset+5])
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package replica
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// health tracks how a replica has been answering, to order reads.
+type health struct {
+	mu       sync.Mutex
+	failures int
+	// latency is a moving average of successful call latencies
+	latency time.Duration
+}
+
+func (h *health) success(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.failures = 0
+	if h.latency == 0 {
+		h.latency = d
+	} else {
+		h.latency = (h.latency*7 + d) / 8
+	}
+}
+
+// ok resets the failure count without a latency sample, for writes.
+func (h *health) ok() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.failures = 0
+}
+
+func (h *health) failure() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.failures++
+}
+
+func (h *health) snapshot() (int, time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.failures, h.latency
+}
+
+// byHealth orders replicas by consecutive failures, then latency. Replicas
+// with no recorded latency yet go first among equals so they get measured.
+func byHealth(replicas []*replica) []*replica {
+	type scored struct {
+		r        *replica
+		failures int
+		latency  time.Duration
+	}
+	scores := make([]scored, len(replicas))
+	for i, r := range replicas {
+		failures, latency := r.health.snapshot()
+		scores[i] = scored{r: r, failures: failures, latency: latency}
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].failures != scores[j].failures {
+			return scores[i].failures < scores[j].failures
+		}
+		return scores[i].latency < scores[j].latency
+	})
+
+	ordered := make([]*replica, len(scores))
+	for i, s := range scores {
+		ordered[i] = s.r
+	}
+	return ordered
+}
@@ -0,0 +1,486 @@
+package replica
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+)
+
+var errQuorumLost = errors.New("write quorum lost")
+
+// Replica is a named backend of a ReplicaClient.
+type Replica struct {
+	Name   string
+	Client objectstore.Client
+}
+
+// ReplicaConfig configures the replicating objectstore client.
+type ReplicaConfig struct {
+	// Replicas are the backends every object is written to.
+	Replicas []Replica
+	// WriteQuorum is the number of replicas a write must succeed on, 0 means all of them.
+	WriteQuorum int
+}
+
+type replica struct {
+	name   string
+	client objectstore.Client
+	health health
+}
+
+// ReplicaClient writes every object to all replicas and reads from the
+// healthiest one that has it. Writes stream to all replicas at once through
+// pipes, at the pace of the slowest, and succeed once WriteQuorum replicas
+// have the object. Pipes can't be rewound, so a replica write is a single
+// attempt, nothing is buffered to retry it. Replicas that missed a write are
+// caught up by RepairObject.
+type ReplicaClient struct {
+	replicas []*replica
+	quorum   int
+
+	// broken holds, per multipart upload ID, the replicas that failed a part
+	broken sync.Map // map[string]*sync.Map (map[int]struct{})
+}
+
+// NewReplicaClient creates a new replicating objectstore client.
+func NewReplicaClient(cfg ReplicaConfig) (*ReplicaClient, error) {
+	if len(cfg.Replicas) == 0 {
+		return nil, fmt.Errorf("at least one replica is required")
+	}
+	quorum := cfg.WriteQuorum
+	if quorum == 0 {
+		quorum = len(cfg.Replicas)
+	}
+	if quorum < 0 || quorum > len(cfg.Replicas) {
+		return nil, fmt.Errorf("write quorum must be between 1 and %d, got %d", len(cfg.Replicas), cfg.WriteQuorum)
+	}
+
+	names := make(map[string]bool, len(cfg.Replicas))
+	replicas := make([]*replica, len(cfg.Replicas))
+	for i, r := range cfg.Replicas {
+		if r.Client == nil {
+			return nil, fmt.Errorf("replica %s: client is required", r.Name)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate replica name %s", r.Name)
+		}
+		names[r.Name] = true
+		replicas[i] = &replica{name: r.Name, client: r.Client}
+	}
+
+	return &ReplicaClient{
+		replicas: replicas,
+		quorum:   quorum,
+	}, nil
+}
+
+// fanWriter copies writes to every pipe still accepting them.
+type fanWriter struct {
+	writers []*io.PipeWriter
+	failed  []bool
+	quorum  int
+}
+
+func (f *fanWriter) Write(p []byte) (int, error) {
+	live := 0
+	for i, w := range f.writers {
+		if f.failed[i] {
+			continue
+		}
+		if _, err := w.Write(p); err != nil {
+			// The replica upload failed and closed its end
+			f.failed[i] = true
+			continue
+		}
+		live++
+	}
+	if live < f.quorum {
+		return 0, errQuorumLost
+	}
+	return len(p), nil
+}
+
+// fanOut streams content to upload on each of targets concurrently and
+// returns the error of each. Each target reads from a pipe, so content is
+// never held in memory or on disk beyond the write in flight.
+func (c *ReplicaClient) fanOut(content io.Reader, targets []int, upload func(r *replica, body io.Reader) error) []error {
+	errs := make([]error, len(targets))
+	writers := make([]*io.PipeWriter, len(targets))
+
+	var wg sync.WaitGroup
+	for i, idx := range targets {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := upload(c.replicas[idx], pr)
+			errs[i] = err
+			// Unblock the writer if the upload stopped reading early
+			if err != nil {
+				pr.CloseWithError(err)
+			} else {
+				pr.Close()
+			}
+		}()
+	}
+
+	fan := &fanWriter{writers: writers, failed: make([]bool, len(writers)), quorum: c.quorum}
+	_, copyErr := io.Copy(fan, content)
+	for _, pw := range writers {
+		if copyErr != nil {
+			pw.CloseWithError(copyErr)
+		} else {
+			pw.Close()
+		}
+	}
+	wg.Wait()
+
+	// A source error fails every replica, even those that saw EOF first
+	if copyErr != nil && !errors.Is(copyErr, errQuorumLost) {
+		for i := range errs {
+			errs[i] = fmt.Errorf("read content: %w", copyErr)
+		}
+	}
+	return errs
+}
+
+// checkQuorum turns per replica write errors into the result of the write.
+func (c *ReplicaClient) checkQuorum(op, key string, targets []int, errs []error) error {
+	succeeded := 0
+	var failed []error
+	for i, err := range errs {
+		r := c.replicas[targets[i]]
+		if err == nil {
+			r.health.ok()
+			succeeded++
+			continue
+		}
+		r.health.failure()
+		failed = append(failed, fmt.Errorf("%s: %w", r.name, err))
+	}
+
+	if succeeded < c.quorum {
+		return fmt.Errorf("%s %s: %d of %d replicas succeeded, %d needed: %w", op, key, succeeded, len(targets), c.quorum, errors.Join(failed...))
+	}
+	if len(failed) > 0 {
+		slog.Warn("object is under-replicated until repaired", "op", op, "key", key, "error", errors.Join(failed...))
+	}
+	return nil
+}
+
+func (c *ReplicaClient) all() []int {
+	targets := make([]int, len(c.replicas))
+	for i := range targets {
+		targets[i] = i
+	}
+	return targets
+}
+
+// read tries fn on each replica, healthiest first, until one succeeds.
+func read[T any](ctx context.Context, c *ReplicaClient, op, key string, fn func(r *replica) (T, error)) (T, error) {
+	var zero T
+	var errs []error
+	notFound := 0
+	for _, r := range byHealth(c.replicas) {
+		start := time.Now()
+		result, err := fn(r)
+		if err == nil {
+			r.health.success(time.Since(start))
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return zero, ctx.Err()
+		}
+		if errors.Is(err, objectstore.ErrNotFound) {
+			// Missing here is a replication gap, not a health problem
+			notFound++
+			continue
+		}
+		r.health.failure()
+		errs = append(errs, fmt.Errorf("%s: %w", r.name, err))
+	}
+
+	if notFound == len(c.replicas) {
+		return zero, fmt.Errorf("%s %s: %w", op, key, objectstore.ErrNotFound)
+	}
+	return zero, fmt.Errorf("%s %s: %w", op, key, errors.Join(errs...))
+}
+
+// CreateMultipart starts a multipart upload on every replica. The returned ID
+// encodes the upload ID of each replica.
+func (c *ReplicaClient) CreateMultipart(ctx context.Context, key string) (string, error) {
+	ids := make([]string, len(c.replicas))
+	errs := make([]error, len(c.replicas))
+
+	var wg sync.WaitGroup
+	for i, r := range c.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids[i], errs[i] = r.client.CreateMultipart(ctx, key)
+		}()
+	}
+	wg.Wait()
+
+	if err := c.checkQuorum("create multipart", key, c.all(), errs); err != nil {
+		for i, r := range c.replicas {
+			if ids[i] != "" {
+				r.client.AbortMultipart(ctx, key, ids[i])
+			}
+		}
+		return "", err
+	}
+
+	encoded, err := json.Marshal(ids)
+	if err != nil {
+		return "", fmt.Errorf("encode upload id: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func (c *ReplicaClient) decodeUploadID(uploadID string) ([]string, error) {
+	encoded, err := base64.RawURLEncoding.DecodeString(uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("decode upload id: %w", err)
+	}
+	var ids []string
+	if err := json.Unmarshal(encoded, &ids); err != nil {
+		return nil, fmt.Errorf("decode upload id: %w", err)
+	}
+	if len(ids) != len(c.replicas) {
+		return nil, fmt.Errorf("upload id has %d replicas, expected %d", len(ids), len(c.replicas))
+	}
+	return ids, nil
+}
+
+// brokenSet returns the replicas that failed a part of uploadID.
+func (c *ReplicaClient) brokenSet(uploadID string) *sync.Map {
+	set, _ := c.broken.LoadOrStore(uploadID, &sync.Map{})
+	return set.(*sync.Map)
+}
+
+// activeTargets returns the replicas still taking part in a multipart upload.
+func (c *ReplicaClient) activeTargets(uploadID string, ids []string) []int {
+	broken := c.brokenSet(uploadID)
+	var targets []int
+	for i, id := range ids {
+		if _, ok := broken.Load(i); id != "" && !ok {
+			targets = append(targets, i)
+		}
+	}
+	return targets
+}
+
+// UploadPart streams a part to every replica in the upload. A replica that
+// fails a part is left out of the rest of the upload.
+func (c *ReplicaClient) UploadPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	content io.Reader,
+) error {
+	ids, err := c.decodeUploadID(uploadID)
+	if err != nil {
+		return err
+	}
+
+	targets := c.activeTargets(uploadID, ids)
+	errs := c.fanOut(content, targets, func(r *replica, body io.Reader) error {
+		idx := c.indexOf(r)
+		return r.client.UploadPart(ctx, key, ids[idx], partNumber, body)
+	})
+
+	broken := c.brokenSet(uploadID)
+	for i, err := range errs {
+		if err != nil {
+			broken.Store(targets[i], struct{}{})
+		}
+	}
+	return c.checkQuorum("upload part", key, targets, errs)
+}
+
+// CompleteMultipart completes the upload on every replica that got all parts
+// and aborts it on the others.
+func (c *ReplicaClient) CompleteMultipart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	ids, err := c.decodeUploadID(uploadID)
+	if err != nil {
+		return err
+	}
+	defer c.broken.Delete(uploadID)
+
+	targets := c.activeTargets(uploadID, ids)
+	for i, id := range ids {
+		if id != "" && !contains(targets, i) {
+			c.replicas[i].client.AbortMultipart(ctx, key, id)
+		}
+	}
+
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, idx := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.replicas[idx].client.CompleteMultipart(ctx, key, ids[idx])
+		}()
+	}
+	wg.Wait()
+
+	return c.checkQuorum("complete multipart", key, targets, errs)
+}
+
+// AbortMultipart aborts the upload on every replica.
+func (c *ReplicaClient) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	ids, err := c.decodeUploadID(uploadID)
+	if err != nil {
+		return err
+	}
+	defer c.broken.Delete(uploadID)
+
+	var errs []error
+	for i, id := range ids {
+		if id == "" {
+			continue
+		}
+		if err := c.replicas[i].client.AbortMultipart(ctx, key, id); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.replicas[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Upload streams content to every replica.
+func (c *ReplicaClient) Upload(ctx context.Context, key string, content io.Reader) error {
+	targets := c.all()
+	errs := c.fanOut(content, targets, func(r *replica, body io.Reader) error {
+		return r.client.Upload(ctx, key, body)
+	})
+	return c.checkQuorum("upload", key, targets, errs)
+}
+
+// Download downloads from the healthiest replica that has the object.
+func (c *ReplicaClient) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	return read(ctx, c, "download", key, func(r *replica) (io.ReadCloser, error) {
+		return r.client.Download(ctx, key)
+	})
+}
+
+// DownloadRange downloads a range from the healthiest replica that has the object.
+func (c *ReplicaClient) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := objectstore.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+
+	return read(ctx, c, "download range", key, func(r *replica) (io.ReadCloser, error) {
+		return r.client.DownloadRange(ctx, key, offset, length)
+	})
+}
+
+// Delete deletes the object from every replica.
+func (c *ReplicaClient) Delete(ctx context.Context, key string) error {
+	errs := make([]error, len(c.replicas))
+	var wg sync.WaitGroup
+	for i, r := range c.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.client.Delete(ctx, key); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", r.name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Stat returns metadata from the healthiest replica that has the object.
+func (c *ReplicaClient) Stat(ctx context.Context, key string) (objectstore.ObjectInfo, error) {
+	return read(ctx, c, "stat", key, func(r *replica) (objectstore.ObjectInfo, error) {
+		return r.client.Stat(ctx, key)
+	})
+}
+
+// List lists the healthiest replica. It may miss objects not yet repaired there.
+func (c *ReplicaClient) List(ctx context.Context, prefix string) objectstore.ObjectIterator {
+	return byHealth(c.replicas)[0].client.List(ctx, prefix)
+}
+
+// RepairObject copies key to every replica missing it, from the healthiest
+// replica that has it. It returns the number of replicas repaired.
+func (c *ReplicaClient) RepairObject(ctx context.Context, key string) (int, error) {
+	var source *replica
+	var missing []*replica
+	for _, r := range byHealth(c.replicas) {
+		_, err := r.client.Stat(ctx, key)
+		switch {
+		case err == nil:
+			if source == nil {
+				source = r
+			}
+		case errors.Is(err, objectstore.ErrNotFound):
+			missing = append(missing, r)
+		default:
+			return 0, fmt.Errorf("stat on %s: %w", r.name, err)
+		}
+	}
+
+	if len(missing) == 0 {
+		return 0, nil
+	}
+	if source == nil {
+		return 0, fmt.Errorf("repair %s: no replica has it: %w", key, objectstore.ErrNotFound)
+	}
+
+	repaired := 0
+	for _, r := range missing {
+		if err := copyObject(ctx, source, r, key); err != nil {
+			return repaired, fmt.Errorf("copy %s from %s to %s: %w", key, source.name, r.name, err)
+		}
+		repaired++
+	}
+	return repaired, nil
+}
+
+func copyObject(ctx context.Context, from, to *replica, key string) error {
+	body, err := from.client.Download(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return to.client.Upload(ctx, key, body)
+}
+
+func (c *ReplicaClient) indexOf(r *replica) int {
+	for i, candidate := range c.replicas {
+		if candidate == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func contains(targets []int, i int) bool {
+	for _, t := range targets {
+		if t == i {
+			return true
+		}
+	}
+	return false
+}
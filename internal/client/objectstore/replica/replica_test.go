@@ -0,0 +1,101 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/client/objectstore/memory"
+	"github.com/beanbocchi/templar/internal/client/objectstore/resilient"
+)
+
+func newTestReplicas(t *testing.T, n int) (*ReplicaClient, []*memory.ClientImpl) {
+	t.Helper()
+	backends := make([]*memory.ClientImpl, n)
+	replicas := make([]Replica, n)
+	for i := range replicas {
+		backend, err := memory.NewClient(memory.MemoryConfig{})
+		if err != nil {
+			t.Fatalf("memory.NewClient: %v", err)
+		}
+		client, err := resilient.NewResilientClient(resilient.ResilientConfig{
+			Client:           backend,
+			MaxRetries:       2,
+			BaseDelay:        time.Millisecond,
+			MaxDelay:         time.Millisecond,
+			FailureThreshold: 1,
+			Cooldown:         time.Minute,
+		})
+		if err != nil {
+			t.Fatalf("NewResilientClient: %v", err)
+		}
+		backends[i] = backend
+		replicas[i] = Replica{Name: string(rune('a' + i)), Client: client}
+	}
+
+	client, err := NewReplicaClient(ReplicaConfig{Replicas: replicas})
+	if err != nil {
+		t.Fatalf("NewReplicaClient: %v", err)
+	}
+	return client, backends
+}
+
+func TestUploadStreamsToEveryReplica(t *testing.T) {
+	ctx := context.Background()
+	client, backends := newTestReplicas(t, 3)
+	content := strings.Repeat("templar", 10000)
+
+	// A reader that can't seek goes through the pipes in a single pass
+	if err := client.Upload(ctx, "blob", io.MultiReader(strings.NewReader(content))); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	for i, backend := range backends {
+		body, err := backend.Download(ctx, "blob")
+		if err != nil {
+			t.Fatalf("replica %d: Download: %v", i, err)
+		}
+		got, _ := io.ReadAll(body)
+		body.Close()
+		if string(got) != content {
+			t.Fatalf("replica %d has %d bytes, want %d", i, len(got), len(content))
+		}
+	}
+}
+
+func TestNotFoundKeepsReplicasHealthy(t *testing.T) {
+	ctx := context.Background()
+	client, backends := newTestReplicas(t, 2)
+
+	if _, err := client.Download(ctx, "missing"); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("Download error = %v, want ErrNotFound", err)
+	}
+	if _, err := client.DownloadRange(ctx, "missing", 1, 2); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("DownloadRange error = %v, want ErrNotFound", err)
+	}
+	for _, r := range client.replicas {
+		if failures, _ := r.health.snapshot(); failures != 0 {
+			t.Fatalf("replica %s has %d failures after not found reads", r.name, failures)
+		}
+	}
+
+	// A replication gap reads from the replica that has the object, and the
+	// resilient breaker (threshold 1) stays closed on the one that doesn't
+	if err := backends[1].Upload(ctx, "gap", strings.NewReader("data")); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	for range 2 {
+		body, err := client.Download(ctx, "gap")
+		if err != nil {
+			t.Fatalf("Download: %v", err)
+		}
+		body.Close()
+	}
+	if _, err := client.replicas[0].client.Stat(ctx, "gap"); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("Stat on the replica missing the object = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,98 @@
+package resilient
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeIgnored is a call that says nothing about the store, e.g. canceled by the caller
+	outcomeIgnored
+)
+
+// breaker is a consecutive-failure circuit breaker. After threshold failed
+// calls in a row it opens and rejects calls for cooldown, then lets a single
+// probe through: success closes it, failure opens it again.
+type breaker struct {
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int
+	cooldown  time.Duration
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow reports whether a call may go through. Every allowed call must be
+// followed by record.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = stateHalfOpen
+		b.probing = true
+		return true
+	case stateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// isOpen reports whether calls are currently rejected.
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == stateOpen && time.Since(b.openedAt) < b.cooldown
+}
+
+func (b *breaker) record(o outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch o {
+	case outcomeSuccess:
+		b.state = stateClosed
+		b.failures = 0
+		b.probing = false
+	case outcomeFailure:
+		b.failures++
+		if b.state == stateHalfOpen || b.failures >= b.threshold {
+			b.state = stateOpen
+			b.openedAt = time.Now()
+			b.probing = false
+		}
+	default:
+		// Let the next call probe instead
+		b.probing = false
+	}
+}
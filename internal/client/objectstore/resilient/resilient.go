@@ -0,0 +1,322 @@
+package resilient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"time"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/model"
+)
+
+// ResilientConfig configures the retrying objectstore wrapper.
+type ResilientConfig struct {
+	// Client is the underlying objectstore client, usually a remote primary.
+	Client objectstore.Client
+	// MaxRetries is the number of retries after the first attempt of a call.
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry, doubled on each retry up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Timeout bounds each attempt. For downloads it bounds opening the stream, not reading it. 0 means none.
+	Timeout time.Duration
+	// UploadTimeout bounds each upload attempt, body included. 0 means none.
+	UploadTimeout time.Duration
+	// FailureThreshold is the number of consecutive failed calls that opens the breaker.
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before letting a probe call through.
+	Cooldown time.Duration
+}
+
+// ResilientClient wraps an objectstore client with retries (exponential
+// backoff with jitter), per attempt timeouts and a circuit breaker. While the
+// breaker is open, calls fail immediately with model.ErrStoreUnavailable.
+//
+// Uploads of seekable content are retried from the start after rewinding it.
+// Anything else can only be read once, so it is streamed in a single attempt.
+type ResilientClient struct {
+	client        objectstore.Client
+	maxRetries    int
+	baseDelay     time.Duration
+	maxDelay      time.Duration
+	timeout       time.Duration
+	uploadTimeout time.Duration
+	breaker       *breaker
+}
+
+// NewResilientClient creates a new retrying objectstore client wrapper.
+func NewResilientClient(cfg ResilientConfig) (*ResilientClient, error) {
+	if cfg.Client == nil {
+		return nil, fmt.Errorf("client is required")
+	}
+	if cfg.MaxRetries < 0 {
+		return nil, fmt.Errorf("max retries must not be negative")
+	}
+	if cfg.BaseDelay <= 0 || cfg.MaxDelay < cfg.BaseDelay {
+		return nil, fmt.Errorf("delays must satisfy 0 < base delay <= max delay")
+	}
+	if cfg.FailureThreshold < 1 {
+		return nil, fmt.Errorf("failure threshold must be at least 1")
+	}
+
+	return &ResilientClient{
+		client:        cfg.Client,
+		maxRetries:    cfg.MaxRetries,
+		baseDelay:     cfg.BaseDelay,
+		maxDelay:      cfg.MaxDelay,
+		timeout:       cfg.Timeout,
+		uploadTimeout: cfg.UploadTimeout,
+		breaker:       newBreaker(cfg.FailureThreshold, cfg.Cooldown),
+	}, nil
+}
+
+// retry runs attempt until it succeeds, fails permanently or runs out of
+// retries, and records the outcome on the breaker.
+func retry[T any](c *ResilientClient, ctx context.Context, attempt func(ctx context.Context) (T, error)) (T, error) {
+	return retryN(c, ctx, c.maxRetries, attempt)
+}
+
+// retryN is retry with at most retries retries.
+func retryN[T any](c *ResilientClient, ctx context.Context, retries int, attempt func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	if !c.breaker.allow() {
+		return zero, model.ErrStoreUnavailable
+	}
+
+	var result T
+	var err error
+	for n := 0; ; n++ {
+		result, err = attempt(ctx)
+		if err == nil || !retryable(ctx, err) || n == retries || c.breaker.isOpen() {
+			break
+		}
+
+		timer := time.NewTimer(c.backoff(n))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	switch {
+	case err == nil, !failure(err):
+		// A missing object or a bad range is an answer, the store is up
+		c.breaker.record(outcomeSuccess)
+	case ctx.Err() != nil:
+		c.breaker.record(outcomeIgnored)
+	default:
+		c.breaker.record(outcomeFailure)
+	}
+
+	return result, err
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return failure(err)
+}
+
+// failure reports whether err is a failure of the store, rather than an
+// answer that retrying can't change.
+func failure(err error) bool {
+	return !errors.Is(err, objectstore.ErrNotFound) && !errors.Is(err, objectstore.ErrInvalidRange)
+}
+
+// backoff returns the delay before retry n, with jitter in [d/2, d).
+func (c *ResilientClient) backoff(n int) time.Duration {
+	d := c.maxDelay
+	if n < 30 {
+		d = min(c.baseDelay<<n, c.maxDelay)
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// call runs op with the timeout applied.
+func call(ctx context.Context, timeout time.Duration, op func(ctx context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return op(ctx)
+}
+
+// open runs a download with the timeout applied until the stream is open. The
+// stream keeps using the context, so it is only canceled when closed.
+func open(ctx context.Context, timeout time.Duration, op func(ctx context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if timeout <= 0 {
+		return op(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(timeout, cancel)
+	body, err := op(ctx)
+	if !timer.Stop() {
+		if body != nil {
+			body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("open stream: %w", context.DeadlineExceeded)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &cancelReadCloser{ReadCloser: body, cancel: cancel}, nil
+}
+
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.cancel()
+	return err
+}
+
+// upload retries op with content rewound before each attempt. Content that
+// can't be rewound is uploaded once, as retrying would need a copy of it.
+func (c *ResilientClient) upload(ctx context.Context, content io.Reader, op func(ctx context.Context, body io.Reader) error) error {
+	retries, rewind := 0, func() error { return nil }
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			retries = c.maxRetries
+			rewind = func() error {
+				_, err := seeker.Seek(start, io.SeekStart)
+				return err
+			}
+		}
+	}
+
+	_, err := retryN(c, ctx, retries, func(ctx context.Context) (struct{}, error) {
+		if err := rewind(); err != nil {
+			return struct{}{}, fmt.Errorf("rewind content: %w", err)
+		}
+		return struct{}{}, call(ctx, c.uploadTimeout, func(ctx context.Context) error {
+			return op(ctx, content)
+		})
+	})
+	return err
+}
+
+// exec retries an operation without a result.
+func (c *ResilientClient) exec(ctx context.Context, op func(ctx context.Context) error) error {
+	_, err := retry(c, ctx, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, call(ctx, c.timeout, op)
+	})
+	return err
+}
+
+// CreateMultipart starts a multipart upload with retries.
+func (c *ResilientClient) CreateMultipart(ctx context.Context, key string) (string, error) {
+	return retry(c, ctx, func(ctx context.Context) (string, error) {
+		var uploadID string
+		err := call(ctx, c.timeout, func(ctx context.Context) error {
+			var err error
+			uploadID, err = c.client.CreateMultipart(ctx, key)
+			return err
+		})
+		return uploadID, err
+	})
+}
+
+// UploadPart uploads a single part with retries.
+func (c *ResilientClient) UploadPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	content io.Reader,
+) error {
+	return c.upload(ctx, content, func(ctx context.Context, body io.Reader) error {
+		return c.client.UploadPart(ctx, key, uploadID, partNumber, body)
+	})
+}
+
+// CompleteMultipart finalizes a multipart upload with retries.
+func (c *ResilientClient) CompleteMultipart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	return c.exec(ctx, func(ctx context.Context) error {
+		return c.client.CompleteMultipart(ctx, key, uploadID)
+	})
+}
+
+// AbortMultipart cancels a multipart upload with retries.
+func (c *ResilientClient) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	return c.exec(ctx, func(ctx context.Context) error {
+		return c.client.AbortMultipart(ctx, key, uploadID)
+	})
+}
+
+// Upload uploads an object with retries.
+func (c *ResilientClient) Upload(ctx context.Context, key string, content io.Reader) error {
+	return c.upload(ctx, content, func(ctx context.Context, body io.Reader) error {
+		return c.client.Upload(ctx, key, body)
+	})
+}
+
+// Download opens an object with retries. Errors while reading the stream are not retried.
+func (c *ResilientClient) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	return retry(c, ctx, func(ctx context.Context) (io.ReadCloser, error) {
+		return open(ctx, c.timeout, func(ctx context.Context) (io.ReadCloser, error) {
+			return c.client.Download(ctx, key)
+		})
+	})
+}
+
+// DownloadRange opens a byte range with retries. Errors while reading the stream are not retried.
+func (c *ResilientClient) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := objectstore.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+
+	return retry(c, ctx, func(ctx context.Context) (io.ReadCloser, error) {
+		return open(ctx, c.timeout, func(ctx context.Context) (io.ReadCloser, error) {
+			return c.client.DownloadRange(ctx, key, offset, length)
+		})
+	})
+}
+
+// Delete deletes an object with retries.
+func (c *ResilientClient) Delete(ctx context.Context, key string) error {
+	return c.exec(ctx, func(ctx context.Context) error {
+		return c.client.Delete(ctx, key)
+	})
+}
+
+// Stat returns object metadata with retries.
+func (c *ResilientClient) Stat(ctx context.Context, key string) (objectstore.ObjectInfo, error) {
+	return retry(c, ctx, func(ctx context.Context) (objectstore.ObjectInfo, error) {
+		var info objectstore.ObjectInfo
+		err := call(ctx, c.timeout, func(ctx context.Context) error {
+			var err error
+			info, err = c.client.Stat(ctx, key)
+			return err
+		})
+		return info, err
+	})
+}
+
+// List lists objects on the wrapped client. Listing is paged by the backend,
+// so it isn't retried, but it fails fast while the breaker is open.
+func (c *ResilientClient) List(ctx context.Context, prefix string) objectstore.ObjectIterator {
+	if c.breaker.isOpen() {
+		return objectstore.NewErrorIterator(model.ErrStoreUnavailable)
+	}
+	return c.client.List(ctx, prefix)
+}
@@ -0,0 +1,350 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+)
+
+// listPageSize is the number of keys requested per ListObjectsV2 call.
+const listPageSize = 1000
+
+// defaultPartSize is the buffer size used by Upload for streams of unknown length.
+const defaultPartSize = 16 * 1024 * 1024
+
+type ClientImpl struct {
+	client   *minio.Client
+	core     minio.Core
+	bucket   string
+	partSize uint64
+}
+
+type S3Config struct {
+	// Endpoint is the URL of the S3-compatible API, e.g. http://localhost:9000 or https://gateway.storjshare.io
+	Endpoint string
+	// Region is the bucket region, may be empty for MinIO
+	Region string
+	// Bucket is the bucket name where objects will be stored
+	Bucket string
+	// AccessKeyID and SecretAccessKey are the static credentials used to sign requests
+	AccessKeyID     string
+	SecretAccessKey string
+	// UsePathStyle forces path-style addressing (http://host/bucket/key), required by most local stand-ins
+	UsePathStyle bool
+	// PartSize is the part size in bytes used when streaming uploads of unknown length
+	PartSize int64
+}
+
+// NewClient creates a new S3-compatible objectstore client
+func NewClient(ctx context.Context, cfg S3Config) (*ClientImpl, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("endpoint is required")
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("bucket name is required")
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+	if endpoint.Host == "" {
+		return nil, fmt.Errorf("endpoint must include a scheme and host: %s", cfg.Endpoint)
+	}
+
+	lookup := minio.BucketLookupAuto
+	if cfg.UsePathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure:       endpoint.Scheme == "https",
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create client: %w", err)
+	}
+
+	// Ensure bucket exists
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("check bucket: %w", err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("make bucket: %w", err)
+		}
+	}
+
+	partSize := uint64(defaultPartSize)
+	if cfg.PartSize > 0 {
+		partSize = uint64(cfg.PartSize)
+	}
+
+	return &ClientImpl{
+		client:   client,
+		core:     minio.Core{Client: client},
+		bucket:   cfg.Bucket,
+		partSize: partSize,
+	}, nil
+}
+
+// CreateMultipart starts an S3 multipart upload and returns its upload ID.
+func (c *ClientImpl) CreateMultipart(ctx context.Context, key string) (string, error) {
+	uploadID, err := c.core.NewMultipartUpload(ctx, c.bucket, key, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return "", fmt.Errorf("new multipart upload: %w", err)
+	}
+
+	return uploadID, nil
+}
+
+// UploadPart uploads a single part. S3 requires the part length up front, so
+// content that is not seekable is spooled to a temporary file first.
+func (c *ClientImpl) UploadPart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+	partNumber int,
+	content io.Reader,
+) error {
+	body, size, cleanup, err := sizedReader(content)
+	if err != nil {
+		return fmt.Errorf("prepare part: %w", err)
+	}
+	defer cleanup()
+
+	if _, err := c.core.PutObjectPart(ctx, c.bucket, key, uploadID, partNumber, body, size, minio.PutObjectPartOptions{}); err != nil {
+		return multipartError("put object part", uploadID, err)
+	}
+
+	return nil
+}
+
+// CompleteMultipart finalizes the multipart upload. The parts and their ETags
+// are looked up from S3 since the objectstore interface doesn't carry them.
+func (c *ClientImpl) CompleteMultipart(
+	ctx context.Context,
+	key string,
+	uploadID string,
+) error {
+	var parts []minio.CompletePart
+	marker := 0
+	for {
+		result, err := c.core.ListObjectParts(ctx, c.bucket, key, uploadID, marker, 1000)
+		if err != nil {
+			return multipartError("list object parts", uploadID, err)
+		}
+		for _, part := range result.ObjectParts {
+			parts = append(parts, minio.CompletePart{
+				PartNumber: part.PartNumber,
+				ETag:       part.ETag,
+			})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+
+	if len(parts) == 0 {
+		return fmt.Errorf("no parts found")
+	}
+
+	if _, err := c.core.CompleteMultipartUpload(ctx, c.bucket, key, uploadID, parts, minio.PutObjectOptions{}); err != nil {
+		return multipartError("complete multipart upload", uploadID, err)
+	}
+
+	return nil
+}
+
+// AbortMultipart cancels the multipart upload and discards uploaded parts.
+func (c *ClientImpl) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	if err := c.core.AbortMultipartUpload(ctx, c.bucket, key, uploadID); err != nil {
+		return fmt.Errorf("abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+// Upload uploads an object, streaming it in PartSize chunks when the length is unknown
+func (c *ClientImpl) Upload(ctx context.Context, key string, content io.Reader) error {
+	if _, err := c.client.PutObject(ctx, c.bucket, key, content, -1, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    c.partSize,
+	}); err != nil {
+		return fmt.Errorf("put object: %w", err)
+	}
+
+	return nil
+}
+
+// Download downloads an object
+func (c *ClientImpl) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := c.client.GetObject(ctx, c.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get object: %w", err)
+	}
+
+	// GetObject is lazy, stat it so a missing key fails here rather than on first Read
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, statError(key, err)
+	}
+
+	return object, nil
+}
+
+// DownloadRange downloads part of an object using a Range request
+func (c *ClientImpl) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := objectstore.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+
+	opts := minio.GetObjectOptions{}
+	switch {
+	case length > 0:
+		if err := opts.SetRange(offset, offset+length-1); err != nil {
+			return nil, fmt.Errorf("set range: %w", err)
+		}
+	case offset > 0:
+		// An end of 0 means "to the end" for SetRange
+		if err := opts.SetRange(offset, 0); err != nil {
+			return nil, fmt.Errorf("set range: %w", err)
+		}
+	}
+
+	// Object.Stat drops the Range header, so issue the GET eagerly instead
+	object, _, _, err := c.core.GetObject(ctx, c.bucket, key, opts)
+	if err != nil {
+		return nil, statError(key, err)
+	}
+
+	return object, nil
+}
+
+// Delete deletes an object
+func (c *ClientImpl) Delete(ctx context.Context, key string) error {
+	if err := c.client.RemoveObject(ctx, c.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("remove object: %w", err)
+	}
+	return nil
+}
+
+// GetURL presigns a GET of key, valid for expiry (at most 7 days).
+func (c *ClientImpl) GetURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := c.client.PresignedGetObject(ctx, c.bucket, key, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("presign get: %w", err)
+	}
+	return u.String(), nil
+}
+
+// Stat returns object metadata using a HEAD request
+func (c *ClientImpl) Stat(ctx context.Context, key string) (objectstore.ObjectInfo, error) {
+	info, err := c.client.StatObject(ctx, c.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return objectstore.ObjectInfo{}, statError(key, err)
+	}
+
+	return objectInfo(info), nil
+}
+
+// List pages through ListObjectsV2 using continuation tokens
+func (c *ClientImpl) List(ctx context.Context, prefix string) objectstore.ObjectIterator {
+	return objectstore.NewPageIterator(ctx, func(ctx context.Context, cursor string) ([]objectstore.ObjectInfo, string, error) {
+		result, err := c.core.ListObjectsV2(c.bucket, prefix, "", cursor, "", listPageSize)
+		if err != nil {
+			return nil, "", fmt.Errorf("list objects: %w", err)
+		}
+
+		items := make([]objectstore.ObjectInfo, 0, len(result.Contents))
+		for _, info := range result.Contents {
+			items = append(items, objectInfo(info))
+		}
+
+		if !result.IsTruncated {
+			return items, "", nil
+		}
+		return items, result.NextContinuationToken, nil
+	})
+}
+
+// statError wraps a failed HEAD or GET, mapping a missing key to
+// objectstore.ErrNotFound and an unsatisfiable range to
+// objectstore.ErrInvalidRange so the layers above don't retry them.
+func statError(key string, err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey":
+		return fmt.Errorf("stat %s: %w", key, objectstore.ErrNotFound)
+	case "InvalidRange":
+		return fmt.Errorf("get %s: %w", key, objectstore.ErrInvalidRange)
+	}
+	return fmt.Errorf("stat object: %w", err)
+}
+
+// multipartError wraps a failed multipart call, mapping an unknown upload ID
+// to objectstore.ErrNotFound.
+func multipartError(op, uploadID string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+		return fmt.Errorf("%s %s: %w", op, uploadID, objectstore.ErrNotFound)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+func objectInfo(info minio.ObjectInfo) objectstore.ObjectInfo {
+	return objectstore.ObjectInfo{
+		Key:     info.Key,
+		Size:    info.Size,
+		ModTime: info.LastModified,
+		ETag:    info.ETag,
+	}
+}
+
+// sizedReader returns a reader with a known length for content. Seekable
+// content is measured in place, anything else is spooled to a temp file.
+func sizedReader(content io.Reader) (io.Reader, int64, func(), error) {
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		cur, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			end, err := seeker.Seek(0, io.SeekEnd)
+			if err == nil {
+				if _, err := seeker.Seek(cur, io.SeekStart); err == nil {
+					return seeker, end - cur, func() {}, nil
+				}
+			}
+		}
+	}
+
+	f, err := os.CreateTemp("", "templar-s3-part-*")
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("create temp file: %w", err)
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	size, err := io.Copy(f, content)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, fmt.Errorf("spool part: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, 0, nil, fmt.Errorf("rewind part: %w", err)
+	}
+
+	return f, size, cleanup, nil
+}
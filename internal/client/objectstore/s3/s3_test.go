@@ -0,0 +1,408 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+)
+
+// fakeS3 is an in-process stand-in for the parts of the S3 API the client
+// uses, with path-style addressing and no signature checks.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	nextID  int
+}
+
+// modified is the modification time of every object.
+var modified = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, query.Get("prefix"))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.uploads[id] = map[int][]byte{}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: bucket, Key: key, UploadID: id})
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[number] = readBody(r)
+		w.Header().Set("ETag", etag(parts[number]))
+	case r.Method == http.MethodGet && query.Has("uploadId"):
+		f.listParts(w, query.Get("uploadId"))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		numbers := make([]int, 0, len(parts))
+		for number := range parts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		var content []byte
+		for _, number := range numbers {
+			content = append(content, parts[number]...)
+		}
+		f.objects[key] = content
+		delete(f.uploads, query.Get("uploadId"))
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucket, Key: key, ETag: etag(content)})
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[key] = readBody(r)
+		w.Header().Set("ETag", etag(f.objects[key]))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		content, ok := f.objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if start, ok := rangeStart(r); ok && start >= int64(len(content)) {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+			return
+		}
+		w.Header().Set("ETag", etag(content))
+		http.ServeContent(w, r, "", modified, bytes.NewReader(content))
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key          string
+		Size         int64
+		ETag         string
+		LastModified time.Time
+	}
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	contents := make([]content, 0, len(keys))
+	for _, key := range keys {
+		contents = append(contents, content{Key: key, Size: int64(len(f.objects[key])), ETag: etag(f.objects[key]), LastModified: modified})
+	}
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"ListBucketResult"`
+		Prefix   string
+		KeyCount int
+		Contents []content
+	}{Prefix: prefix, KeyCount: len(contents), Contents: contents})
+}
+
+func (f *fakeS3) listParts(w http.ResponseWriter, uploadID string) {
+	type part struct {
+		PartNumber int
+		ETag       string
+		Size       int64
+	}
+	parts, ok := f.uploads[uploadID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	var result []part
+	for number, content := range parts {
+		result = append(result, part{PartNumber: number, ETag: etag(content), Size: int64(len(content))})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].PartNumber < result[j].PartNumber })
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"ListPartsResult"`
+		Part    []part
+	}{Part: result})
+}
+
+// rangeStart returns the first byte of a "bytes=start-" Range header.
+func rangeStart(r *http.Request) (int64, bool) {
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok {
+		return 0, false
+	}
+	first, _, _ := strings.Cut(spec, "-")
+	start, err := strconv.ParseInt(first, 10, 64)
+	return start, err == nil
+}
+
+// readBody reads a request body, decoding the aws-chunked encoding minio
+// uses for streaming signatures.
+func readBody(r *http.Request) []byte {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		content, _ := io.ReadAll(r.Body)
+		return content
+	}
+
+	var content []byte
+	reader := bufio.NewReader(r.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return content
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil || size == 0 {
+			return content
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return content
+		}
+		content = append(content, chunk...)
+		reader.ReadString('\n')
+	}
+}
+
+func etag(content []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(content))
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
+
+func newTestClient(t *testing.T) *ClientImpl {
+	t.Helper()
+	server := httptest.NewServer(newFakeS3())
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(context.Background(), S3Config{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "templar",
+		AccessKeyID:     "test",
+		SecretAccessKey: "testsecret",
+		UsePathStyle:    true,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func TestUploadDownload(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	content := bytes.Repeat([]byte("templar"), 3000)
+
+	// A plain reader has no known length, so it is streamed in parts
+	if err := client.Upload(ctx, "blobs/a", io.MultiReader(bytes.NewReader(content))); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	reader, err := client.Download(ctx, "blobs/a")
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	got, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("Download returned %d bytes (err %v), want %d", len(got), err, len(content))
+	}
+
+	info, err := client.Stat(ctx, "blobs/a")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len(content)) || info.ETag == "" {
+		t.Fatalf("Stat = %+v", info)
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	content := []byte("0123456789")
+	if err := client.Upload(ctx, "range", bytes.NewReader(content)); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 4, "0123"},
+		{3, 4, "3456"},
+		{6, -1, "6789"},
+		{0, -1, "0123456789"},
+	}
+	for _, tt := range tests {
+		reader, err := client.DownloadRange(ctx, "range", tt.offset, tt.length)
+		if err != nil {
+			t.Fatalf("DownloadRange(%d, %d): %v", tt.offset, tt.length, err)
+		}
+		got, _ := io.ReadAll(reader)
+		reader.Close()
+		if string(got) != tt.want {
+			t.Errorf("DownloadRange(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	if _, err := client.Stat(ctx, "missing"); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Errorf("Stat error = %v, want ErrNotFound", err)
+	}
+	if _, err := client.Download(ctx, "missing"); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Errorf("Download error = %v, want ErrNotFound", err)
+	}
+	if _, err := client.DownloadRange(ctx, "missing", 2, 4); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Errorf("DownloadRange error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestInvalidRange(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	if err := client.Upload(ctx, "range", strings.NewReader("0123456789")); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	if _, err := client.DownloadRange(ctx, "range", 20, 4); !errors.Is(err, objectstore.ErrInvalidRange) {
+		t.Errorf("DownloadRange past the end error = %v, want ErrInvalidRange", err)
+	}
+	if _, err := client.DownloadRange(ctx, "range", -1, 4); !errors.Is(err, objectstore.ErrInvalidRange) {
+		t.Errorf("DownloadRange negative offset error = %v, want ErrInvalidRange", err)
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	uploadID, err := client.CreateMultipart(ctx, "multi")
+	if err != nil {
+		t.Fatalf("CreateMultipart: %v", err)
+	}
+	// Parts are sent out of order, and the second isn't seekable
+	if err := client.UploadPart(ctx, "multi", uploadID, 2, strings.NewReader("world")); err != nil {
+		t.Fatalf("UploadPart 2: %v", err)
+	}
+	if err := client.UploadPart(ctx, "multi", uploadID, 1, io.MultiReader(strings.NewReader("hello "))); err != nil {
+		t.Fatalf("UploadPart 1: %v", err)
+	}
+	if err := client.CompleteMultipart(ctx, "multi", uploadID); err != nil {
+		t.Fatalf("CompleteMultipart: %v", err)
+	}
+
+	reader, err := client.Download(ctx, "multi")
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	got, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(got) != "hello world" {
+		t.Fatalf("assembled object = %q", got)
+	}
+
+	aborted, err := client.CreateMultipart(ctx, "aborted")
+	if err != nil {
+		t.Fatalf("CreateMultipart: %v", err)
+	}
+	if err := client.UploadPart(ctx, "aborted", aborted, 1, strings.NewReader("x")); err != nil {
+		t.Fatalf("UploadPart: %v", err)
+	}
+	if err := client.AbortMultipart(ctx, "aborted", aborted); err != nil {
+		t.Fatalf("AbortMultipart: %v", err)
+	}
+	if _, err := client.Stat(ctx, "aborted"); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("aborted upload left an object: %v", err)
+	}
+}
+
+func TestListDelete(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	for _, key := range []string{"chunks/b", "chunks/a", "blobs/c"} {
+		if err := client.Upload(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatalf("Upload %s: %v", key, err)
+		}
+	}
+
+	var keys []string
+	it := client.List(ctx, "chunks/")
+	for it.Next() {
+		keys = append(keys, it.Item().Key)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if strings.Join(keys, ",") != "chunks/a,chunks/b" {
+		t.Fatalf("List = %v", keys)
+	}
+
+	if err := client.Delete(ctx, "chunks/a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := client.Stat(ctx, "chunks/a"); !errors.Is(err, objectstore.ErrNotFound) {
+		t.Fatalf("Stat after Delete: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package stoj
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"storj.io/uplink"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+)
+
+// ListMultipart lists the uploads in progress with ListUploads. Storj only
+// filters on prefixes ending with a slash, so the prefix is matched here.
+func (c *ClientImpl) ListMultipart(ctx context.Context, prefix string) ([]objectstore.MultipartSession, error) {
+	it := c.project.ListUploads(ctx, c.bucket, &uplink.ListUploadsOptions{
+		Recursive: true,
+		System:    true,
+	})
+
+	var sessions []objectstore.MultipartSession
+	for it.Next() {
+		upload := it.Item()
+		if upload.IsPrefix || !strings.HasPrefix(upload.Key, prefix) {
+			continue
+		}
+		sessions = append(sessions, objectstore.MultipartSession{
+			Key:       upload.Key,
+			UploadID:  upload.UploadID,
+			CreatedAt: upload.System.Created,
+		})
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("list uploads: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// ListParts lists the committed parts of an upload with ListUploadParts. The
+// checksum is the ETag UploadPart set.
+func (c *ClientImpl) ListParts(ctx context.Context, key, uploadID string) ([]objectstore.PartInfo, error) {
+	it := c.project.ListUploadParts(ctx, c.bucket, key, uploadID, nil)
+
+	var parts []objectstore.PartInfo
+	for it.Next() {
+		part := it.Item()
+		parts = append(parts, objectstore.PartInfo{
+			PartNumber: int(part.PartNumber),
+			Size:       part.Size,
+			Checksum:   string(part.ETag),
+			ModTime:    part.Modified,
+		})
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("list upload parts: %w", err)
+	}
+
+	return parts, nil
+}
+
+// ExpireMultipart aborts the uploads whose last part, or start if they have
+// none, is older than before.
+func (c *ClientImpl) ExpireMultipart(ctx context.Context, before time.Time) (int, error) {
+	sessions, err := c.ListMultipart(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, session := range sessions {
+		active := session.CreatedAt
+		parts, err := c.ListParts(ctx, session.Key, session.UploadID)
+		if err != nil {
+			return expired, err
+		}
+		for _, part := range parts {
+			if part.ModTime.After(active) {
+				active = part.ModTime
+			}
+		}
+		if !active.Before(before) {
+			continue
+		}
+
+		if err := c.AbortMultipart(ctx, session.Key, session.UploadID); err != nil {
+			return expired, err
+		}
+		expired++
+	}
+
+	return expired, nil
+}
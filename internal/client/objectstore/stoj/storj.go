@@ -2,18 +2,40 @@ package stoj
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	"storj.io/uplink"
+	"storj.io/uplink/edge"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/utils/blake3"
 )
 
 type ClientImpl struct {
 	project     *uplink.Project
 	bucket      string
 	baseURL     string
+	authService string
 	accessGrant string
+
+	// gateway holds the credentials GetURL registered, by key
+	gatewayMu sync.Mutex
+	gateway   map[string]gatewayAccess
+}
+
+// gatewayAccess is a gateway credential that can only download one key.
+type gatewayAccess struct {
+	accessKeyID string
+	secretKey   string
+	notAfter    time.Time
 }
 
 type StorjConfig struct {
@@ -21,9 +43,12 @@ type StorjConfig struct {
 	AccessGrant string
 	// Bucket is the bucket name where objects will be stored
 	Bucket string
-	// BaseURL is the public base URL used to construct public URLs
-	// If empty, GetURL will return an error for public objects
+	// BaseURL is the S3 gateway GetURL presigns URLs for, e.g. https://gateway.storjshare.io
+	// If empty, GetURL will return an error
 	BaseURL string
+	// AuthService is the address of the auth service that issues gateway
+	// credentials, e.g. auth.storjshare.io:7777
+	AuthService string
 }
 
 // NewClient creates a new Storj objectstore client
@@ -58,7 +83,9 @@ func NewClient(ctx context.Context, cfg StorjConfig) (*ClientImpl, error) {
 		project:     project,
 		bucket:      cfg.Bucket,
 		baseURL:     strings.TrimRight(cfg.BaseURL, "/"),
+		authService: cfg.AuthService,
 		accessGrant: cfg.AccessGrant,
+		gateway:     make(map[string]gatewayAccess),
 	}
 
 	return client, nil
@@ -84,6 +111,7 @@ func (c *ClientImpl) CreateMultipart(ctx context.Context, key string) (string, e
 }
 
 // UploadPart uploads a single part to Storj using the native multipart API.
+// The part's BLAKE3 checksum is stored as its ETag for ListParts.
 func (c *ClientImpl) UploadPart(
 	ctx context.Context,
 	key string,
@@ -93,15 +121,21 @@ func (c *ClientImpl) UploadPart(
 ) error {
 	pu, err := c.project.UploadPart(ctx, c.bucket, key, uploadID, uint32(partNumber))
 	if err != nil {
-		return fmt.Errorf("begin part upload: %w", err)
+		return multipartError("begin part upload", uploadID, err)
 	}
 
 	// Stream data into the part.
-	if _, err := io.Copy(pu, content); err != nil {
+	hasher := blake3.New()
+	if _, err := io.Copy(io.MultiWriter(pu, hasher), content); err != nil {
 		_ = pu.Abort()
 		return fmt.Errorf("write part: %w", err)
 	}
 
+	if err := pu.SetETag([]byte(hasher.Sum())); err != nil {
+		_ = pu.Abort()
+		return fmt.Errorf("set part etag: %w", err)
+	}
+
 	// Commit the part. Storj will record size/metadata internally.
 	if err := pu.Commit(); err != nil {
 		return fmt.Errorf("commit part: %w", err)
@@ -117,7 +151,7 @@ func (c *ClientImpl) CompleteMultipart(
 	uploadID string,
 ) error {
 	if _, err := c.project.CommitUpload(ctx, c.bucket, key, uploadID, nil); err != nil {
-		return fmt.Errorf("commit upload: %w", err)
+		return multipartError("commit upload", uploadID, err)
 	}
 
 	return nil
@@ -159,12 +193,35 @@ func (c *ClientImpl) Upload(ctx context.Context, key string, content io.Reader)
 func (c *ClientImpl) Download(ctx context.Context, key string) (io.ReadCloser, error) {
 	download, err := c.project.DownloadObject(ctx, c.bucket, key, nil)
 	if err != nil {
+		if errors.Is(err, uplink.ErrObjectNotFound) {
+			return nil, fmt.Errorf("download %s: %w", key, objectstore.ErrNotFound)
+		}
 		return nil, fmt.Errorf("download object: %w", err)
 	}
 
 	return download, nil
 }
 
+// DownloadRange downloads part of an object from Storj
+func (c *ClientImpl) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := objectstore.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+
+	download, err := c.project.DownloadObject(ctx, c.bucket, key, &uplink.DownloadOptions{
+		Offset: offset,
+		Length: length,
+	})
+	if err != nil {
+		if errors.Is(err, uplink.ErrObjectNotFound) {
+			return nil, fmt.Errorf("download %s: %w", key, objectstore.ErrNotFound)
+		}
+		return nil, fmt.Errorf("download object range: %w", err)
+	}
+
+	return download, nil
+}
+
 // Delete deletes an object from Storj
 func (c *ClientImpl) Delete(ctx context.Context, key string) error {
 	_, err := c.project.DeleteObject(ctx, c.bucket, key)
@@ -173,3 +230,157 @@ func (c *ClientImpl) Delete(ctx context.Context, key string) error {
 	}
 	return nil
 }
+
+// GetURL presigns a GET of key on the S3 gateway at BaseURL. The gateway
+// credentials are registered for an access that can only download key, so a
+// leaked URL grants nothing else.
+func (c *ClientImpl) GetURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if c.baseURL == "" || c.authService == "" {
+		return "", fmt.Errorf("base url and auth service are required")
+	}
+	endpoint, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "", fmt.Errorf("parse base url: %w", err)
+	}
+
+	creds, err := c.gatewayAccess(ctx, key, expiry)
+	if err != nil {
+		return "", err
+	}
+
+	// The gateway only knows us-east-1, set it so minio doesn't look it up
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(creds.accessKeyID, creds.secretKey, ""),
+		Secure:       endpoint.Scheme == "https",
+		Region:       "us-east-1",
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		return "", fmt.Errorf("create gateway client: %w", err)
+	}
+	u, err := client.PresignedGetObject(ctx, c.bucket, key, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("presign get: %w", err)
+	}
+	return u.String(), nil
+}
+
+// gatewayAccess returns credentials that can download key for at least
+// expiry. Registering them is a round trip to the auth service, so they are
+// registered for twice as long and reused by the URLs of key issued until
+// they have less than expiry left.
+func (c *ClientImpl) gatewayAccess(ctx context.Context, key string, expiry time.Duration) (gatewayAccess, error) {
+	now := time.Now()
+	c.gatewayMu.Lock()
+	cached, ok := c.gateway[key]
+	c.gatewayMu.Unlock()
+	if ok && cached.notAfter.Sub(now) >= expiry {
+		return cached, nil
+	}
+
+	access, err := uplink.ParseAccess(c.accessGrant)
+	if err != nil {
+		return gatewayAccess{}, fmt.Errorf("parse access grant: %w", err)
+	}
+	notAfter := now.Add(2 * expiry)
+	restricted, err := access.Share(
+		uplink.Permission{AllowDownload: true, NotAfter: notAfter},
+		uplink.SharePrefix{Bucket: c.bucket, Prefix: key},
+	)
+	if err != nil {
+		return gatewayAccess{}, fmt.Errorf("restrict access: %w", err)
+	}
+
+	edgeConfig := edge.Config{AuthServiceAddress: c.authService}
+	creds, err := edgeConfig.RegisterAccess(ctx, restricted, nil)
+	if err != nil {
+		return gatewayAccess{}, fmt.Errorf("register access: %w", err)
+	}
+	registered := gatewayAccess{
+		accessKeyID: creds.AccessKeyID,
+		secretKey:   creds.SecretKey,
+		notAfter:    notAfter,
+	}
+
+	c.gatewayMu.Lock()
+	defer c.gatewayMu.Unlock()
+	for k, a := range c.gateway {
+		if !a.notAfter.After(now) {
+			delete(c.gateway, k)
+		}
+	}
+	c.gateway[key] = registered
+	return registered, nil
+}
+
+// Stat returns object metadata from Storj. Storj has no ETag, so one is derived
+// from the creation time and length.
+func (c *ClientImpl) Stat(ctx context.Context, key string) (objectstore.ObjectInfo, error) {
+	object, err := c.project.StatObject(ctx, c.bucket, key)
+	if err != nil {
+		if errors.Is(err, uplink.ErrObjectNotFound) {
+			return objectstore.ObjectInfo{}, fmt.Errorf("stat %s: %w", key, objectstore.ErrNotFound)
+		}
+		return objectstore.ObjectInfo{}, fmt.Errorf("stat object: %w", err)
+	}
+
+	return objectInfo(object), nil
+}
+
+// List lists objects recursively. uplink only accepts prefixes ending in a
+// slash, so the listing starts at the enclosing "directory" and the remainder
+// of the prefix is filtered client side.
+func (c *ClientImpl) List(ctx context.Context, prefix string) objectstore.ObjectIterator {
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+	return &objectIterator{
+		it: c.project.ListObjects(ctx, c.bucket, &uplink.ListObjectsOptions{
+			Prefix:    dir,
+			Recursive: true,
+			System:    true,
+		}),
+		prefix: prefix,
+	}
+}
+
+type objectIterator struct {
+	it     *uplink.ObjectIterator
+	prefix string
+}
+
+func (i *objectIterator) Next() bool {
+	for i.it.Next() {
+		if strings.HasPrefix(i.it.Item().Key, i.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *objectIterator) Item() objectstore.ObjectInfo {
+	return objectInfo(i.it.Item())
+}
+
+func (i *objectIterator) Err() error {
+	if err := i.it.Err(); err != nil {
+		return fmt.Errorf("list objects: %w", err)
+	}
+	return nil
+}
+
+func objectInfo(object *uplink.Object) objectstore.ObjectInfo {
+	return objectstore.ObjectInfo{
+		Key:     object.Key,
+		Size:    object.System.ContentLength,
+		ModTime: object.System.Created,
+		ETag:    fmt.Sprintf("%x-%x", object.System.Created.UnixNano(), object.System.ContentLength),
+	}
+}
+
+// multipartError wraps a failed multipart call, mapping an unknown upload ID
+// to objectstore.ErrNotFound.
+func multipartError(op, uploadID string, err error) error {
+	if errors.Is(err, uplink.ErrUploadIDInvalid) {
+		return fmt.Errorf("%s %s: %w", op, uploadID, objectstore.ErrNotFound)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
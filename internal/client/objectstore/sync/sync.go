@@ -108,6 +108,20 @@ func (c *SyncClient) Download(ctx context.Context, key string) (io.ReadCloser, e
 	return ioutil.NewLockedReadCloser(file, lock), nil
 }
 
+// DownloadRange downloads part of an object with read locking.
+func (c *SyncClient) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	lock := c.getLock(key)
+	lock.RLock()
+
+	file, err := c.client.DownloadRange(ctx, key, offset, length)
+	if err != nil {
+		lock.RUnlock()
+		return nil, fmt.Errorf("download range: %w", err)
+	}
+
+	return ioutil.NewLockedReadCloser(file, lock), nil
+}
+
 // Delete deletes an object with write locking.
 func (c *SyncClient) Delete(ctx context.Context, key string) error {
 	lock := c.getLock(key)
@@ -116,3 +130,17 @@ func (c *SyncClient) Delete(ctx context.Context, key string) error {
 
 	return c.client.Delete(ctx, key)
 }
+
+// Stat returns object metadata with read locking.
+func (c *SyncClient) Stat(ctx context.Context, key string) (objectstore.ObjectInfo, error) {
+	lock := c.getLock(key)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return c.client.Stat(ctx, key)
+}
+
+// List lists objects without locking, a listing is a point-in-time view anyway.
+func (c *SyncClient) List(ctx context.Context, prefix string) objectstore.ObjectIterator {
+	return c.client.List(ctx, prefix)
+}
@@ -0,0 +1,14 @@
+package objectstore
+
+import (
+	"context"
+	"time"
+)
+
+// URLSigner is implemented by backends that can hand out a URL an object is
+// downloaded from directly, so its bytes don't go through Templar.
+type URLSigner interface {
+	// GetURL returns a URL that serves key to a plain GET, Range included,
+	// until expiry has passed.
+	GetURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
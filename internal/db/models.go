@@ -17,6 +17,59 @@ type Analytic struct {
 	Status     string    `json:"status"`
 }
 
+type Blob struct {
+	ObjectKey  string    `json:"object_key"`
+	Hash       *string   `json:"hash"`
+	Size       *int64    `json:"size"`
+	RefCount   int64     `json:"ref_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	Chunked    bool      `json:"chunked"`
+	StoredSize *int64    `json:"stored_size"`
+	Compressed bool      `json:"compressed"`
+}
+
+type BlobChunk struct {
+	BlobKey   string `json:"blob_key"`
+	Seq       int64  `json:"seq"`
+	ChunkHash string `json:"chunk_hash"`
+	Offset    int64  `json:"offset"`
+	Size      int64  `json:"size"`
+}
+
+type CacheEntry struct {
+	Key        string    `json:"key"`
+	Size       int64     `json:"size"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+type CacheWriteback struct {
+	Key       string    `json:"key"`
+	Attempts  int64     `json:"attempts"`
+	LastError *string   `json:"last_error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Chunk struct {
+	Hash       string    `json:"hash"`
+	ObjectKey  string    `json:"object_key"`
+	Size       int64     `json:"size"`
+	RefCount   int64     `json:"ref_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	StoredSize *int64    `json:"stored_size"`
+	Compressed bool      `json:"compressed"`
+}
+
+type DownloadLink struct {
+	ID            string    `json:"id"`
+	TemplateID    string    `json:"template_id"`
+	VersionNumber int64     `json:"version_number"`
+	MaxDownloads  *int64    `json:"max_downloads"`
+	Downloads     int64     `json:"downloads"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	Resumes       int64     `json:"resumes"`
+}
+
 type Job struct {
 	ID            int64      `json:"id"`
 	Type          string     `json:"type"`
@@ -30,6 +83,19 @@ type Job struct {
 	Metadata      string     `json:"metadata"`
 }
 
+type ObjectDigest struct {
+	Key       string    `json:"key"`
+	Size      int64     `json:"size"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ObjectTombstone struct {
+	ObjectKey string     `json:"object_key"`
+	CreatedAt time.Time  `json:"created_at"`
+	ClaimedAt *time.Time `json:"claimed_at"`
+}
+
 type Template struct {
 	ID          string    `json:"id"`
 	Name        string    `json:"name"`
@@ -46,4 +112,24 @@ type TemplateVersion struct {
 	FileSize      *int64    `json:"file_size"`
 	FileHash      *string   `json:"file_hash"`
 	CreatedAt     time.Time `json:"created_at"`
+	StoredSize    *int64    `json:"stored_size"`
+}
+
+type Upload struct {
+	ID            string    `json:"id"`
+	TemplateID    string    `json:"template_id"`
+	VersionNumber int64     `json:"version_number"`
+	ObjectKey     string    `json:"object_key"`
+	MultipartID   string    `json:"multipart_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	PartCount     int64     `json:"part_count"`
+}
+
+type UploadPart struct {
+	UploadID   string    `json:"upload_id"`
+	PartNumber int64     `json:"part_number"`
+	Size       int64     `json:"size"`
+	Checksum   string    `json:"checksum"`
+	CreatedAt  time.Time `json:"created_at"`
 }
@@ -10,6 +10,107 @@ import (
 	"time"
 )
 
+const acquireBlob = `-- name: AcquireBlob :one
+INSERT INTO "blobs" ("object_key", "hash", "size", "chunked", "stored_size", "compressed", "ref_count")
+VALUES (?, ?, ?, ?, ?, ?, 1)
+ON CONFLICT ("object_key") DO UPDATE SET "ref_count" = "ref_count" + 1
+RETURNING object_key, hash, size, ref_count, created_at, chunked, stored_size, compressed
+`
+
+type AcquireBlobParams struct {
+	ObjectKey  string  `json:"object_key"`
+	Hash       *string `json:"hash"`
+	Size       *int64  `json:"size"`
+	Chunked    bool    `json:"chunked"`
+	StoredSize *int64  `json:"stored_size"`
+	Compressed bool    `json:"compressed"`
+}
+
+func (q *Queries) AcquireBlob(ctx context.Context, arg AcquireBlobParams) (Blob, error) {
+	row := q.db.QueryRowContext(ctx, acquireBlob,
+		arg.ObjectKey,
+		arg.Hash,
+		arg.Size,
+		arg.Chunked,
+		arg.StoredSize,
+		arg.Compressed,
+	)
+	var i Blob
+	err := row.Scan(
+		&i.ObjectKey,
+		&i.Hash,
+		&i.Size,
+		&i.RefCount,
+		&i.CreatedAt,
+		&i.Chunked,
+		&i.StoredSize,
+		&i.Compressed,
+	)
+	return i, err
+}
+
+const acquireChunk = `-- name: AcquireChunk :one
+INSERT INTO "chunks" ("hash", "object_key", "size", "stored_size", "compressed", "ref_count")
+VALUES (?, ?, ?, ?, ?, 1)
+ON CONFLICT ("hash") DO UPDATE SET "ref_count" = "ref_count" + 1
+RETURNING hash, object_key, size, ref_count, created_at, stored_size, compressed
+`
+
+type AcquireChunkParams struct {
+	Hash       string `json:"hash"`
+	ObjectKey  string `json:"object_key"`
+	Size       int64  `json:"size"`
+	StoredSize *int64 `json:"stored_size"`
+	Compressed bool   `json:"compressed"`
+}
+
+func (q *Queries) AcquireChunk(ctx context.Context, arg AcquireChunkParams) (Chunk, error) {
+	row := q.db.QueryRowContext(ctx, acquireChunk,
+		arg.Hash,
+		arg.ObjectKey,
+		arg.Size,
+		arg.StoredSize,
+		arg.Compressed,
+	)
+	var i Chunk
+	err := row.Scan(
+		&i.Hash,
+		&i.ObjectKey,
+		&i.Size,
+		&i.RefCount,
+		&i.CreatedAt,
+		&i.StoredSize,
+		&i.Compressed,
+	)
+	return i, err
+}
+
+const claimObjectTombstone = `-- name: ClaimObjectTombstone :execrows
+UPDATE "object_tombstones" SET "claimed_at" = ?1
+WHERE "object_key" = ?2
+  AND ("claimed_at" IS NULL OR "claimed_at" < ?3)
+  AND NOT EXISTS (SELECT 1 FROM "chunks" WHERE "object_key" = ?2)
+  AND NOT EXISTS (SELECT 1 FROM "blobs" WHERE "object_key" = ?2)
+`
+
+type ClaimObjectTombstoneParams struct {
+	ClaimedAt     *time.Time `json:"claimed_at"`
+	ObjectKey     string     `json:"object_key"`
+	ClaimedBefore *time.Time `json:"claimed_before"`
+}
+
+func (q *Queries) ClaimObjectTombstone(ctx context.Context, arg ClaimObjectTombstoneParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, claimObjectTombstone,
+		arg.ClaimedAt,
+		arg.ObjectKey,
+		arg.ClaimedBefore,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createAnalytic = `-- name: CreateAnalytic :one
 INSERT INTO "analytics" ("id", "template_id", "version_id", "action", "timestamp", "status")
 VALUES (?, ?, ?, ?, ?, ?)
@@ -46,6 +147,79 @@ func (q *Queries) CreateAnalytic(ctx context.Context, arg CreateAnalyticParams)
 	return i, err
 }
 
+const createBlobChunk = `-- name: CreateBlobChunk :exec
+INSERT INTO "blob_chunks" ("blob_key", "seq", "chunk_hash", "offset", "size")
+VALUES (?, ?, ?, ?, ?)
+`
+
+type CreateBlobChunkParams struct {
+	BlobKey   string `json:"blob_key"`
+	Seq       int64  `json:"seq"`
+	ChunkHash string `json:"chunk_hash"`
+	Offset    int64  `json:"offset"`
+	Size      int64  `json:"size"`
+}
+
+func (q *Queries) CreateBlobChunk(ctx context.Context, arg CreateBlobChunkParams) error {
+	_, err := q.db.ExecContext(ctx, createBlobChunk,
+		arg.BlobKey,
+		arg.Seq,
+		arg.ChunkHash,
+		arg.Offset,
+		arg.Size,
+	)
+	return err
+}
+
+const createCachePin = `-- name: CreateCachePin :execrows
+INSERT INTO "cache_pins" ("version_id") VALUES (?)
+ON CONFLICT ("version_id") DO NOTHING
+`
+
+func (q *Queries) CreateCachePin(ctx context.Context, versionID string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createCachePin, versionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const createDownloadLink = `-- name: CreateDownloadLink :one
+INSERT INTO "download_links" ("id", "template_id", "version_number", "max_downloads", "expires_at")
+VALUES (?, ?, ?, ?, ?)
+RETURNING id, template_id, version_number, max_downloads, downloads, expires_at, created_at, resumes
+`
+
+type CreateDownloadLinkParams struct {
+	ID            string    `json:"id"`
+	TemplateID    string    `json:"template_id"`
+	VersionNumber int64     `json:"version_number"`
+	MaxDownloads  *int64    `json:"max_downloads"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateDownloadLink(ctx context.Context, arg CreateDownloadLinkParams) (DownloadLink, error) {
+	row := q.db.QueryRowContext(ctx, createDownloadLink,
+		arg.ID,
+		arg.TemplateID,
+		arg.VersionNumber,
+		arg.MaxDownloads,
+		arg.ExpiresAt,
+	)
+	var i DownloadLink
+	err := row.Scan(
+		&i.ID,
+		&i.TemplateID,
+		&i.VersionNumber,
+		&i.MaxDownloads,
+		&i.Downloads,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.Resumes,
+	)
+	return i, err
+}
+
 const createJob = `-- name: CreateJob :one
 INSERT INTO "jobs" ("type", "template_id", "version_number", "status", "progress", "started_at", "completed_at", "error_message", "metadata")
 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
@@ -92,6 +266,16 @@ func (q *Queries) CreateJob(ctx context.Context, arg CreateJobParams) (Job, erro
 	return i, err
 }
 
+const createObjectTombstone = `-- name: CreateObjectTombstone :exec
+INSERT INTO "object_tombstones" ("object_key") VALUES (?)
+ON CONFLICT ("object_key") DO NOTHING
+`
+
+func (q *Queries) CreateObjectTombstone(ctx context.Context, objectKey string) error {
+	_, err := q.db.ExecContext(ctx, createObjectTombstone, objectKey)
+	return err
+}
+
 const createTemplate = `-- name: CreateTemplate :one
 INSERT INTO "templates" ("id", "name", "description")
 VALUES (?, ?, ?)
@@ -118,9 +302,9 @@ func (q *Queries) CreateTemplate(ctx context.Context, arg CreateTemplateParams)
 }
 
 const createTemplateVersion = `-- name: CreateTemplateVersion :one
-INSERT INTO "template_versions" ("id", "template_id", "version_number", "object_key", "file_size", "file_hash")
-VALUES (?, ?, ?, ?, ?, ?)
-RETURNING id, template_id, version_number, object_key, file_size, file_hash, created_at
+INSERT INTO "template_versions" ("id", "template_id", "version_number", "object_key", "file_size", "file_hash", "stored_size")
+VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING id, template_id, version_number, object_key, file_size, file_hash, created_at, stored_size
 `
 
 type CreateTemplateVersionParams struct {
@@ -130,6 +314,7 @@ type CreateTemplateVersionParams struct {
 	ObjectKey     string  `json:"object_key"`
 	FileSize      *int64  `json:"file_size"`
 	FileHash      *string `json:"file_hash"`
+	StoredSize    *int64  `json:"stored_size"`
 }
 
 func (q *Queries) CreateTemplateVersion(ctx context.Context, arg CreateTemplateVersionParams) (TemplateVersion, error) {
@@ -140,6 +325,7 @@ func (q *Queries) CreateTemplateVersion(ctx context.Context, arg CreateTemplateV
 		arg.ObjectKey,
 		arg.FileSize,
 		arg.FileHash,
+		arg.StoredSize,
 	)
 	var i TemplateVersion
 	err := row.Scan(
@@ -150,10 +336,124 @@ func (q *Queries) CreateTemplateVersion(ctx context.Context, arg CreateTemplateV
 		&i.FileSize,
 		&i.FileHash,
 		&i.CreatedAt,
+		&i.StoredSize,
+	)
+	return i, err
+}
+
+const createUpload = `-- name: CreateUpload :one
+INSERT INTO "uploads" ("id", "template_id", "version_number", "object_key", "multipart_id", "part_count")
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, template_id, version_number, object_key, multipart_id, created_at, updated_at, part_count
+`
+
+type CreateUploadParams struct {
+	ID            string `json:"id"`
+	TemplateID    string `json:"template_id"`
+	VersionNumber int64  `json:"version_number"`
+	ObjectKey     string `json:"object_key"`
+	MultipartID   string `json:"multipart_id"`
+	PartCount     int64  `json:"part_count"`
+}
+
+func (q *Queries) CreateUpload(ctx context.Context, arg CreateUploadParams) (Upload, error) {
+	row := q.db.QueryRowContext(ctx, createUpload,
+		arg.ID,
+		arg.TemplateID,
+		arg.VersionNumber,
+		arg.ObjectKey,
+		arg.MultipartID,
+		arg.PartCount,
+	)
+	var i Upload
+	err := row.Scan(
+		&i.ID,
+		&i.TemplateID,
+		&i.VersionNumber,
+		&i.ObjectKey,
+		&i.MultipartID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PartCount,
 	)
 	return i, err
 }
 
+const deleteBlob = `-- name: DeleteBlob :exec
+DELETE FROM "blobs" WHERE "object_key" = ? AND "ref_count" <= 0
+`
+
+func (q *Queries) DeleteBlob(ctx context.Context, objectKey string) error {
+	_, err := q.db.ExecContext(ctx, deleteBlob, objectKey)
+	return err
+}
+
+const deleteBlobChunks = `-- name: DeleteBlobChunks :exec
+DELETE FROM "blob_chunks" WHERE "blob_key" = ?
+`
+
+func (q *Queries) DeleteBlobChunks(ctx context.Context, blobKey string) error {
+	_, err := q.db.ExecContext(ctx, deleteBlobChunks, blobKey)
+	return err
+}
+
+const deleteCacheEntry = `-- name: DeleteCacheEntry :exec
+DELETE FROM "cache_entries" WHERE "key" = ?
+`
+
+func (q *Queries) DeleteCacheEntry(ctx context.Context, key string) error {
+	_, err := q.db.ExecContext(ctx, deleteCacheEntry, key)
+	return err
+}
+
+const deleteCachePin = `-- name: DeleteCachePin :execrows
+DELETE FROM "cache_pins" WHERE "version_id" = ?
+`
+
+func (q *Queries) DeleteCachePin(ctx context.Context, versionID string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteCachePin, versionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteCacheWriteback = `-- name: DeleteCacheWriteback :exec
+DELETE FROM "cache_writebacks" WHERE "key" = ?
+`
+
+func (q *Queries) DeleteCacheWriteback(ctx context.Context, key string) error {
+	_, err := q.db.ExecContext(ctx, deleteCacheWriteback, key)
+	return err
+}
+
+const deleteChunk = `-- name: DeleteChunk :exec
+DELETE FROM "chunks" WHERE "hash" = ? AND "ref_count" <= 0
+`
+
+func (q *Queries) DeleteChunk(ctx context.Context, hash string) error {
+	_, err := q.db.ExecContext(ctx, deleteChunk, hash)
+	return err
+}
+
+const deleteDownloadLink = `-- name: DeleteDownloadLink :exec
+DELETE FROM "download_links" WHERE "id" = ?
+`
+
+func (q *Queries) DeleteDownloadLink(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteDownloadLink, id)
+	return err
+}
+
+const deleteExpiredDownloadLinks = `-- name: DeleteExpiredDownloadLinks :exec
+DELETE FROM "download_links" WHERE "expires_at" < ?
+`
+
+func (q *Queries) DeleteExpiredDownloadLinks(ctx context.Context, expiresAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredDownloadLinks, expiresAt)
+	return err
+}
+
 const deleteJob = `-- name: DeleteJob :exec
 DELETE FROM "jobs" WHERE "id" = ?
 `
@@ -163,6 +463,36 @@ func (q *Queries) DeleteJob(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteObjectDigest = `-- name: DeleteObjectDigest :exec
+DELETE FROM "object_digests" WHERE "key" = ?
+`
+
+func (q *Queries) DeleteObjectDigest(ctx context.Context, key string) error {
+	_, err := q.db.ExecContext(ctx, deleteObjectDigest, key)
+	return err
+}
+
+const deleteObjectTombstone = `-- name: DeleteObjectTombstone :exec
+DELETE FROM "object_tombstones" WHERE "object_key" = ?
+`
+
+func (q *Queries) DeleteObjectTombstone(ctx context.Context, objectKey string) error {
+	_, err := q.db.ExecContext(ctx, deleteObjectTombstone, objectKey)
+	return err
+}
+
+const deleteReferencedObjectTombstones = `-- name: DeleteReferencedObjectTombstones :exec
+DELETE FROM "object_tombstones"
+WHERE "claimed_at" IS NULL
+  AND (EXISTS (SELECT 1 FROM "chunks" WHERE "chunks"."object_key" = "object_tombstones"."object_key")
+    OR EXISTS (SELECT 1 FROM "blobs" WHERE "blobs"."object_key" = "object_tombstones"."object_key"))
+`
+
+func (q *Queries) DeleteReferencedObjectTombstones(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteReferencedObjectTombstones)
+	return err
+}
+
 const deleteTemplate = `-- name: DeleteTemplate :exec
 DELETE FROM "templates" WHERE "id" = ?
 `
@@ -181,6 +511,166 @@ func (q *Queries) DeleteTemplateVersion(ctx context.Context, id string) error {
 	return err
 }
 
+const deleteUpload = `-- name: DeleteUpload :exec
+DELETE FROM "uploads" WHERE "id" = ?
+`
+
+func (q *Queries) DeleteUpload(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteUpload, id)
+	return err
+}
+
+const deleteUploadPart = `-- name: DeleteUploadPart :exec
+DELETE FROM "upload_parts" WHERE "upload_id" = ? AND "part_number" = ?
+`
+
+type DeleteUploadPartParams struct {
+	UploadID   string `json:"upload_id"`
+	PartNumber int64  `json:"part_number"`
+}
+
+func (q *Queries) DeleteUploadPart(ctx context.Context, arg DeleteUploadPartParams) error {
+	_, err := q.db.ExecContext(ctx, deleteUploadPart, arg.UploadID, arg.PartNumber)
+	return err
+}
+
+const deleteUploadParts = `-- name: DeleteUploadParts :exec
+DELETE FROM "upload_parts" WHERE "upload_id" = ?
+`
+
+func (q *Queries) DeleteUploadParts(ctx context.Context, uploadID string) error {
+	_, err := q.db.ExecContext(ctx, deleteUploadParts, uploadID)
+	return err
+}
+
+const failCacheWriteback = `-- name: FailCacheWriteback :exec
+UPDATE "cache_writebacks" SET "attempts" = "attempts" + 1, "last_error" = ? WHERE "key" = ?
+`
+
+type FailCacheWritebackParams struct {
+	LastError *string `json:"last_error"`
+	Key       string  `json:"key"`
+}
+
+func (q *Queries) FailCacheWriteback(ctx context.Context, arg FailCacheWritebackParams) error {
+	_, err := q.db.ExecContext(ctx, failCacheWriteback, arg.LastError, arg.Key)
+	return err
+}
+
+const getBlob = `-- name: GetBlob :one
+SELECT object_key, hash, size, ref_count, created_at, chunked, stored_size, compressed FROM "blobs" WHERE "object_key" = ?
+`
+
+func (q *Queries) GetBlob(ctx context.Context, objectKey string) (Blob, error) {
+	row := q.db.QueryRowContext(ctx, getBlob, objectKey)
+	var i Blob
+	err := row.Scan(
+		&i.ObjectKey,
+		&i.Hash,
+		&i.Size,
+		&i.RefCount,
+		&i.CreatedAt,
+		&i.Chunked,
+		&i.StoredSize,
+		&i.Compressed,
+	)
+	return i, err
+}
+
+const getBlobByHash = `-- name: GetBlobByHash :one
+SELECT object_key, hash, size, ref_count, created_at, chunked, stored_size, compressed FROM "blobs"
+WHERE "hash" = ? AND "ref_count" > 0
+ORDER BY "created_at"
+LIMIT 1
+`
+
+func (q *Queries) GetBlobByHash(ctx context.Context, hash *string) (Blob, error) {
+	row := q.db.QueryRowContext(ctx, getBlobByHash, hash)
+	var i Blob
+	err := row.Scan(
+		&i.ObjectKey,
+		&i.Hash,
+		&i.Size,
+		&i.RefCount,
+		&i.CreatedAt,
+		&i.Chunked,
+		&i.StoredSize,
+		&i.Compressed,
+	)
+	return i, err
+}
+
+const getChunk = `-- name: GetChunk :one
+SELECT hash, object_key, size, ref_count, created_at, stored_size, compressed FROM "chunks"
+WHERE "hash" = ? AND "ref_count" > 0
+`
+
+func (q *Queries) GetChunk(ctx context.Context, hash string) (Chunk, error) {
+	row := q.db.QueryRowContext(ctx, getChunk, hash)
+	var i Chunk
+	err := row.Scan(
+		&i.Hash,
+		&i.ObjectKey,
+		&i.Size,
+		&i.RefCount,
+		&i.CreatedAt,
+		&i.StoredSize,
+		&i.Compressed,
+	)
+	return i, err
+}
+
+const getDownloadLink = `-- name: GetDownloadLink :one
+SELECT id, template_id, version_number, max_downloads, downloads, expires_at, created_at, resumes FROM "download_links" WHERE "id" = ?
+`
+
+func (q *Queries) GetDownloadLink(ctx context.Context, id string) (DownloadLink, error) {
+	row := q.db.QueryRowContext(ctx, getDownloadLink, id)
+	var i DownloadLink
+	err := row.Scan(
+		&i.ID,
+		&i.TemplateID,
+		&i.VersionNumber,
+		&i.MaxDownloads,
+		&i.Downloads,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.Resumes,
+	)
+	return i, err
+}
+
+const getObjectDigest = `-- name: GetObjectDigest :one
+SELECT "key", size, hash, created_at FROM "object_digests" WHERE "key" = ?
+`
+
+func (q *Queries) GetObjectDigest(ctx context.Context, key string) (ObjectDigest, error) {
+	row := q.db.QueryRowContext(ctx, getObjectDigest, key)
+	var i ObjectDigest
+	err := row.Scan(
+		&i.Key,
+		&i.Size,
+		&i.Hash,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getObjectTombstone = `-- name: GetObjectTombstone :one
+SELECT object_key, created_at, claimed_at FROM "object_tombstones" WHERE "object_key" = ?
+`
+
+func (q *Queries) GetObjectTombstone(ctx context.Context, objectKey string) (ObjectTombstone, error) {
+	row := q.db.QueryRowContext(ctx, getObjectTombstone, objectKey)
+	var i ObjectTombstone
+	err := row.Scan(
+		&i.ObjectKey,
+		&i.CreatedAt,
+		&i.ClaimedAt,
+	)
+	return i, err
+}
+
 const getTemplate = `-- name: GetTemplate :one
 SELECT id, name, description, created_at, updated_at FROM templates
 WHERE "id" = ?
@@ -200,7 +690,7 @@ func (q *Queries) GetTemplate(ctx context.Context, id string) (Template, error)
 }
 
 const getTemplateVersion = `-- name: GetTemplateVersion :one
-SELECT id, template_id, version_number, object_key, file_size, file_hash, created_at FROM "template_versions"
+SELECT id, template_id, version_number, object_key, file_size, file_hash, created_at, stored_size FROM "template_versions"
 WHERE (
   ("template_id" = ? AND "version_number" = ?) OR
   ("object_key" = ?)
@@ -224,6 +714,27 @@ func (q *Queries) GetTemplateVersion(ctx context.Context, arg GetTemplateVersion
 		&i.FileSize,
 		&i.FileHash,
 		&i.CreatedAt,
+		&i.StoredSize,
+	)
+	return i, err
+}
+
+const getUpload = `-- name: GetUpload :one
+SELECT id, template_id, version_number, object_key, multipart_id, created_at, updated_at, part_count FROM "uploads" WHERE "id" = ?
+`
+
+func (q *Queries) GetUpload(ctx context.Context, id string) (Upload, error) {
+	row := q.db.QueryRowContext(ctx, getUpload, id)
+	var i Upload
+	err := row.Scan(
+		&i.ID,
+		&i.TemplateID,
+		&i.VersionNumber,
+		&i.ObjectKey,
+		&i.MultipartID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PartCount,
 	)
 	return i, err
 }
@@ -270,25 +781,262 @@ func (q *Queries) ListAnalytics(ctx context.Context, arg ListAnalyticsParams) ([
 	return items, nil
 }
 
-const listJobs = `-- name: ListJobs :many
-SELECT id, type, template_id, version_number, status, progress, started_at, completed_at, error_message, metadata FROM "jobs"
-ORDER BY "created_at" ASC
-LIMIT ?2
-OFFSET ?1
+const listBlobChunks = `-- name: ListBlobChunks :many
+SELECT blob_chunks.blob_key, blob_chunks.seq, blob_chunks.chunk_hash, blob_chunks."offset", blob_chunks.size, "chunks"."compressed" FROM "blob_chunks"
+JOIN "chunks" ON "chunks"."hash" = "blob_chunks"."chunk_hash"
+WHERE "blob_key" = ?
+ORDER BY "seq"
 `
 
-type ListJobsParams struct {
-	Offset int64 `json:"offset"`
-	Limit  int64 `json:"limit"`
+type ListBlobChunksRow struct {
+	BlobKey    string `json:"blob_key"`
+	Seq        int64  `json:"seq"`
+	ChunkHash  string `json:"chunk_hash"`
+	Offset     int64  `json:"offset"`
+	Size       int64  `json:"size"`
+	Compressed bool   `json:"compressed"`
 }
 
-func (q *Queries) ListJobs(ctx context.Context, arg ListJobsParams) ([]Job, error) {
-	rows, err := q.db.QueryContext(ctx, listJobs, arg.Offset, arg.Limit)
+func (q *Queries) ListBlobChunks(ctx context.Context, blobKey string) ([]ListBlobChunksRow, error) {
+	rows, err := q.db.QueryContext(ctx, listBlobChunks, blobKey)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Job{}
+	items := []ListBlobChunksRow{}
+	for rows.Next() {
+		var i ListBlobChunksRow
+		if err := rows.Scan(
+			&i.BlobKey,
+			&i.Seq,
+			&i.ChunkHash,
+			&i.Offset,
+			&i.Size,
+			&i.Compressed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCacheEntries = `-- name: ListCacheEntries :many
+SELECT "key", size, accessed_at FROM "cache_entries"
+`
+
+func (q *Queries) ListCacheEntries(ctx context.Context) ([]CacheEntry, error) {
+	rows, err := q.db.QueryContext(ctx, listCacheEntries)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CacheEntry{}
+	for rows.Next() {
+		var i CacheEntry
+		if err := rows.Scan(
+			&i.Key,
+			&i.Size,
+			&i.AccessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCacheEntriesByAccess = `-- name: ListCacheEntriesByAccess :many
+SELECT "key", size, accessed_at FROM "cache_entries"
+ORDER BY "accessed_at" DESC, "key"
+LIMIT ?
+OFFSET ?
+`
+
+type ListCacheEntriesByAccessParams struct {
+	Limit  int64 `json:"limit"`
+	Offset int64 `json:"offset"`
+}
+
+func (q *Queries) ListCacheEntriesByAccess(ctx context.Context, arg ListCacheEntriesByAccessParams) ([]CacheEntry, error) {
+	rows, err := q.db.QueryContext(ctx, listCacheEntriesByAccess, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CacheEntry{}
+	for rows.Next() {
+		var i CacheEntry
+		if err := rows.Scan(
+			&i.Key,
+			&i.Size,
+			&i.AccessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCachePins = `-- name: ListCachePins :many
+SELECT template_versions.id, template_versions.template_id, template_versions.version_number, template_versions.object_key, template_versions.file_size, template_versions.file_hash, template_versions.created_at, template_versions.stored_size, "cache_pins"."created_at" AS "pinned_at" FROM "cache_pins"
+JOIN "template_versions" ON "template_versions"."id" = "cache_pins"."version_id"
+ORDER BY "cache_pins"."created_at"
+`
+
+type ListCachePinsRow struct {
+	ID            string    `json:"id"`
+	TemplateID    string    `json:"template_id"`
+	VersionNumber int64     `json:"version_number"`
+	ObjectKey     string    `json:"object_key"`
+	FileSize      *int64    `json:"file_size"`
+	FileHash      *string   `json:"file_hash"`
+	CreatedAt     time.Time `json:"created_at"`
+	StoredSize    *int64    `json:"stored_size"`
+	PinnedAt      time.Time `json:"pinned_at"`
+}
+
+func (q *Queries) ListCachePins(ctx context.Context) ([]ListCachePinsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listCachePins)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListCachePinsRow{}
+	for rows.Next() {
+		var i ListCachePinsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TemplateID,
+			&i.VersionNumber,
+			&i.ObjectKey,
+			&i.FileSize,
+			&i.FileHash,
+			&i.CreatedAt,
+			&i.StoredSize,
+			&i.PinnedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCacheWritebacks = `-- name: ListCacheWritebacks :many
+SELECT "key", attempts, last_error, created_at FROM "cache_writebacks"
+ORDER BY "created_at"
+`
+
+func (q *Queries) ListCacheWritebacks(ctx context.Context) ([]CacheWriteback, error) {
+	rows, err := q.db.QueryContext(ctx, listCacheWritebacks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CacheWriteback{}
+	for rows.Next() {
+		var i CacheWriteback
+		if err := rows.Scan(
+			&i.Key,
+			&i.Attempts,
+			&i.LastError,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listIdleUploads = `-- name: ListIdleUploads :many
+SELECT id, template_id, version_number, object_key, multipart_id, created_at, updated_at, part_count FROM "uploads" WHERE "updated_at" < ?
+ORDER BY "updated_at"
+`
+
+func (q *Queries) ListIdleUploads(ctx context.Context, updatedAt time.Time) ([]Upload, error) {
+	rows, err := q.db.QueryContext(ctx, listIdleUploads, updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Upload{}
+	for rows.Next() {
+		var i Upload
+		if err := rows.Scan(
+			&i.ID,
+			&i.TemplateID,
+			&i.VersionNumber,
+			&i.ObjectKey,
+			&i.MultipartID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.PartCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listJobs = `-- name: ListJobs :many
+SELECT id, type, template_id, version_number, status, progress, started_at, completed_at, error_message, metadata FROM "jobs"
+ORDER BY "created_at" ASC
+LIMIT ?2
+OFFSET ?1
+`
+
+type ListJobsParams struct {
+	Offset int64 `json:"offset"`
+	Limit  int64 `json:"limit"`
+}
+
+func (q *Queries) ListJobs(ctx context.Context, arg ListJobsParams) ([]Job, error) {
+	rows, err := q.db.QueryContext(ctx, listJobs, arg.Offset, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Job{}
 	for rows.Next() {
 		var i Job
 		if err := rows.Scan(
@@ -316,8 +1064,111 @@ func (q *Queries) ListJobs(ctx context.Context, arg ListJobsParams) ([]Job, erro
 	return items, nil
 }
 
+const listObjectKeys = `-- name: ListObjectKeys :many
+SELECT "object_key" FROM "chunks" WHERE "ref_count" > 0
+UNION ALL
+SELECT "object_key" FROM "blobs" WHERE "ref_count" > 0 AND NOT "chunked"
+`
+
+func (q *Queries) ListObjectKeys(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listObjectKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var object_key string
+		if err := rows.Scan(&object_key); err != nil {
+			return nil, err
+		}
+		items = append(items, object_key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listObjectTombstones = `-- name: ListObjectTombstones :many
+SELECT object_key, created_at, claimed_at FROM "object_tombstones"
+WHERE ("claimed_at" IS NULL AND "created_at" < ?1)
+   OR "claimed_at" < ?2
+ORDER BY "created_at"
+`
+
+type ListObjectTombstonesParams struct {
+	CreatedBefore time.Time  `json:"created_before"`
+	ClaimedBefore *time.Time `json:"claimed_before"`
+}
+
+func (q *Queries) ListObjectTombstones(ctx context.Context, arg ListObjectTombstonesParams) ([]ObjectTombstone, error) {
+	rows, err := q.db.QueryContext(ctx, listObjectTombstones, arg.CreatedBefore, arg.ClaimedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ObjectTombstone{}
+	for rows.Next() {
+		var i ObjectTombstone
+		if err := rows.Scan(
+			&i.ObjectKey,
+			&i.CreatedAt,
+			&i.ClaimedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPinnedObjectKeys = `-- name: ListPinnedObjectKeys :many
+SELECT "chunks"."object_key" FROM "cache_pins"
+JOIN "template_versions" ON "template_versions"."id" = "cache_pins"."version_id"
+JOIN "blob_chunks" ON "blob_chunks"."blob_key" = "template_versions"."object_key"
+JOIN "chunks" ON "chunks"."hash" = "blob_chunks"."chunk_hash"
+UNION ALL
+SELECT "template_versions"."object_key" FROM "cache_pins"
+JOIN "template_versions" ON "template_versions"."id" = "cache_pins"."version_id"
+LEFT JOIN "blobs" ON "blobs"."object_key" = "template_versions"."object_key"
+WHERE "blobs"."chunked" IS NULL OR NOT "blobs"."chunked"
+`
+
+func (q *Queries) ListPinnedObjectKeys(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listPinnedObjectKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var object_key string
+		if err := rows.Scan(&object_key); err != nil {
+			return nil, err
+		}
+		items = append(items, object_key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listTemplateVersions = `-- name: ListTemplateVersions :many
-SELECT id, template_id, version_number, object_key, file_size, file_hash, created_at FROM "template_versions"
+SELECT id, template_id, version_number, object_key, file_size, file_hash, created_at, stored_size FROM "template_versions"
 WHERE "template_id" = ?
 `
 
@@ -338,6 +1189,7 @@ func (q *Queries) ListTemplateVersions(ctx context.Context, templateID string) (
 			&i.FileSize,
 			&i.FileHash,
 			&i.CreatedAt,
+			&i.StoredSize,
 		); err != nil {
 			return nil, err
 		}
@@ -399,6 +1251,218 @@ func (q *Queries) ListTemplates(ctx context.Context, arg ListTemplatesParams) ([
 	return items, nil
 }
 
+const listUploadParts = `-- name: ListUploadParts :many
+SELECT upload_id, part_number, size, checksum, created_at FROM "upload_parts" WHERE "upload_id" = ?
+ORDER BY "part_number"
+`
+
+func (q *Queries) ListUploadParts(ctx context.Context, uploadID string) ([]UploadPart, error) {
+	rows, err := q.db.QueryContext(ctx, listUploadParts, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UploadPart{}
+	for rows.Next() {
+		var i UploadPart
+		if err := rows.Scan(
+			&i.UploadID,
+			&i.PartNumber,
+			&i.Size,
+			&i.Checksum,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const putCacheEntry = `-- name: PutCacheEntry :exec
+INSERT INTO "cache_entries" ("key", "size", "accessed_at")
+VALUES (?, ?, ?)
+ON CONFLICT ("key") DO UPDATE SET "size" = excluded."size", "accessed_at" = excluded."accessed_at"
+`
+
+type PutCacheEntryParams struct {
+	Key        string    `json:"key"`
+	Size       int64     `json:"size"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+func (q *Queries) PutCacheEntry(ctx context.Context, arg PutCacheEntryParams) error {
+	_, err := q.db.ExecContext(ctx, putCacheEntry, arg.Key, arg.Size, arg.AccessedAt)
+	return err
+}
+
+const putCacheWriteback = `-- name: PutCacheWriteback :exec
+INSERT INTO "cache_writebacks" ("key") VALUES (?)
+ON CONFLICT ("key") DO UPDATE SET "attempts" = 0, "last_error" = NULL
+`
+
+func (q *Queries) PutCacheWriteback(ctx context.Context, key string) error {
+	_, err := q.db.ExecContext(ctx, putCacheWriteback, key)
+	return err
+}
+
+const putObjectDigest = `-- name: PutObjectDigest :exec
+INSERT INTO "object_digests" ("key", "size", "hash")
+VALUES (?, ?, ?)
+ON CONFLICT ("key") DO UPDATE SET "size" = excluded."size", "hash" = excluded."hash", "created_at" = CURRENT_TIMESTAMP
+`
+
+type PutObjectDigestParams struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+func (q *Queries) PutObjectDigest(ctx context.Context, arg PutObjectDigestParams) error {
+	_, err := q.db.ExecContext(ctx, putObjectDigest, arg.Key, arg.Size, arg.Hash)
+	return err
+}
+
+const putUploadPart = `-- name: PutUploadPart :exec
+INSERT INTO "upload_parts" ("upload_id", "part_number", "size", "checksum")
+VALUES (?, ?, ?, ?)
+ON CONFLICT ("upload_id", "part_number") DO UPDATE SET "size" = excluded."size", "checksum" = excluded."checksum", "created_at" = CURRENT_TIMESTAMP
+`
+
+type PutUploadPartParams struct {
+	UploadID   string `json:"upload_id"`
+	PartNumber int64  `json:"part_number"`
+	Size       int64  `json:"size"`
+	Checksum   string `json:"checksum"`
+}
+
+func (q *Queries) PutUploadPart(ctx context.Context, arg PutUploadPartParams) error {
+	_, err := q.db.ExecContext(ctx, putUploadPart,
+		arg.UploadID,
+		arg.PartNumber,
+		arg.Size,
+		arg.Checksum,
+	)
+	return err
+}
+
+const releaseBlob = `-- name: ReleaseBlob :one
+UPDATE "blobs" SET "ref_count" = "ref_count" - 1
+WHERE "object_key" = ?
+RETURNING object_key, hash, size, ref_count, created_at, chunked, stored_size, compressed
+`
+
+func (q *Queries) ReleaseBlob(ctx context.Context, objectKey string) (Blob, error) {
+	row := q.db.QueryRowContext(ctx, releaseBlob, objectKey)
+	var i Blob
+	err := row.Scan(
+		&i.ObjectKey,
+		&i.Hash,
+		&i.Size,
+		&i.RefCount,
+		&i.CreatedAt,
+		&i.Chunked,
+		&i.StoredSize,
+		&i.Compressed,
+	)
+	return i, err
+}
+
+const releaseChunk = `-- name: ReleaseChunk :one
+UPDATE "chunks" SET "ref_count" = "ref_count" - 1
+WHERE "hash" = ?
+RETURNING hash, object_key, size, ref_count, created_at, stored_size, compressed
+`
+
+func (q *Queries) ReleaseChunk(ctx context.Context, hash string) (Chunk, error) {
+	row := q.db.QueryRowContext(ctx, releaseChunk, hash)
+	var i Chunk
+	err := row.Scan(
+		&i.Hash,
+		&i.ObjectKey,
+		&i.Size,
+		&i.RefCount,
+		&i.CreatedAt,
+		&i.StoredSize,
+		&i.Compressed,
+	)
+	return i, err
+}
+
+const resumeDownloadLink = `-- name: ResumeDownloadLink :one
+UPDATE "download_links" SET "resumes" = "resumes" + 1
+WHERE "id" = ?1 AND "resumes" < "downloads" * ?2
+RETURNING id, template_id, version_number, max_downloads, downloads, expires_at, created_at, resumes
+`
+
+type ResumeDownloadLinkParams struct {
+	ID                 string `json:"id"`
+	ResumesPerDownload int64  `json:"resumes_per_download"`
+}
+
+func (q *Queries) ResumeDownloadLink(ctx context.Context, arg ResumeDownloadLinkParams) (DownloadLink, error) {
+	row := q.db.QueryRowContext(ctx, resumeDownloadLink, arg.ID, arg.ResumesPerDownload)
+	var i DownloadLink
+	err := row.Scan(
+		&i.ID,
+		&i.TemplateID,
+		&i.VersionNumber,
+		&i.MaxDownloads,
+		&i.Downloads,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.Resumes,
+	)
+	return i, err
+}
+
+const reviveObjectTombstone = `-- name: ReviveObjectTombstone :exec
+DELETE FROM "object_tombstones" WHERE "object_key" = ? AND "claimed_at" IS NULL
+`
+
+func (q *Queries) ReviveObjectTombstone(ctx context.Context, objectKey string) error {
+	_, err := q.db.ExecContext(ctx, reviveObjectTombstone, objectKey)
+	return err
+}
+
+const touchCacheEntry = `-- name: TouchCacheEntry :exec
+UPDATE "cache_entries" SET "accessed_at" = ? WHERE "key" = ?
+`
+
+type TouchCacheEntryParams struct {
+	AccessedAt time.Time `json:"accessed_at"`
+	Key        string    `json:"key"`
+}
+
+func (q *Queries) TouchCacheEntry(ctx context.Context, arg TouchCacheEntryParams) error {
+	_, err := q.db.ExecContext(ctx, touchCacheEntry, arg.AccessedAt, arg.Key)
+	return err
+}
+
+const touchUpload = `-- name: TouchUpload :exec
+UPDATE "uploads" SET "updated_at" = CURRENT_TIMESTAMP WHERE "id" = ?
+`
+
+func (q *Queries) TouchUpload(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, touchUpload, id)
+	return err
+}
+
+const unclaimObjectTombstone = `-- name: UnclaimObjectTombstone :exec
+UPDATE "object_tombstones" SET "claimed_at" = NULL WHERE "object_key" = ?
+`
+
+func (q *Queries) UnclaimObjectTombstone(ctx context.Context, objectKey string) error {
+	_, err := q.db.ExecContext(ctx, unclaimObjectTombstone, objectKey)
+	return err
+}
+
 const updateJob = `-- name: UpdateJob :one
 UPDATE jobs
 SET 
@@ -467,3 +1531,25 @@ func (q *Queries) UpdateTemplate(ctx context.Context, arg UpdateTemplateParams)
 	)
 	return i, err
 }
+
+const useDownloadLink = `-- name: UseDownloadLink :one
+UPDATE "download_links" SET "downloads" = "downloads" + 1
+WHERE "id" = ? AND ("max_downloads" IS NULL OR "downloads" < "max_downloads")
+RETURNING id, template_id, version_number, max_downloads, downloads, expires_at, created_at, resumes
+`
+
+func (q *Queries) UseDownloadLink(ctx context.Context, id string) (DownloadLink, error) {
+	row := q.db.QueryRowContext(ctx, useDownloadLink, id)
+	var i DownloadLink
+	err := row.Scan(
+		&i.ID,
+		&i.TemplateID,
+		&i.VersionNumber,
+		&i.MaxDownloads,
+		&i.Downloads,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.Resumes,
+	)
+	return i, err
+}
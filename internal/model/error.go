@@ -20,6 +20,12 @@ func (e Error) Code() string {
 	return e.ErrCode
 }
 
+// Is matches errors by code, so a formatted error matches its template with errors.Is.
+func (e Error) Is(target error) bool {
+	t, ok := target.(Error)
+	return ok && t.ErrCode == e.ErrCode
+}
+
 // Fmt creates a new error from the base error template with provided arguments
 func (e Error) Fmt(args ...any) Error {
 	return Error{
@@ -38,4 +44,8 @@ func NewError(code, message string) Error {
 var (
 	ErrValidation       = NewError("validation", "Validation error: %s")
 	ErrResourceNotFound = NewError("resource.not_found", "Resource not found")
+	// ErrStoreUnavailable is returned without trying when the object store is known to be down
+	ErrStoreUnavailable = NewError("object_store.unavailable", "Object store is unavailable, try again later")
+	// ErrDownloadLinkInvalid is returned for a download link that can't be used, with the reason
+	ErrDownloadLinkInvalid = NewError("download_link.invalid", "Download link is invalid: %s")
 )
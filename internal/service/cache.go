@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/google/uuid"
+
+	"github.com/beanbocchi/templar/internal/db"
+	"github.com/beanbocchi/templar/internal/model"
+)
+
+type CacheVersionParams struct {
+	TemplateID uuid.UUID `validate:"required,uuid"`
+	Version    int64     `validate:"required,min=1"`
+}
+
+// PinVersion keeps every object of a template version in the cache until it
+// is unpinned, and warms it in the background. Pins are stored, so they
+// survive restarts.
+func (s *Service) PinVersion(ctx context.Context, params CacheVersionParams) (db.Job, error) {
+	version, keys, err := s.getVersionObjects(ctx, params)
+	if err != nil {
+		return db.Job{}, err
+	}
+
+	created, err := s.storage.CreateCachePin(ctx, version.ID)
+	if err != nil {
+		return db.Job{}, fmt.Errorf("create cache pin: %w", err)
+	}
+	// Pinning twice is a no-op, the pin counts are per version
+	if created > 0 {
+		for _, key := range keys {
+			s.cache.Pin(key)
+		}
+	}
+
+	return s.startWarm(ctx, version, keys)
+}
+
+// UnpinVersion makes the objects of a template version evictable again,
+// unless another pinned version shares them.
+func (s *Service) UnpinVersion(ctx context.Context, params CacheVersionParams) error {
+	version, keys, err := s.getVersionObjects(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.storage.DeleteCachePin(ctx, version.ID)
+	if err != nil {
+		return fmt.Errorf("delete cache pin: %w", err)
+	}
+	if deleted == 0 {
+		return model.NewError("cache_pin.not_found", "Template %s version %d is not pinned").Fmt(params.TemplateID.String(), params.Version)
+	}
+
+	for _, key := range keys {
+		s.cache.Unpin(ctx, key)
+	}
+	return nil
+}
+
+// WarmVersion fetches a template version into the cache in the background,
+// ahead of the first pull.
+func (s *Service) WarmVersion(ctx context.Context, params CacheVersionParams) (db.Job, error) {
+	version, keys, err := s.getVersionObjects(ctx, params)
+	if err != nil {
+		return db.Job{}, err
+	}
+
+	return s.startWarm(ctx, version, keys)
+}
+
+func (s *Service) ListPinnedVersions(ctx context.Context) ([]db.ListCachePinsRow, error) {
+	pins, err := s.storage.ListCachePins(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list cache pins: %w", err)
+	}
+
+	return pins, nil
+}
+
+// startWarm queues a cache.warm job fetching keys into the cache.
+func (s *Service) startWarm(ctx context.Context, version db.TemplateVersion, keys []string) (db.Job, error) {
+	job, err := s.storage.CreateJob(ctx, db.CreateJobParams{
+		Type:          "cache.warm",
+		TemplateID:    version.TemplateID,
+		VersionNumber: ptr.Int64(version.VersionNumber),
+		Status:        "pending",
+		Progress:      0,
+		StartedAt:     time.Now(),
+	})
+	if err != nil {
+		return db.Job{}, fmt.Errorf("create job: %w", err)
+	}
+
+	s.jobs <- func() {
+		// The job outlives the request that queued it
+		ctx := context.Background()
+		for i, key := range keys {
+			if err := s.cache.Warm(ctx, key); err != nil {
+				s.failJob(ctx, job.ID, err)
+				return
+			}
+			s.storage.UpdateJob(ctx, db.UpdateJobParams{
+				ID:       job.ID,
+				Status:   ptr.String("warming"),
+				Progress: ptr.Int64(int64((i + 1) * 100 / len(keys))),
+			})
+		}
+
+		s.storage.UpdateJob(ctx, db.UpdateJobParams{
+			ID:          job.ID,
+			Status:      ptr.String("completed"),
+			Progress:    ptr.Int64(100),
+			CompletedAt: ptr.Time(time.Now()),
+		})
+	}
+
+	return job, nil
+}
+
+// getVersionObjects returns a template version and the keys of the objects
+// holding its content, in order. A chunk repeated in the content is listed
+// each time, matching ListPinnedObjectKeys.
+func (s *Service) getVersionObjects(ctx context.Context, params CacheVersionParams) (db.TemplateVersion, []string, error) {
+	version, err := s.storage.GetTemplateVersion(ctx, db.GetTemplateVersionParams{
+		TemplateID:    params.TemplateID.String(),
+		VersionNumber: params.Version,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.TemplateVersion{}, nil, model.NewError("template_version.not_found", "Template %s version %d not found").Fmt(params.TemplateID.String(), params.Version)
+		}
+		return db.TemplateVersion{}, nil, fmt.Errorf("get template version: %w", err)
+	}
+
+	keys, err := s.versionObjectKeys(ctx, version)
+	if err != nil {
+		return db.TemplateVersion{}, nil, err
+	}
+	return version, keys, nil
+}
+
+func (s *Service) versionObjectKeys(ctx context.Context, version db.TemplateVersion) ([]string, error) {
+	blob, err := s.storage.GetBlob(ctx, version.ObjectKey)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("get blob: %w", err)
+	}
+	if err != nil || !blob.Chunked {
+		return []string{version.ObjectKey}, nil
+	}
+
+	chunks, err := s.storage.ListBlobChunks(ctx, blob.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("list blob chunks: %w", err)
+	}
+
+	keys := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		keys[i] = getChunkKey(chunk.ChunkHash)
+	}
+	return keys, nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/client/objectstore/cache"
+	"github.com/beanbocchi/templar/internal/model"
+)
+
+// CacheStats is the cache activity since start and its size in bytes.
+type CacheStats struct {
+	Hits             int64   `json:"hits"`
+	Misses           int64   `json:"misses"`
+	HitRatio         float64 `json:"hit_ratio"`
+	BytesFromCache   int64   `json:"bytes_from_cache"`
+	BytesFromPrimary int64   `json:"bytes_from_primary"`
+	Evictions        int64   `json:"evictions"`
+	Size             int64   `json:"size"`
+	PinnedSize       int64   `json:"pinned_size"`
+	MaxSize          int64   `json:"max_size"`
+	PendingWriteBack int     `json:"pending_write_back"`
+}
+
+type CacheEntry struct {
+	Key        string    `json:"key"`
+	Size       int64     `json:"size"`
+	AccessedAt time.Time `json:"accessed_at"`
+	Pinned     bool      `json:"pinned"`
+}
+
+type ListCacheEntriesParams struct {
+	model.PaginationParams
+}
+
+type EvictCacheEntryParams struct {
+	Key string `validate:"required"`
+}
+
+func (s *Service) GetCacheStats() CacheStats {
+	stats := s.cache.Stats()
+
+	result := CacheStats{
+		Hits:             stats.Hits,
+		Misses:           stats.Misses,
+		BytesFromCache:   stats.BytesFromCache,
+		BytesFromPrimary: stats.BytesFromPrimary,
+		Evictions:        stats.Evictions,
+		Size:             stats.Usage.Size,
+		PinnedSize:       stats.Usage.PinnedSize,
+		MaxSize:          stats.Usage.MaxSize,
+		PendingWriteBack: stats.PendingWriteBack,
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		result.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	return result
+}
+
+// ListCacheEntries lists the cached objects, most recently used first.
+func (s *Service) ListCacheEntries(ctx context.Context, params ListCacheEntriesParams) ([]CacheEntry, error) {
+	entries, err := s.cache.RecentEntries(ctx, int(params.GetLimit()), int(params.Offset()))
+	if err != nil {
+		return nil, fmt.Errorf("list cache entries: %w", err)
+	}
+
+	result := make([]CacheEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, CacheEntry{
+			Key:        entry.Key,
+			Size:       entry.Size,
+			AccessedAt: entry.AccessedAt,
+			Pinned:     entry.Pinned,
+		})
+	}
+	return result, nil
+}
+
+// EvictCacheEntry drops an object from the cache, primary keeps it.
+func (s *Service) EvictCacheEntry(ctx context.Context, params EvictCacheEntryParams) error {
+	err := s.cache.Evict(ctx, params.Key)
+	switch {
+	case errors.Is(err, cache.ErrPinned):
+		return model.NewError("cache_entry.pinned", "Cache entry %s is pinned").Fmt(params.Key)
+	case errors.Is(err, objectstore.ErrNotFound):
+		return model.NewError("cache_entry.not_found", "Cache entry %s not found").Fmt(params.Key)
+	case err != nil:
+		return fmt.Errorf("evict cache entry: %w", err)
+	}
+	return nil
+}
+
+// PurgeCache drops every unpinned object from the cache and returns how many
+// were dropped.
+func (s *Service) PurgeCache(ctx context.Context) (int, error) {
+	purged, err := s.cache.Purge(ctx)
+	if err != nil {
+		return purged, fmt.Errorf("purge cache: %w", err)
+	}
+	return purged, nil
+}
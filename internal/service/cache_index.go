@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore/cache"
+	"github.com/beanbocchi/templar/internal/db"
+	"github.com/beanbocchi/templar/pkg/sqlc"
+)
+
+// cacheIndex persists the cache eviction state in the cache_entries table.
+// Access times are stored in UTC, so ListRecent can order them in SQL.
+type cacheIndex struct {
+	storage *sqlc.Storage
+}
+
+func (i *cacheIndex) List(ctx context.Context) ([]cache.IndexEntry, error) {
+	rows, err := i.storage.ListCacheEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]cache.IndexEntry, len(rows))
+	for n, row := range rows {
+		entries[n] = cache.IndexEntry{
+			Key:        row.Key,
+			Size:       row.Size,
+			AccessedAt: row.AccessedAt,
+		}
+	}
+	return entries, nil
+}
+
+func (i *cacheIndex) ListRecent(ctx context.Context, limit, offset int) ([]cache.IndexEntry, error) {
+	rows, err := i.storage.ListCacheEntriesByAccess(ctx, db.ListCacheEntriesByAccessParams{
+		Limit:  int64(limit),
+		Offset: int64(offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]cache.IndexEntry, len(rows))
+	for n, row := range rows {
+		entries[n] = cache.IndexEntry{
+			Key:        row.Key,
+			Size:       row.Size,
+			AccessedAt: row.AccessedAt,
+		}
+	}
+	return entries, nil
+}
+
+func (i *cacheIndex) Put(ctx context.Context, entry cache.IndexEntry) error {
+	return i.storage.PutCacheEntry(ctx, db.PutCacheEntryParams{
+		Key:        entry.Key,
+		Size:       entry.Size,
+		AccessedAt: entry.AccessedAt.UTC(),
+	})
+}
+
+// Touch updates the entries in one transaction, so a batch is a single commit.
+func (i *cacheIndex) Touch(ctx context.Context, accessed map[string]time.Time) error {
+	tx, err := i.storage.BeginTx()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	for key, accessedAt := range accessed {
+		if err := tx.TouchCacheEntry(ctx, db.TouchCacheEntryParams{
+			AccessedAt: accessedAt.UTC(),
+			Key:        key,
+		}); err != nil {
+			return fmt.Errorf("touch %s: %w", key, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+func (i *cacheIndex) Delete(ctx context.Context, key string) error {
+	return i.storage.DeleteCacheEntry(ctx, key)
+}
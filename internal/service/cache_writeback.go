@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore/cache"
+	"github.com/beanbocchi/templar/internal/db"
+	"github.com/beanbocchi/templar/pkg/sqlc"
+)
+
+// cacheWriteBackLog persists the objects waiting to be written back in the
+// cache_writebacks table.
+type cacheWriteBackLog struct {
+	storage *sqlc.Storage
+}
+
+func (l *cacheWriteBackLog) List(ctx context.Context) ([]cache.WriteBackEntry, error) {
+	rows, err := l.storage.ListCacheWritebacks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]cache.WriteBackEntry, len(rows))
+	for n, row := range rows {
+		entries[n] = cache.WriteBackEntry{
+			Key:      row.Key,
+			Attempts: row.Attempts,
+		}
+	}
+	return entries, nil
+}
+
+func (l *cacheWriteBackLog) Put(ctx context.Context, key string) error {
+	return l.storage.PutCacheWriteback(ctx, key)
+}
+
+func (l *cacheWriteBackLog) Fail(ctx context.Context, key string, err error) error {
+	message := err.Error()
+	return l.storage.FailCacheWriteback(ctx, db.FailCacheWritebackParams{
+		LastError: &message,
+		Key:       key,
+	})
+}
+
+func (l *cacheWriteBackLog) Delete(ctx context.Context, key string) error {
+	return l.storage.DeleteCacheWriteback(ctx, key)
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/beanbocchi/templar/internal/db"
+	"github.com/beanbocchi/templar/internal/model"
+	"github.com/beanbocchi/templar/pkg/sqlc"
+)
+
+type DeleteVersionParams struct {
+	TemplateID uuid.UUID `validate:"required,uuid"`
+	Version    int64     `validate:"required,min=1"`
+}
+
+// DeleteVersion deletes a template version and drops its reference on the
+// blob. Once no version uses the blob, its objects, and those of the chunks
+// only it used, are left to the garbage collector.
+func (s *Service) DeleteVersion(ctx context.Context, params DeleteVersionParams) error {
+	version, err := s.storage.GetTemplateVersion(ctx, db.GetTemplateVersionParams{
+		TemplateID:    params.TemplateID.String(),
+		VersionNumber: params.Version,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.NewError("template_version.not_found", "Template %s version %d not found").Fmt(params.TemplateID.String(), params.Version)
+		}
+		return fmt.Errorf("get template version: %w", err)
+	}
+
+	// Listed before the manifest is deleted, to drop a pin on the version
+	versionKeys, err := s.versionObjectKeys(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.storage.BeginTx()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	pinned, err := tx.DeleteCachePin(ctx, version.ID)
+	if err != nil {
+		return fmt.Errorf("delete cache pin: %w", err)
+	}
+
+	if err := tx.DeleteTemplateVersion(ctx, version.ID); err != nil {
+		return fmt.Errorf("delete template version: %w", err)
+	}
+
+	blob, err := tx.ReleaseBlob(ctx, version.ObjectKey)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("release blob: %w", err)
+	}
+
+	if err == nil && blob.RefCount <= 0 {
+		keys, err := s.deleteBlob(ctx, tx, blob)
+		if err != nil {
+			return err
+		}
+
+		// The objects are only tombstoned here, the garbage collector deletes
+		// them once committed, so no remote call holds the write lock and a
+		// rollback can't leave rows pointing at deleted objects
+		for _, key := range keys {
+			if err := tx.CreateObjectTombstone(ctx, key); err != nil {
+				return fmt.Errorf("create tombstone: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+
+	if pinned > 0 {
+		for _, key := range versionKeys {
+			s.cache.Unpin(ctx, key)
+		}
+	}
+
+	return nil
+}
+
+// deleteBlob removes an unreferenced blob, its manifest and the chunks no
+// other blob uses. It returns the object keys nothing refers to anymore.
+func (s *Service) deleteBlob(ctx context.Context, tx *sqlc.TxStorage, blob db.Blob) ([]string, error) {
+	if !blob.Chunked {
+		if err := tx.DeleteBlob(ctx, blob.ObjectKey); err != nil {
+			return nil, fmt.Errorf("delete blob: %w", err)
+		}
+		return []string{blob.ObjectKey}, nil
+	}
+
+	// The manifest is read before the blob goes, with foreign keys enforced
+	// deleting the blob would cascade to it
+	chunks, err := tx.ListBlobChunks(ctx, blob.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("list blob chunks: %w", err)
+	}
+	if err := tx.DeleteBlobChunks(ctx, blob.ObjectKey); err != nil {
+		return nil, fmt.Errorf("delete blob chunks: %w", err)
+	}
+	if err := tx.DeleteBlob(ctx, blob.ObjectKey); err != nil {
+		return nil, fmt.Errorf("delete blob: %w", err)
+	}
+
+	var keys []string
+	for _, chunk := range chunks {
+		released, err := tx.ReleaseChunk(ctx, chunk.ChunkHash)
+		if err != nil {
+			return nil, fmt.Errorf("release chunk: %w", err)
+		}
+		if released.RefCount > 0 {
+			continue
+		}
+		if err := tx.DeleteChunk(ctx, released.Hash); err != nil {
+			return nil, fmt.Errorf("delete chunk: %w", err)
+		}
+		keys = append(keys, released.ObjectKey)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/smithy-go/ptr"
+
+	"github.com/beanbocchi/templar/internal/db"
+)
+
+// tombstoneClaimTimeout is how long a claimed tombstone waits for its delete
+// before another pass takes it over, such as after a crash.
+const tombstoneClaimTimeout = 10 * time.Minute
+
+// gcLoop deletes unused objects every interval.
+func (s *Service) gcLoop(interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.collectGarbage(context.Background(), grace)
+	}
+}
+
+// collectGarbage deletes the objects DeleteVersion tombstoned more than grace
+// ago. Each tombstone is claimed before its object is deleted, so a push
+// reviving the object in between either cancels the delete or waits for it.
+func (s *Service) collectGarbage(ctx context.Context, grace time.Duration) {
+	// Pushed again since they were tombstoned
+	if err := s.storage.DeleteReferencedObjectTombstones(ctx); err != nil {
+		slog.Warn("failed to delete referenced tombstones", "error", err)
+	}
+
+	now := time.Now().UTC()
+	claimedBefore := now.Add(-tombstoneClaimTimeout)
+	tombstones, err := s.storage.ListObjectTombstones(ctx, db.ListObjectTombstonesParams{
+		CreatedBefore: now.Add(-grace),
+		ClaimedBefore: &claimedBefore,
+	})
+	if err != nil {
+		slog.Error("failed to list tombstones", "error", err)
+		return
+	}
+
+	deleted, failed := 0, 0
+	for _, tombstone := range tombstones {
+		claimed, err := s.storage.ClaimObjectTombstone(ctx, db.ClaimObjectTombstoneParams{
+			ClaimedAt:     ptr.Time(time.Now().UTC()),
+			ObjectKey:     tombstone.ObjectKey,
+			ClaimedBefore: &claimedBefore,
+		})
+		if err != nil {
+			slog.Warn("failed to claim tombstone", "key", tombstone.ObjectKey, "error", err)
+			failed++
+			continue
+		}
+		if claimed == 0 {
+			// Revived or referenced again since listed
+			continue
+		}
+
+		if err := s.objectStore.Delete(ctx, tombstone.ObjectKey); err != nil {
+			slog.Warn("failed to delete object", "key", tombstone.ObjectKey, "error", err)
+			if err := s.storage.UnclaimObjectTombstone(ctx, tombstone.ObjectKey); err != nil {
+				slog.Warn("failed to unclaim tombstone", "key", tombstone.ObjectKey, "error", err)
+			}
+			failed++
+			continue
+		}
+		if err := s.storage.DeleteObjectTombstone(ctx, tombstone.ObjectKey); err != nil {
+			slog.Warn("failed to delete tombstone", "key", tombstone.ObjectKey, "error", err)
+		}
+		deleted++
+	}
+
+	if deleted > 0 || failed > 0 {
+		slog.Info("garbage collection finished", "deleted", deleted, "failed", failed)
+	}
+}
+
+// tombstoneChunks leaves the chunks a failed push uploaded to the garbage
+// collector, nothing references them. One referenced by the time the
+// collector runs, by a push of the same content, is kept.
+func (s *Service) tombstoneChunks(ctx context.Context, chunks []chunkRef) {
+	for _, chunk := range chunks {
+		if chunk.Uploaded {
+			s.tombstoneObject(ctx, chunk.Key)
+		}
+	}
+}
+
+// tombstoneObject leaves an object a failed push uploaded to the garbage
+// collector, like tombstoneChunks.
+func (s *Service) tombstoneObject(ctx context.Context, key string) {
+	if err := s.storage.CreateObjectTombstone(ctx, key); err != nil {
+		slog.Warn("failed to tombstone object", "key", key, "error", err)
+	}
+}
+
+// reviveObject cancels the pending delete of an object about to be uploaded
+// again. If the delete is already under way it waits for it to finish, so it
+// can't remove the new upload.
+func (s *Service) reviveObject(ctx context.Context, key string) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		tombstone, err := s.storage.GetObjectTombstone(ctx, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get tombstone: %w", err)
+		}
+
+		if tombstone.ClaimedAt == nil {
+			if err := s.storage.ReviveObjectTombstone(ctx, key); err != nil {
+				return fmt.Errorf("revive tombstone: %w", err)
+			}
+			// Claimed in between if it is still there
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/beanbocchi/templar/internal/db"
+	"github.com/beanbocchi/templar/internal/model"
+)
+
+// resumesPerDownload bounds how many ranged requests may continue each counted
+// download of a link, so an exhausted link can't keep serving the file in
+// ranges.
+const resumesPerDownload = 16
+
+// DownloadLink is a signed URL a template version can be downloaded from
+// without credentials, until it expires or runs out of downloads.
+type DownloadLink struct {
+	ID           string    `json:"id"`
+	TemplateID   string    `json:"template_id"`
+	Version      int64     `json:"version"`
+	URL          string    `json:"url"`
+	MaxDownloads *int64    `json:"max_downloads"`
+	Downloads    int64     `json:"downloads"`
+	Resumes      int64     `json:"resumes"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type CreateDownloadLinkParams struct {
+	TemplateID uuid.UUID `validate:"required,uuid"`
+	Version    int64     `validate:"required,min=1"`
+	// TTL is in seconds, presignedDefaultTTL when zero
+	TTL int64 `validate:"gte=0"`
+	// MaxDownloads is how many times the link can be used, zero for no limit
+	MaxDownloads int64 `validate:"gte=0"`
+}
+
+// CreateDownloadLink issues a signed link to a template version. The expiry
+// is part of the signature, and the link is recorded so downloads can be
+// counted and the link revoked.
+func (s *Service) CreateDownloadLink(ctx context.Context, params CreateDownloadLinkParams) (DownloadLink, error) {
+	if _, err := s.storage.GetTemplateVersion(ctx, db.GetTemplateVersionParams{
+		TemplateID:    params.TemplateID.String(),
+		VersionNumber: params.Version,
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DownloadLink{}, model.NewError("template_version.not_found", "Template %s version %d not found").Fmt(params.TemplateID.String(), params.Version)
+		}
+		return DownloadLink{}, fmt.Errorf("get template version: %w", err)
+	}
+
+	// Expired links can't be used anymore, drop them while we are here
+	now := time.Now().UTC()
+	if err := s.storage.DeleteExpiredDownloadLinks(ctx, now); err != nil {
+		slog.Warn("failed to delete expired download links", "error", err)
+	}
+
+	ttl := s.presignedTTL
+	if params.TTL > 0 {
+		ttl = time.Duration(params.TTL) * time.Second
+	}
+
+	var maxDownloads *int64
+	if params.MaxDownloads > 0 {
+		maxDownloads = &params.MaxDownloads
+	}
+
+	link, err := s.storage.CreateDownloadLink(ctx, db.CreateDownloadLinkParams{
+		ID:            uuid.New().String(),
+		TemplateID:    params.TemplateID.String(),
+		VersionNumber: params.Version,
+		MaxDownloads:  maxDownloads,
+		// The URL carries the expiry in seconds
+		ExpiresAt: now.Add(ttl).Truncate(time.Second),
+	})
+	if err != nil {
+		return DownloadLink{}, fmt.Errorf("create download link: %w", err)
+	}
+
+	return s.newDownloadLink(link), nil
+}
+
+type GetDownloadLinkParams struct {
+	LinkID uuid.UUID `validate:"required,uuid"`
+}
+
+// GetDownloadLink returns a download link and how many times it was used.
+func (s *Service) GetDownloadLink(ctx context.Context, params GetDownloadLinkParams) (DownloadLink, error) {
+	link, err := s.getDownloadLink(ctx, params.LinkID.String())
+	if err != nil {
+		return DownloadLink{}, err
+	}
+	return s.newDownloadLink(link), nil
+}
+
+type RevokeDownloadLinkParams struct {
+	LinkID uuid.UUID `validate:"required,uuid"`
+}
+
+// RevokeDownloadLink makes a link unusable before it expires.
+func (s *Service) RevokeDownloadLink(ctx context.Context, params RevokeDownloadLinkParams) error {
+	if _, err := s.getDownloadLink(ctx, params.LinkID.String()); err != nil {
+		return err
+	}
+	if err := s.storage.DeleteDownloadLink(ctx, params.LinkID.String()); err != nil {
+		return fmt.Errorf("delete download link: %w", err)
+	}
+	return nil
+}
+
+type OpenDownloadLinkParams struct {
+	LinkID    uuid.UUID `validate:"required,uuid"`
+	Expires   int64     `validate:"required"`
+	Signature string    `validate:"required,len=64,hexadecimal"`
+	// Resumed is set for range requests past the start of the file, which
+	// continue a download already counted
+	Resumed bool
+}
+
+// OpenDownloadLink checks a link's signature and expiry, counts the download
+// and opens the template version. The version is opened first, so a download
+// the store can't serve doesn't use up the link. A resumed download isn't
+// counted again, but needs the link to have been used, and each download can
+// only be resumed resumesPerDownload times.
+func (s *Service) OpenDownloadLink(ctx context.Context, params OpenDownloadLinkParams) (*PullResult, error) {
+	id := params.LinkID.String()
+	if !hmac.Equal([]byte(s.signDownloadLink(id, params.Expires)), []byte(params.Signature)) {
+		return nil, model.ErrDownloadLinkInvalid.Fmt("bad signature")
+	}
+	if time.Now().Unix() >= params.Expires {
+		return nil, model.ErrDownloadLinkInvalid.Fmt("expired")
+	}
+
+	link, err := s.storage.GetDownloadLink(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, model.ErrDownloadLinkInvalid.Fmt("revoked")
+		}
+		return nil, fmt.Errorf("get download link: %w", err)
+	}
+	if params.Resumed && link.Resumes >= link.Downloads*resumesPerDownload {
+		return nil, model.ErrDownloadLinkInvalid.Fmt("no download to resume")
+	}
+
+	templateID, err := uuid.Parse(link.TemplateID)
+	if err != nil {
+		return nil, fmt.Errorf("parse template id: %w", err)
+	}
+	result, err := s.Pull(ctx, PullParams{
+		TemplateID: templateID,
+		Version:    link.VersionNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if params.Resumed {
+		_, err = s.storage.ResumeDownloadLink(ctx, db.ResumeDownloadLinkParams{
+			ID:                 id,
+			ResumesPerDownload: resumesPerDownload,
+		})
+		if err != nil {
+			result.Content.Close()
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, model.ErrDownloadLinkInvalid.Fmt("no download to resume")
+			}
+			return nil, fmt.Errorf("resume download link: %w", err)
+		}
+		return result, nil
+	}
+
+	// Counting is atomic, concurrent requests can't exceed the limit
+	if _, err := s.storage.UseDownloadLink(ctx, id); err != nil {
+		result.Content.Close()
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, model.ErrDownloadLinkInvalid.Fmt("no downloads left")
+		}
+		return nil, fmt.Errorf("use download link: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s *Service) getDownloadLink(ctx context.Context, id string) (db.DownloadLink, error) {
+	link, err := s.storage.GetDownloadLink(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.DownloadLink{}, model.NewError("download_link.not_found", "Download link %s not found").Fmt(id)
+		}
+		return db.DownloadLink{}, fmt.Errorf("get download link: %w", err)
+	}
+	return link, nil
+}
+
+// signDownloadLink signs a link ID together with its expiry, so neither can
+// be changed in the URL.
+func (s *Service) signDownloadLink(id string, expires int64) string {
+	mac := hmac.New(sha256.New, s.presignedSecret)
+	fmt.Fprintf(mac, "%s:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Service) newDownloadLink(link db.DownloadLink) DownloadLink {
+	expires := link.ExpiresAt.Unix()
+	query := url.Values{}
+	query.Set("expires", fmt.Sprint(expires))
+	query.Set("signature", s.signDownloadLink(link.ID, expires))
+
+	return DownloadLink{
+		ID:           link.ID,
+		TemplateID:   link.TemplateID,
+		Version:      link.VersionNumber,
+		URL:          fmt.Sprintf("%s/%s?%s", s.downloadURL, link.ID, query.Encode()),
+		MaxDownloads: link.MaxDownloads,
+		Downloads:    link.Downloads,
+		Resumes:      link.Resumes,
+		ExpiresAt:    link.ExpiresAt,
+		CreatedAt:    link.CreatedAt,
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/beanbocchi/templar/config"
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+)
+
+// multipartStore is a backend that can list its multipart sessions, under
+// the name it is configured with.
+type multipartStore struct {
+	name     string
+	sessions objectstore.MultipartSessions
+}
+
+// multipartStores returns the backends that can list their multipart
+// sessions. backends are the primary then the replicas, as newDurableStore
+// returns them.
+func multipartStores(config *config.Config, backends []objectstore.Client, cacheTier objectstore.Client) []multipartStore {
+	names := []string{"primary"}
+	for _, r := range config.Objectstore.Replication.Replicas {
+		names = append(names, r.Name)
+	}
+	names = append(names, "cache")
+
+	var stores []multipartStore
+	for i, client := range append(backends, cacheTier) {
+		if sessions, ok := client.(objectstore.MultipartSessions); ok {
+			stores = append(stores, multipartStore{name: names[i], sessions: sessions})
+		}
+	}
+	return stores
+}
+
+// MultipartSession is a multipart session open on a backend, with the parts
+// it received so far.
+type MultipartSession struct {
+	Backend   string                 `json:"backend"`
+	Key       string                 `json:"key"`
+	UploadID  string                 `json:"upload_id"`
+	CreatedAt time.Time              `json:"created_at"`
+	Parts     []objectstore.PartInfo `json:"parts"`
+}
+
+type ListMultipartSessionsParams struct {
+	Prefix string
+}
+
+// ListMultipartSessions lists the multipart sessions open on the backends
+// that can list them, so the ones an interrupted push or upload left behind
+// can be told apart from those still in progress.
+func (s *Service) ListMultipartSessions(ctx context.Context, params ListMultipartSessionsParams) ([]MultipartSession, error) {
+	sessions := []MultipartSession{}
+	for _, store := range s.multipartStores {
+		listed, err := store.sessions.ListMultipart(ctx, params.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("list %s multipart sessions: %w", store.name, err)
+		}
+
+		for _, session := range listed {
+			parts, err := store.sessions.ListParts(ctx, session.Key, session.UploadID)
+			if err != nil {
+				// Completed or aborted since it was listed
+				slog.Debug("failed to list multipart parts", "backend", store.name, "upload", session.UploadID, "error", err)
+				continue
+			}
+			sessions = append(sessions, MultipartSession{
+				Backend:   store.name,
+				Key:       session.Key,
+				UploadID:  session.UploadID,
+				CreatedAt: session.CreatedAt,
+				Parts:     parts,
+			})
+		}
+	}
+	return sessions, nil
+}
+
+// multipartJanitor aborts the multipart sessions idle for longer than expiry
+// every interval, along with the resumable pushes they belong to.
+func (s *Service) multipartJanitor(interval, expiry time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		before := time.Now().Add(-expiry)
+
+		// Through the service first, so the sessions leave no upload behind
+		expired, err := s.expireUploads(ctx, before)
+		if err != nil {
+			slog.Warn("failed to expire uploads", "error", err)
+		}
+		if expired > 0 {
+			slog.Info("expired uploads", "uploads", expired)
+		}
+
+		for _, store := range s.multipartStores {
+			expired, err := store.sessions.ExpireMultipart(ctx, before)
+			if err != nil {
+				slog.Warn("failed to expire multipart sessions", "backend", store.name, "error", err)
+			}
+			if expired > 0 {
+				slog.Info("expired multipart sessions", "backend", store.name, "sessions", expired)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore/cache"
+	"github.com/beanbocchi/templar/internal/db"
+	"github.com/beanbocchi/templar/pkg/sqlc"
+)
+
+// objectDigests keeps the digests cache fills are verified against in the
+// object_digests table. Objects stored before digests were recorded fall back
+// to their chunk or blob row. Those describe the content before compression
+// or encryption, so the hash is only used when the stored size shows the
+// object was stored as is.
+type objectDigests struct {
+	storage *sqlc.Storage
+}
+
+func (d *objectDigests) Get(ctx context.Context, key string) (cache.Digest, error) {
+	digest, err := d.storage.GetObjectDigest(ctx, key)
+	if err == nil {
+		return cache.Digest{Size: digest.Size, Hash: digest.Hash}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return cache.Digest{}, err
+	}
+
+	var size int64
+	var storedSize *int64
+	var hash string
+	if chunkHash, ok := strings.CutPrefix(key, "chunks/"); ok {
+		chunk, err := d.storage.GetChunk(ctx, chunkHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			return cache.Digest{}, cache.ErrNoDigest
+		}
+		if err != nil {
+			return cache.Digest{}, err
+		}
+		size, storedSize, hash = chunk.Size, chunk.StoredSize, chunk.Hash
+	} else {
+		blob, err := d.storage.GetBlob(ctx, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			return cache.Digest{}, cache.ErrNoDigest
+		}
+		if err != nil {
+			return cache.Digest{}, err
+		}
+		if blob.Size == nil {
+			return cache.Digest{}, cache.ErrNoDigest
+		}
+		size, storedSize = *blob.Size, blob.StoredSize
+		if blob.Hash != nil {
+			hash = *blob.Hash
+		}
+	}
+
+	if storedSize != nil && *storedSize != size {
+		return cache.Digest{Size: *storedSize}, nil
+	}
+	return cache.Digest{Size: size, Hash: hash}, nil
+}
+
+func (d *objectDigests) Put(ctx context.Context, key string, digest cache.Digest) error {
+	return d.storage.PutObjectDigest(ctx, db.PutObjectDigestParams{
+		Key:  key,
+		Size: digest.Size,
+		Hash: digest.Hash,
+	})
+}
+
+func (d *objectDigests) Delete(ctx context.Context, key string) error {
+	return d.storage.DeleteObjectDigest(ctx, key)
+}
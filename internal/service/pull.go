@@ -9,6 +9,7 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/beanbocchi/templar/internal/client/objectstore"
 	"github.com/beanbocchi/templar/internal/db"
 	"github.com/beanbocchi/templar/internal/model"
 )
@@ -16,26 +17,116 @@ import (
 type PullParams struct {
 	TemplateID uuid.UUID `validate:"required,uuid"`
 	Version    int64     `validate:"required,min=1"`
+	// Found is the version when the caller already looked it up, as PullURL
+	// does, so it isn't queried again
+	Found *db.TemplateVersion
 }
 
-func (s *Service) Pull(ctx context.Context, params PullParams) (io.ReadCloser, error) {
-	key := getKey(params.TemplateID, params.Version)
+// PullResult is an opened template version. Content is fetched lazily, so
+// seeking before reading only downloads the requested range.
+type PullResult struct {
+	Version db.TemplateVersion
+	Size    int64
+	Content io.ReadSeekCloser
+}
+
+func (s *Service) Pull(ctx context.Context, params PullParams) (*PullResult, error) {
+	version, err := s.getPullVersion(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := s.storage.GetBlob(ctx, version.ObjectKey)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("get blob: %w", err)
+	}
+	if err == nil && blob.Chunked {
+		return s.pullChunked(ctx, version, blob)
+	}
+
+	// Blobs stored before chunking are a single object
+	key := version.ObjectKey
+
+	// Stat up front so a missing object fails before any response is written
+	info, err := s.objectStore.Stat(ctx, key)
+	if errors.Is(err, model.ErrStoreUnavailable) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, model.NewError("object_store.get", "Failed to get object from object store: %w").Fmt(err)
+	}
+
+	size := info.Size
+	if version.FileSize != nil {
+		size = *version.FileSize
+	}
+
+	return &PullResult{
+		Version: version,
+		Size:    size,
+		Content: objectstore.NewReadSeeker(ctx, s.readStore(blob.Compressed), key, size),
+	}, nil
+}
 
-	// Check if the template version exists, if not return an error
-	if _, err := s.storage.GetTemplateVersion(ctx, db.GetTemplateVersionParams{
+// getPullVersion returns the version to pull, unless the caller found it.
+func (s *Service) getPullVersion(ctx context.Context, params PullParams) (db.TemplateVersion, error) {
+	if params.Found != nil {
+		return *params.Found, nil
+	}
+	version, err := s.storage.GetTemplateVersion(ctx, db.GetTemplateVersionParams{
 		TemplateID:    params.TemplateID.String(),
 		VersionNumber: params.Version,
-	}); err != nil {
+	})
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, model.NewError("template_version.not_found", "Template %s version %d not found").Fmt(params.TemplateID.String(), params.Version)
+			return db.TemplateVersion{}, model.NewError("template_version.not_found", "Template %s version %d not found").Fmt(params.TemplateID.String(), params.Version)
 		}
-		return nil, fmt.Errorf("get template version: %w", err)
+		return db.TemplateVersion{}, fmt.Errorf("get template version: %w", err)
 	}
+	return version, nil
+}
 
-	file, err := s.objectStore.Download(ctx, key)
+// pullChunked reassembles a chunked blob from its manifest.
+func (s *Service) pullChunked(ctx context.Context, version db.TemplateVersion, blob db.Blob) (*PullResult, error) {
+	chunks, err := s.storage.ListBlobChunks(ctx, blob.ObjectKey)
 	if err != nil {
-		return nil, model.NewError("object_store.get", "Failed to get object from object store: %w").Fmt(err)
+		return nil, fmt.Errorf("list blob chunks: %w", err)
+	}
+
+	segments := make([]objectstore.Segment, len(chunks))
+	var size int64
+	for i, chunk := range chunks {
+		segments[i] = objectstore.Segment{
+			Key:    getChunkKey(chunk.ChunkHash),
+			Size:   chunk.Size,
+			Client: s.readStore(chunk.Compressed),
+		}
+		size += chunk.Size
 	}
 
-	return file, nil
+	if version.FileSize != nil && *version.FileSize != size {
+		return nil, fmt.Errorf("manifest of %s has %d bytes, expected %d", blob.ObjectKey, size, *version.FileSize)
+	}
+
+	// Chunks open lazily, check the store answers before any response is written
+	if len(segments) > 0 {
+		if _, err := s.objectStore.Stat(ctx, segments[0].Key); errors.Is(err, model.ErrStoreUnavailable) {
+			return nil, err
+		}
+	}
+
+	return &PullResult{
+		Version: version,
+		Size:    size,
+		Content: objectstore.NewMultiReadSeeker(ctx, s.objectStore, segments, s.prefetch),
+	}, nil
+}
+
+// readStore returns the store to read an object through, by whether it was
+// stored compressed.
+func (s *Service) readStore(compressed bool) objectstore.Client {
+	if compressed {
+		return s.compressedStore
+	}
+	return s.uncompressedStore
 }
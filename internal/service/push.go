@@ -1,23 +1,29 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime/multipart"
+	"sync"
 	"time"
 
 	"github.com/aws/smithy-go/ptr"
 	"github.com/google/uuid"
-	"github.com/zeebo/blake3"
+	"golang.org/x/sync/errgroup"
 
+	"github.com/beanbocchi/templar/internal/client/objectstore"
 	"github.com/beanbocchi/templar/internal/db"
 	"github.com/beanbocchi/templar/internal/model"
+	"github.com/beanbocchi/templar/internal/utils/blake3"
+	"github.com/beanbocchi/templar/internal/utils/fastcdc"
+	"github.com/beanbocchi/templar/internal/utils/ioutil"
 	"github.com/beanbocchi/templar/internal/utils/progressr"
+	"github.com/beanbocchi/templar/pkg/sqlc"
 )
 
 type PushParams struct {
@@ -40,13 +46,225 @@ func (s *Service) Push(ctx context.Context, params PushParams) error {
 		return fmt.Errorf("create job: %w", err)
 	}
 
+	if err := s.ensureTemplate(ctx, params.TemplateID); err != nil {
+		s.failJob(ctx, job.ID, err)
+		return err
+	}
+	if err := s.checkVersionFree(ctx, params.TemplateID, params.Version); err != nil {
+		s.failJob(ctx, job.ID, err)
+		return err
+	}
+
+	slog.Debug("pushing template", "template", params.TemplateID, "version", params.Version)
+
+	src, err := params.File.Open()
+	if err != nil {
+		s.failJob(ctx, job.ID, err)
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer src.Close()
+
+	// Hash before uploading: objects are keyed by content, and content that is
+	// already stored doesn't need uploading again. The multipart file is
+	// already spooled locally, so reading it twice is cheap.
+	hashStr, err := blake3.Compute(src)
+	if err != nil {
+		s.failJob(ctx, job.ID, err)
+		return fmt.Errorf("hash file: %w", err)
+	}
+	slog.Debug("hashed template", "template", params.TemplateID, "version", params.Version, "hash", hashStr)
+
+	// Storing races with DeleteVersion, which can remove content between our
+	// check and our transaction. That is detected and simply retried.
+	for attempt := 1; ; attempt++ {
+		err = s.storeVersion(ctx, job.ID, params, src, hashStr)
+		if !errors.Is(err, errContentDeleted) || attempt == maxStoreAttempts {
+			break
+		}
+	}
+	if err != nil {
+		s.failJob(ctx, job.ID, err)
+		return err
+	}
+
+	// Mark job as completed
+	s.storage.UpdateJob(ctx, db.UpdateJobParams{
+		ID:          job.ID,
+		Status:      ptr.String("completed"),
+		Progress:    ptr.Int64(100),
+		CompletedAt: ptr.Time(time.Now()),
+	})
+
+	return nil
+}
+
+type PushStreamParams struct {
+	TemplateID uuid.UUID `validate:"required,uuid"`
+	Version    int64     `validate:"required,min=1"`
+	Content    io.Reader
+	// Size is the content length for progress, -1 if unknown
+	Size int64
+	// Hash is the expected hex BLAKE3 hash of Content, optional
+	Hash string `validate:"omitempty,len=64,hexadecimal"`
+}
+
+// PushStream pushes a template read from a stream, such as a raw request
+// body. Content is chunked and uploaded as it arrives, nothing is spooled, so
+// the hash is only known at the end.
+func (s *Service) PushStream(ctx context.Context, params PushStreamParams) error {
+	job, err := s.storage.CreateJob(ctx, db.CreateJobParams{
+		Type:          "template.push",
+		TemplateID:    params.TemplateID.String(),
+		VersionNumber: ptr.Int64(params.Version),
+		Status:        "pending",
+		Progress:      0,
+		StartedAt:     time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("create job: %w", err)
+	}
+
+	if err := s.ensureTemplate(ctx, params.TemplateID); err != nil {
+		s.failJob(ctx, job.ID, err)
+		return err
+	}
+	if err := s.checkVersionFree(ctx, params.TemplateID, params.Version); err != nil {
+		s.failJob(ctx, job.ID, err)
+		return err
+	}
+
+	if err := s.storeStream(ctx, job.ID, params); err != nil {
+		s.failJob(ctx, job.ID, err)
+		return err
+	}
+
+	s.storage.UpdateJob(ctx, db.UpdateJobParams{
+		ID:          job.ID,
+		Status:      ptr.String("completed"),
+		Progress:    ptr.Int64(100),
+		CompletedAt: ptr.Time(time.Now()),
+	})
+
+	return nil
+}
+
+func (s *Service) storeStream(ctx context.Context, jobID int64, params PushStreamParams) error {
+	if !s.chunked {
+		return s.storeStreamWhole(ctx, jobID, params)
+	}
+
+	sizeReader := ioutil.NewSizeReader(params.Content)
+	hasher := blake3.New()
+	chunks, err := s.uploadChunks(ctx, jobID, io.TeeReader(sizeReader, hasher), params.Size)
+	if err != nil {
+		return fmt.Errorf("upload stream: %w", err)
+	}
+
+	// The chunks uploaded are only kept if they end up in the new manifest
+	hash := hasher.Sum()
+	if params.Hash != "" && hash != params.Hash {
+		s.tombstoneChunks(context.WithoutCancel(ctx), chunks)
+		return model.NewError("push.hash_mismatch", "Template hash mismatch: expected %s, got %s").Fmt(params.Hash, hash)
+	}
+
+	versionParams := createVersionParams{
+		TemplateID: params.TemplateID,
+		Version:    params.Version,
+		ObjectKey:  getBlobKey(hash),
+		Hash:       hash,
+		Size:       sizeReader.Size,
+		Chunks:     chunks,
+	}
+
+	blob, err := s.storage.GetBlobByHash(ctx, ptr.String(hash))
+	switch {
+	case err == nil:
+		// Stored whole, as a resumable upload is
+		s.tombstoneChunks(context.WithoutCancel(ctx), chunks)
+		versionParams.ObjectKey = blob.ObjectKey
+		versionParams.Chunks = nil
+	case !errors.Is(err, sql.ErrNoRows):
+		s.tombstoneChunks(context.WithoutCancel(ctx), chunks)
+		return fmt.Errorf("get blob: %w", err)
+	}
+
+	// The stream can't be read again to retry like Push does, the client has to
+	err = s.createVersion(ctx, versionParams)
+	if err != nil {
+		s.tombstoneChunks(context.WithoutCancel(ctx), versionParams.Chunks)
+	}
+	if errors.Is(err, errContentDeleted) {
+		return model.NewError("push.content_deleted", "Content was deleted while pushing, push again")
+	}
+	return err
+}
+
+// storeStreamWhole uploads a stream as a single object, in parallel parts, and
+// creates the version. Like an assembled upload, the object is kept under its
+// upload key as a new blob, unless the file was pushed before.
+func (s *Service) storeStreamWhole(ctx context.Context, jobID int64, params PushStreamParams) error {
+	key := getUploadKey(uuid.New())
+	sizeReader := ioutil.NewSizeReader(params.Content)
+	hasher := blake3.New()
+	progressReader := progressr.NewReader(io.TeeReader(sizeReader, hasher), params.Size)
+	stop := s.monitorProgress(ctx, jobID, progressReader)
+	err := objectstore.UploadStream(ctx, s.uncompressedStore, key, progressReader, s.parallel)
+	stop()
+	if err != nil {
+		return fmt.Errorf("upload stream: %w", err)
+	}
+
+	// Nothing references the object until the version is created
+	ctx = context.WithoutCancel(ctx)
+	hash := hasher.Sum()
+	if params.Hash != "" && hash != params.Hash {
+		s.deleteObject(ctx, key)
+		return model.NewError("push.hash_mismatch", "Template hash mismatch: expected %s, got %s").Fmt(params.Hash, hash)
+	}
+	info, err := s.uncompressedStore.Stat(ctx, key)
+	if err != nil {
+		s.deleteObject(ctx, key)
+		return fmt.Errorf("stat stream: %w", err)
+	}
+
+	versionParams := createVersionParams{
+		TemplateID: params.TemplateID,
+		Version:    params.Version,
+		ObjectKey:  key,
+		Hash:       hash,
+		Size:       sizeReader.Size,
+		Whole:      true,
+		StoredSize: info.Size,
+	}
+	blob, err := s.storage.GetBlobByHash(ctx, ptr.String(hash))
+	switch {
+	case err == nil:
+		versionParams.ObjectKey = blob.ObjectKey
+		versionParams.Whole = false
+	case !errors.Is(err, sql.ErrNoRows):
+		s.deleteObject(ctx, key)
+		return fmt.Errorf("get blob: %w", err)
+	}
+
+	err = s.createVersion(ctx, versionParams)
+	if err != nil || !versionParams.Whole {
+		s.deleteObject(ctx, key)
+	}
+	if errors.Is(err, errContentDeleted) {
+		return model.NewError("push.content_deleted", "Content was deleted while pushing, push again")
+	}
+	return err
+}
+
+// ensureTemplate creates the template on its first push.
+func (s *Service) ensureTemplate(ctx context.Context, templateID uuid.UUID) error {
 	// Check if the template exists, if not create it
-	if _, err := s.storage.GetTemplate(ctx, params.TemplateID.String()); err != nil {
+	if _, err := s.storage.GetTemplate(ctx, templateID.String()); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			if _, err := s.storage.CreateTemplate(ctx, db.CreateTemplateParams{
-				ID:   params.TemplateID.String(),
-				Name: params.TemplateID.String(),
-				// Description: sql.NullString{String: params.TemplateID.String(), Valid: true},
+				ID:   templateID.String(),
+				Name: templateID.String(),
+				// Description: sql.NullString{String: templateID.String(), Valid: true},
 			}); err != nil {
 				return fmt.Errorf("create template: %w", err)
 			}
@@ -54,41 +272,258 @@ func (s *Service) Push(ctx context.Context, params PushParams) error {
 			return fmt.Errorf("get template: %w", err)
 		}
 	}
+	return nil
+}
 
-	// Check if the template version already exists
+// checkVersionFree fails with template_version.already_exists if the version was pushed already.
+func (s *Service) checkVersionFree(ctx context.Context, templateID uuid.UUID, version int64) error {
 	if _, err := s.storage.GetTemplateVersion(ctx, db.GetTemplateVersionParams{
-		TemplateID:    params.TemplateID.String(),
-		VersionNumber: params.Version,
+		TemplateID:    templateID.String(),
+		VersionNumber: version,
 	}); err != nil {
 		// Only return an error if the error is not a no rows error
 		if !errors.Is(err, sql.ErrNoRows) {
 			return fmt.Errorf("get template version: %w", err)
 		}
-	} else {
-		return model.NewError("template_version.already_exists", "Template %s version %d already exists").Fmt(params.TemplateID.String(), params.Version)
+		return nil
 	}
+	return model.NewError("template_version.already_exists", "Template %s version %d already exists").Fmt(templateID.String(), version)
+}
 
-	fmt.Printf("Pushing template: %s\n", params.TemplateID.String())
-	key := getKey(params.TemplateID, params.Version)
+// errContentDeleted means content we meant to reuse lost its last reference
+// to a concurrent DeleteVersion before we could take one, so its objects are
+// tombstoned and may be gone. It is also returned when the garbage collector
+// claimed an object we uploaded before we could reference it.
+var errContentDeleted = errors.New("content deleted concurrently")
 
-	src, err := params.File.Open()
+// maxStoreAttempts bounds the retries on errContentDeleted.
+const maxStoreAttempts = 3
+
+// storeVersion makes sure the content is stored and creates the version. If
+// the same file was pushed before it is reused as is, otherwise it is split
+// into chunks and only the chunks not stored yet are uploaded, or it is
+// uploaded whole when chunking is disabled.
+func (s *Service) storeVersion(ctx context.Context, jobID int64, params PushParams, src multipart.File, hash string) error {
+	versionParams := createVersionParams{
+		TemplateID: params.TemplateID,
+		Version:    params.Version,
+		ObjectKey:  getBlobKey(hash),
+		Hash:       hash,
+		Size:       params.File.Size,
+	}
+
+	blob, err := s.storage.GetBlobByHash(ctx, ptr.String(hash))
+	switch {
+	case err == nil:
+		versionParams.ObjectKey = blob.ObjectKey
+		slog.Debug("blob already stored, skipping upload", "key", blob.ObjectKey)
+	case errors.Is(err, sql.ErrNoRows) && !s.chunked:
+		storedSize, err := s.uploadWhole(ctx, jobID, versionParams.ObjectKey, src, params.File.Size)
+		if err != nil {
+			return fmt.Errorf("upload file: %w", err)
+		}
+		versionParams.Whole = true
+		versionParams.StoredSize = storedSize
+	case errors.Is(err, sql.ErrNoRows):
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("rewind file: %w", err)
+		}
+		chunks, err := s.uploadChunks(ctx, jobID, src, params.File.Size)
+		if err != nil {
+			return fmt.Errorf("upload file: %w", err)
+		}
+		versionParams.Chunks = chunks
+	default:
+		return fmt.Errorf("get blob: %w", err)
+	}
+
+	if err := s.createVersion(ctx, versionParams); err != nil {
+		s.tombstoneChunks(context.WithoutCancel(ctx), versionParams.Chunks)
+		if versionParams.Whole {
+			s.tombstoneObject(context.WithoutCancel(ctx), versionParams.ObjectKey)
+		}
+		return err
+	}
+	return nil
+}
+
+// uploadWhole uploads a spooled file as a single object, in parallel parts
+// when it is larger than one, and returns its stored size. It is stored
+// uncompressed, compressed parts could end up under the minimum part size of
+// S3.
+func (s *Service) uploadWhole(ctx context.Context, jobID int64, key string, src io.ReaderAt, size int64) (int64, error) {
+	// The blob may be tombstoned by a DeleteVersion
+	if err := s.reviveObject(ctx, key); err != nil {
+		return 0, fmt.Errorf("revive blob: %w", err)
+	}
+
+	progressReader := progressr.NewReaderAt(src, size)
+	stop := s.monitorProgress(ctx, jobID, progressReader)
+	defer stop()
+
+	if err := objectstore.UploadParallel(ctx, s.uncompressedStore, key, progressReader, size, s.parallel); err != nil {
+		return 0, err
+	}
+	info, err := s.uncompressedStore.Stat(ctx, key)
 	if err != nil {
-		s.storage.UpdateJob(ctx, db.UpdateJobParams{
-			ID:           job.ID,
-			Status:       ptr.String("error"),
-			ErrorMessage: ptr.String(err.Error()),
-			CompletedAt:  ptr.Time(time.Now()),
-		})
-		return fmt.Errorf("open file: %w", err)
+		return 0, fmt.Errorf("stat blob: %w", err)
 	}
-	defer src.Close()
+	return info.Size, nil
+}
 
-	// Compute hash while uploading using TeeReader
-	hasher := blake3.New()
-	hashReader := io.TeeReader(src, hasher)
-	progressReader := progressr.NewReader(hashReader, params.File.Size)
+// chunkRef is one chunk of a pushed file.
+type chunkRef struct {
+	Hash   string
+	Key    string
+	Offset int64
+	Size   int64
+	// StoredSize is the size in the object store, smaller than Size when compressed
+	StoredSize int64
+	// Uploaded reports whether this push uploaded the chunk or found it already stored
+	Uploaded bool
+}
 
-	// Monitor progress
+// uploadChunks splits src into content-defined chunks and uploads the ones
+// that aren't stored yet, reporting progress on the job against size (-1 if
+// unknown). It returns the manifest of the file. On error the chunks it
+// uploaded are tombstoned.
+func (s *Service) uploadChunks(ctx context.Context, jobID int64, src io.Reader, size int64) (_ []chunkRef, err error) {
+	progressReader := progressr.NewReader(src, size)
+	stop := s.monitorProgress(ctx, jobID, progressReader)
+	defer stop()
+
+	chunker, err := fastcdc.NewChunker(progressReader, s.chunking)
+	if err != nil {
+		return nil, fmt.Errorf("create chunker: %w", err)
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(s.chunkConcurrency)
+
+	// Not nil even for an empty file, a nil manifest means reusing a stored blob
+	chunks := []chunkRef{}
+	defer func() {
+		// Every error path waits for the uploads first
+		if err != nil {
+			s.tombstoneChunks(context.WithoutCancel(ctx), chunks)
+		}
+	}()
+
+	var offset int64
+	var mu sync.Mutex
+	storedSizes := make(map[string]int64)
+	for gctx.Err() == nil {
+		data, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			g.Wait()
+			return nil, fmt.Errorf("read chunk: %w", err)
+		}
+
+		hash, err := blake3.Compute(bytes.NewReader(data))
+		if err != nil {
+			g.Wait()
+			return nil, fmt.Errorf("hash chunk: %w", err)
+		}
+
+		chunk := chunkRef{
+			Hash:   hash,
+			Key:    getChunkKey(hash),
+			Offset: offset,
+			Size:   int64(len(data)),
+		}
+		offset += chunk.Size
+
+		// Disk images repeat chunks (zeroed regions), upload each once
+		mu.Lock()
+		_, seen := storedSizes[hash]
+		if !seen {
+			storedSizes[hash] = chunk.Size
+		}
+		mu.Unlock()
+
+		if !seen {
+			stored, err := s.storage.GetChunk(ctx, hash)
+			if errors.Is(err, sql.ErrNoRows) {
+				chunk.Uploaded = true
+				// data is reused by the chunker, copy it for the upload
+				content := bytes.Clone(data)
+				g.Go(func() error {
+					// The chunk may be tombstoned by a DeleteVersion
+					if err := s.reviveObject(gctx, chunk.Key); err != nil {
+						return fmt.Errorf("revive chunk %s: %w", chunk.Hash, err)
+					}
+					if err := s.uploadChunk(gctx, chunk.Key, content); err != nil {
+						return fmt.Errorf("upload chunk %s: %w", chunk.Hash, err)
+					}
+					// The store decides how many bytes it keeps (compression)
+					info, err := s.objectStore.Stat(gctx, chunk.Key)
+					if err != nil {
+						return fmt.Errorf("stat chunk %s: %w", chunk.Hash, err)
+					}
+					mu.Lock()
+					storedSizes[chunk.Hash] = info.Size
+					mu.Unlock()
+					return nil
+				})
+			} else if err != nil {
+				g.Wait()
+				return nil, fmt.Errorf("get chunk: %w", err)
+			} else if stored.StoredSize != nil {
+				mu.Lock()
+				storedSizes[hash] = *stored.StoredSize
+				mu.Unlock()
+			}
+		}
+
+		chunks = append(chunks, chunk)
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range chunks {
+		chunks[i].StoredSize = storedSizes[chunks[i].Hash]
+	}
+
+	return chunks, nil
+}
+
+// uploadChunk uploads a chunk, retrying failed attempts. The primary only
+// retries content it can rewind, and the cache, compression and encryption
+// above it hand it a stream, so the chunk is sent again from memory here.
+func (s *Service) uploadChunk(ctx context.Context, key string, content []byte) error {
+	for attempt := 0; ; attempt++ {
+		err := s.objectStore.Upload(ctx, key, bytes.NewReader(content))
+		if err == nil || attempt == s.chunkRetries || errors.Is(err, model.ErrStoreUnavailable) || ctx.Err() != nil {
+			return err
+		}
+		slog.Debug("retrying chunk upload", "key", key, "attempt", attempt+1, "error", err)
+
+		timer := time.NewTimer(min(s.chunkRetryDelay<<min(attempt, 20), s.chunkMaxRetryDelay))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// progressReporter is a progressr reader.
+type progressReporter interface {
+	Progress() float64
+}
+
+// monitorProgress reports the reader progress on the job every second until stop is called.
+func (s *Service) monitorProgress(ctx context.Context, jobID int64, progressReader progressReporter) (stop func()) {
+	done := make(chan struct{})
 	go func() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
@@ -96,10 +531,12 @@ func (s *Service) Push(ctx context.Context, params PushParams) error {
 			select {
 			case <-ctx.Done():
 				return
+			case <-done:
+				return
 			case <-ticker.C:
 				progress := progressReader.Progress()
 				s.storage.UpdateJob(ctx, db.UpdateJobParams{
-					ID:       job.ID,
+					ID:       jobID,
 					Status:   ptr.String("uploading"),
 					Progress: ptr.Int64(int64(progress * 100)),
 				})
@@ -110,43 +547,149 @@ func (s *Service) Push(ctx context.Context, params PushParams) error {
 		}
 	}()
 
-	// Upload file
-	if err := s.objectStore.Upload(ctx, key, progressReader); err != nil {
-		s.storage.UpdateJob(ctx, db.UpdateJobParams{
-			ID:           job.ID,
-			Status:       ptr.String("error"),
-			ErrorMessage: ptr.String(err.Error()),
-			CompletedAt:  ptr.Time(time.Now()),
-		})
-		return fmt.Errorf("upload file: %w", err)
-	}
-
-	// Create template version with computed hash
-	hashStr := hex.EncodeToString(hasher.Sum(nil))
-	fmt.Printf("Hash: %s\n", hashStr)
-	if _, err := s.storage.CreateTemplateVersion(ctx, db.CreateTemplateVersionParams{
+	return func() { close(done) }
+}
+
+type createVersionParams struct {
+	TemplateID uuid.UUID
+	Version    int64
+	ObjectKey  string
+	Hash       string
+	Size       int64
+	// Chunks is the manifest of a newly chunked file, nil when reusing a stored blob
+	Chunks []chunkRef
+	// Whole is set when ObjectKey was just uploaded as a single object, of
+	// StoredSize bytes in the object store, as storeUpload keeps an
+	// assembled upload. Compressed is whether it was uploaded compressing.
+	Whole      bool
+	StoredSize int64
+	Compressed bool
+}
+
+// createVersion takes a reference on the blob and creates the version row in
+// one transaction. A new blob also records its manifest and takes a reference
+// on each chunk.
+func (s *Service) createVersion(ctx context.Context, params createVersionParams) error {
+	tx, err := s.storage.BeginTx()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Only used when the blob is new, an existing blob keeps its stored size
+	storedSize := params.StoredSize
+	for _, chunk := range params.Chunks {
+		storedSize += chunk.StoredSize
+	}
+
+	blob, err := tx.AcquireBlob(ctx, db.AcquireBlobParams{
+		ObjectKey:  params.ObjectKey,
+		Hash:       ptr.String(params.Hash),
+		Size:       ptr.Int64(params.Size),
+		Chunked:    !params.Whole,
+		StoredSize: ptr.Int64(storedSize),
+		// Only a whole blob is an object, a chunked one is read through its chunks
+		Compressed: params.Whole && params.Compressed,
+	})
+	if err != nil {
+		return fmt.Errorf("acquire blob: %w", err)
+	}
+
+	// A reference count of 1 means the blob is new. Either we chunked or
+	// uploaded it, or we meant to reuse it and the last version using it was
+	// deleted in between, tombstoning the content for the garbage collector.
+	// The same goes for each chunk we didn't upload ourselves.
+	if blob.RefCount == 1 {
+		if params.Chunks == nil && !params.Whole {
+			return errContentDeleted
+		}
+		if params.Whole {
+			// As for chunks below, we revived the object before uploading it
+			claimed, err := s.tombstoneClaimed(ctx, tx, params.ObjectKey)
+			if err != nil {
+				return err
+			}
+			if claimed {
+				return errContentDeleted
+			}
+		}
+
+		for i, chunk := range params.Chunks {
+			stored, err := tx.AcquireChunk(ctx, db.AcquireChunkParams{
+				Hash:       chunk.Hash,
+				ObjectKey:  chunk.Key,
+				Size:       chunk.Size,
+				StoredSize: ptr.Int64(chunk.StoredSize),
+				Compressed: s.compress,
+			})
+			if err != nil {
+				return fmt.Errorf("acquire chunk: %w", err)
+			}
+			if stored.RefCount == 1 && !chunk.Uploaded {
+				return errContentDeleted
+			}
+			if stored.RefCount == 1 {
+				// We revived the chunk before uploading it, a tombstone claimed
+				// since means the garbage collector may have deleted our upload
+				claimed, err := s.tombstoneClaimed(ctx, tx, chunk.Key)
+				if err != nil {
+					return err
+				}
+				if claimed {
+					return errContentDeleted
+				}
+			}
+
+			if err := tx.CreateBlobChunk(ctx, db.CreateBlobChunkParams{
+				BlobKey:   blob.ObjectKey,
+				Seq:       int64(i),
+				ChunkHash: chunk.Hash,
+				Offset:    chunk.Offset,
+				Size:      chunk.Size,
+			}); err != nil {
+				return fmt.Errorf("create blob chunk: %w", err)
+			}
+		}
+	}
+
+	if _, err := tx.CreateTemplateVersion(ctx, db.CreateTemplateVersionParams{
 		ID:            uuid.New().String(),
 		TemplateID:    params.TemplateID.String(),
 		VersionNumber: params.Version,
-		ObjectKey:     key,
-		FileSize:      ptr.Int64(params.File.Size),
-		FileHash:      ptr.String(hashStr),
+		ObjectKey:     params.ObjectKey,
+		FileSize:      ptr.Int64(params.Size),
+		FileHash:      ptr.String(params.Hash),
+		StoredSize:    blob.StoredSize,
 	}); err != nil {
-		s.storage.UpdateJob(ctx, db.UpdateJobParams{
-			ID:           job.ID,
-			Status:       ptr.String("error"),
-			ErrorMessage: ptr.String(err.Error()),
-			CompletedAt:  ptr.Time(time.Now()),
-		})
 		return fmt.Errorf("create template version: %w", err)
 	}
 
-	// Mark job as completed
-	s.storage.UpdateJob(ctx, db.UpdateJobParams{
-		ID:          job.ID,
-		Status:      ptr.String("completed"),
-		CompletedAt: ptr.Time(time.Now()),
-	})
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
 
 	return nil
 }
+
+// tombstoneClaimed reports whether the garbage collector claimed the
+// tombstone of key, and may have deleted it.
+func (s *Service) tombstoneClaimed(ctx context.Context, tx *sqlc.TxStorage, key string) (bool, error) {
+	tombstone, err := tx.GetObjectTombstone(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get tombstone: %w", err)
+	}
+	return tombstone.ClaimedAt != nil, nil
+}
+
+// failJob marks a job as errored.
+func (s *Service) failJob(ctx context.Context, jobID int64, err error) {
+	s.storage.UpdateJob(ctx, db.UpdateJobParams{
+		ID:           jobID,
+		Status:       ptr.String("error"),
+		ErrorMessage: ptr.String(err.Error()),
+		CompletedAt:  ptr.Time(time.Now()),
+	})
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/db"
+)
+
+// urlBackend is a backend pulls can be redirected to.
+type urlBackend interface {
+	objectstore.Client
+	objectstore.URLSigner
+}
+
+// enableRedirects lets pulls be redirected to backend. Chunked versions are
+// reassembled here, so unless redirects are off by default, pushes are stored
+// whole instead.
+func (s *Service) enableRedirects(backend urlBackend) {
+	s.urlBackend = backend
+	if s.redirect != "never" {
+		s.chunked = false
+		slog.Info("redirecting pulls, pushes are stored whole instead of chunked", "redirect", s.redirect)
+	}
+}
+
+type PullURLParams struct {
+	TemplateID uuid.UUID `validate:"required,uuid"`
+	Version    int64     `validate:"required,min=1"`
+	// Redirect overrides objectstore.redirect for this pull when set
+	Redirect string `validate:"omitempty,oneof=never always uncached"`
+}
+
+// PullURLResult is where to redirect a pull to. Version is the version
+// looked up on the way, to pass on to Pull when the pull is proxied, and nil
+// when redirects are off.
+type PullURLResult struct {
+	URL     string
+	Version *db.TemplateVersion
+}
+
+// PullURL returns a URL on the primary to redirect a pull to, so the bytes
+// don't go through Templar, or an empty URL when the pull is proxied. Only
+// versions stored whole can be redirected: chunked ones, pushed while
+// redirects were off, are reassembled here. The primary must also sign URLs
+// and hold the file as pushed, uncompressed and without encryption. Failing
+// to sign falls back to proxying.
+func (s *Service) PullURL(ctx context.Context, params PullURLParams) (*PullURLResult, error) {
+	mode := params.Redirect
+	if mode == "" {
+		mode = s.redirect
+	}
+	if mode == "never" || s.urlBackend == nil {
+		return &PullURLResult{}, nil
+	}
+
+	version, err := s.getPullVersion(ctx, PullParams{TemplateID: params.TemplateID, Version: params.Version})
+	if err != nil {
+		return nil, err
+	}
+	proxied := &PullURLResult{Version: &version}
+
+	blob, err := s.storage.GetBlob(ctx, version.ObjectKey)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("get blob: %w", err)
+	}
+	if err == nil && (blob.Chunked || blob.Compressed) {
+		slog.Debug("version isn't stored whole, proxying pull", "key", version.ObjectKey, "chunked", blob.Chunked, "compressed", blob.Compressed)
+		return proxied, nil
+	}
+
+	key := version.ObjectKey
+	if mode == "uncached" && s.cache.Cached(ctx, key) {
+		return proxied, nil
+	}
+
+	// Write-back and write quorums can leave the primary without the object
+	if s.statRedirects {
+		if _, err := s.urlBackend.Stat(ctx, key); err != nil {
+			if !errors.Is(err, objectstore.ErrNotFound) {
+				slog.Warn("failed to stat object on primary, proxying pull", "key", key, "error", err)
+			}
+			return proxied, nil
+		}
+	}
+
+	url, err := s.urlBackend.GetURL(ctx, key, s.presignedTTL)
+	if err != nil {
+		slog.Warn("failed to sign object url, proxying pull", "key", key, "error", err)
+		return proxied, nil
+	}
+	return &PullURLResult{URL: url, Version: &version}, nil
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// repairLoop re-replicates stored objects every interval.
+func (s *Service) repairLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.repairReplicas(context.Background())
+	}
+}
+
+// repairReplicas copies every object the database references to the replicas
+// missing it, such as after a write that only reached the quorum.
+func (s *Service) repairReplicas(ctx context.Context) {
+	keys, err := s.storage.ListObjectKeys(ctx)
+	if err != nil {
+		slog.Error("failed to list objects for repair", "error", err)
+		return
+	}
+
+	repaired, failed := 0, 0
+	for _, key := range keys {
+		n, err := s.replicas.RepairObject(ctx, key)
+		if err != nil {
+			slog.Warn("failed to repair object", "key", key, "error", err)
+			failed++
+			continue
+		}
+		repaired += n
+	}
+
+	slog.Info("replica repair finished", "objects", len(keys), "repaired", repaired, "failed", failed)
+}
@@ -3,21 +3,71 @@ package service
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/beanbocchi/templar/config"
 	"github.com/beanbocchi/templar/internal/client/objectstore"
 	"github.com/beanbocchi/templar/internal/client/objectstore/cache"
+	"github.com/beanbocchi/templar/internal/client/objectstore/compress"
+	"github.com/beanbocchi/templar/internal/client/objectstore/encrypt"
 	"github.com/beanbocchi/templar/internal/client/objectstore/local"
+	"github.com/beanbocchi/templar/internal/client/objectstore/memory"
+	"github.com/beanbocchi/templar/internal/client/objectstore/replica"
+	"github.com/beanbocchi/templar/internal/client/objectstore/resilient"
+	"github.com/beanbocchi/templar/internal/client/objectstore/s3"
 	"github.com/beanbocchi/templar/internal/client/objectstore/stoj"
+	"github.com/beanbocchi/templar/internal/utils/fastcdc"
 	"github.com/beanbocchi/templar/pkg/sqlc"
 )
 
 type Service struct {
+	// objectStore is where content is written, compressing when enabled
 	objectStore objectstore.Client
-	storage     *sqlc.Storage
+	// compress is whether objectStore compresses. Blobs and chunks record it,
+	// and are read through compressedStore or uncompressedStore accordingly.
+	compress          bool
+	compressedStore   objectstore.Client
+	uncompressedStore objectstore.Client
+	storage           *sqlc.Storage
+	// cache is the cache tier below compression and encryption, for pinning
+	cache *cache.CacheClient
+	// replicas is set when replication is configured, for repair
+	replicas *replica.ReplicaClient
+	// multipartStores are the backends whose multipart sessions can be
+	// listed and expired
+	multipartStores []multipartStore
+
+	// chunked is whether pushes are chunked, or stored whole in parallel parts
+	chunked          bool
+	chunking         fastcdc.Options
+	chunkConcurrency int
+	// chunkRetries failed chunk uploads are retried, which the primary can't
+	// retry itself, backing off from chunkRetryDelay up to chunkMaxRetryDelay
+	chunkRetries       int
+	chunkRetryDelay    time.Duration
+	chunkMaxRetryDelay time.Duration
+	// prefetch is how many chunks a pull opens ahead
+	prefetch int
+	// parallel splits versions stored whole into parts uploaded in parallel
+	parallel objectstore.ParallelOptions
+
+	// download links are signed with presignedSecret and issued under downloadURL
+	presignedSecret []byte
+	presignedTTL    time.Duration
+	downloadURL     string
+
+	// urlBackend is the primary when pulls can be redirected to it, and
+	// redirect is when they are by default
+	urlBackend urlBackend
+	redirect   string
+	// statRedirects is set when the primary can lag behind acknowledged
+	// writes, so redirects check it has the object first
+	statRedirects bool
 
 	jobs chan func()
 }
@@ -25,35 +75,76 @@ type Service struct {
 func NewService(config *config.Config, sqliteDB *sql.DB) (*Service, error) {
 	storage := sqlc.NewStorage(sqliteDB)
 
-	localStore, err := local.NewClient(local.LocalConfig{
-		Root:    config.Objectstore.Local.Root,
-		BaseURL: config.Objectstore.Local.BaseURL,
-	})
+	cacheTier, err := newCacheTier(config)
 	if err != nil {
-		return nil, fmt.Errorf("create local store: %w", err)
+		return nil, fmt.Errorf("create cache tier: %w", err)
 	}
 
-	storjStore, err := stoj.NewClient(context.Background(), stoj.StorjConfig{
-		Bucket:      config.Objectstore.Storj.Bucket,
-		AccessGrant: config.Objectstore.Storj.AccessGrant,
-		BaseURL:     config.Objectstore.Storj.BaseURL,
-	})
+	durableStore, replicas, backends, err := newDurableStore(context.Background(), config)
 	if err != nil {
-		return nil, fmt.Errorf("create storj store: %w", err)
+		return nil, err
 	}
 
-	// Create LRU eviction policy with max size from config (convert MB to bytes)
-	maxSizeBytes := config.Objectstore.Cache.MaxSize * 1024 * 1024
+	// Pins must be known before the cache index is restored
+	pinned, err := storage.ListPinnedObjectKeys(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("list pinned objects: %w", err)
+	}
+
+	writeBack, err := newWriteBack(config, storage)
+	if err != nil {
+		return nil, err
+	}
 
 	cacheStore, err := cache.NewCacheClient(cache.CacheConfig{
-		Cache:          localStore,
-		Primary:        storjStore,
-		EvictionPolicy: cache.NewLRUEvictionPolicy(maxSizeBytes),
+		Cache:          cacheTier,
+		Primary:        durableStore,
+		EvictionPolicy: newEvictionPolicy(config),
+		Index:          &cacheIndex{storage: storage},
+		Pinned:         pinned,
+		Digests:        &objectDigests{storage: storage},
+		SpoolDir:       config.Objectstore.Cache.SpoolDir,
+		TouchInterval:  time.Duration(config.Objectstore.Cache.TouchInterval) * time.Second,
+		WriteBack:      writeBack,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("create cache store: %w", err)
 	}
 
+	// Encrypt above the cache so neither tier holds plaintext
+	var uncompressedStore objectstore.Client = cacheStore
+	if config.Objectstore.Encryption.Enabled {
+		uncompressedStore, err = newEncryptStore(config, uncompressedStore)
+		if err != nil {
+			return nil, fmt.Errorf("create encrypt store: %w", err)
+		}
+	}
+
+	// Compress above the cache so both tiers hold compressed bytes, and the
+	// cache budget is spent on stored size. Compression must come before
+	// encryption, ciphertext doesn't compress. The compressing store is kept
+	// when compression is disabled, to read what was compressed before.
+	compressedStore, err := compress.NewCompressClient(compress.CompressConfig{
+		Client: uncompressedStore,
+		Level:  max(config.Objectstore.Compression.Level, 1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create compress store: %w", err)
+	}
+	objectStore := uncompressedStore
+	if config.Objectstore.Compression.Enabled {
+		objectStore = compressedStore
+	}
+
+	chunking := fastcdc.Options{
+		MinSize: int(config.Objectstore.Chunking.MinSize * 1024),
+		AvgSize: int(config.Objectstore.Chunking.AvgSize * 1024),
+		MaxSize: int(config.Objectstore.Chunking.MaxSize * 1024),
+	}
+	if err := chunking.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid chunking config: %w", err)
+	}
+
 	// Create a job queue
 	jobs := make(chan func(), config.App.JobBuffer)
 	go func() {
@@ -62,13 +153,283 @@ func NewService(config *config.Config, sqliteDB *sql.DB) (*Service, error) {
 		}
 	}()
 
-	return &Service{
-		objectStore: cacheStore,
-		storage:     storage,
-		jobs:        jobs,
+	s := &Service{
+		objectStore:       objectStore,
+		compress:          config.Objectstore.Compression.Enabled,
+		compressedStore:   compressedStore,
+		uncompressedStore: uncompressedStore,
+		storage:           storage,
+		cache:             cacheStore,
+		replicas:          replicas,
+		jobs:              jobs,
+
+		chunked:            config.Objectstore.Chunking.Enabled,
+		chunking:           chunking,
+		chunkConcurrency:   config.Objectstore.Chunking.Concurrency,
+		chunkRetries:       config.Objectstore.Resilience.MaxRetries,
+		chunkRetryDelay:    time.Duration(config.Objectstore.Resilience.BaseDelay) * time.Millisecond,
+		chunkMaxRetryDelay: time.Duration(config.Objectstore.Resilience.MaxDelay) * time.Millisecond,
+		prefetch:           config.Objectstore.Chunking.Prefetch,
+		parallel: objectstore.ParallelOptions{
+			PartSize:    config.Objectstore.Multipart.PartSize * 1024 * 1024,
+			Concurrency: config.Objectstore.Multipart.Concurrency,
+		},
+
+		presignedSecret: []byte(config.Objectstore.PresignedSecret),
+		presignedTTL:    time.Duration(config.Objectstore.PresignedDefaultTTL) * time.Second,
+		downloadURL:     strings.TrimRight(config.Objectstore.DownloadBaseURL, "/"),
+
+		redirect:      config.Objectstore.Redirect,
+		statRedirects: primaryLags(config),
+
+		multipartStores: multipartStores(config, backends, cacheTier),
+	}
+
+	// Clients can only use objects that hold the file as pushed, PullURL
+	// checks each blob was stored uncompressed
+	if !config.Objectstore.Encryption.Enabled {
+		if backend, ok := backends[0].(urlBackend); ok {
+			s.enableRedirects(backend)
+		}
+	}
+
+	if replicas != nil && config.Objectstore.Replication.RepairInterval > 0 {
+		go s.repairLoop(time.Duration(config.Objectstore.Replication.RepairInterval) * time.Second)
+	}
+
+	if config.Objectstore.Multipart.JanitorInterval > 0 {
+		go s.multipartJanitor(
+			time.Duration(config.Objectstore.Multipart.JanitorInterval)*time.Second,
+			time.Duration(config.Objectstore.Multipart.Expiry)*time.Second,
+		)
+	}
+
+	if config.Objectstore.GC.Interval > 0 {
+		go s.gcLoop(
+			time.Duration(config.Objectstore.GC.Interval)*time.Second,
+			time.Duration(config.Objectstore.GC.Grace)*time.Second,
+		)
+	}
+
+	return s, nil
+}
+
+// newDurableStore creates the primary, plus the configured replicas behind a
+// replica client. Each backend gets its own retries and breaker, so one being
+// down doesn't fail the others. replicas is nil without replication, and
+// backends are the unwrapped backends, primary first, for maintenance.
+func newDurableStore(ctx context.Context, config *config.Config) (objectstore.Client, *replica.ReplicaClient, []objectstore.Client, error) {
+	primaryStore, err := newBackend(ctx, config.Objectstore.Primary, config.Objectstore.Storj, config.Objectstore.S3, config.Objectstore.Memory)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("create primary store: %w", err)
+	}
+	backends := []objectstore.Client{primaryStore}
+
+	// Retry transient primary failures, and fail fast while it is down instead
+	// of hanging every cache miss
+	resilientStore, err := newResilientStore(config, primaryStore)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("create resilient store: %w", err)
+	}
+
+	if len(config.Objectstore.Replication.Replicas) == 0 {
+		return resilientStore, nil, backends, nil
+	}
+
+	replicas := []replica.Replica{{Name: "primary", Client: resilientStore}}
+	for _, r := range config.Objectstore.Replication.Replicas {
+		store, err := newBackend(ctx, r.Backend, r.Storj, r.S3, r.Memory)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("create replica %s: %w", r.Name, err)
+		}
+		backends = append(backends, store)
+		store, err = newResilientStore(config, store)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("create resilient replica %s: %w", r.Name, err)
+		}
+		replicas = append(replicas, replica.Replica{Name: r.Name, Client: store})
+	}
+
+	replicaStore, err := replica.NewReplicaClient(replica.ReplicaConfig{
+		Replicas:    replicas,
+		WriteQuorum: config.Objectstore.Replication.WriteQuorum,
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("create replica store: %w", err)
+	}
+	return replicaStore, replicaStore, backends, nil
+}
+
+// primaryLags reports whether an acknowledged write can be missing from the
+// primary: write-back uploads it later, and a write quorum below every
+// replica can succeed without it.
+func primaryLags(config *config.Config) bool {
+	replicas := len(config.Objectstore.Replication.Replicas)
+	quorum := config.Objectstore.Replication.WriteQuorum
+	return config.Objectstore.Cache.WriteBack.Enabled || (replicas > 0 && quorum > 0 && quorum <= replicas)
+}
+
+func newResilientStore(config *config.Config, client objectstore.Client) (objectstore.Client, error) {
+	return resilient.NewResilientClient(resilient.ResilientConfig{
+		Client:           client,
+		MaxRetries:       config.Objectstore.Resilience.MaxRetries,
+		BaseDelay:        time.Duration(config.Objectstore.Resilience.BaseDelay) * time.Millisecond,
+		MaxDelay:         time.Duration(config.Objectstore.Resilience.MaxDelay) * time.Millisecond,
+		Timeout:          time.Duration(config.Objectstore.Resilience.Timeout) * time.Second,
+		UploadTimeout:    time.Duration(config.Objectstore.Resilience.UploadTimeout) * time.Second,
+		FailureThreshold: config.Objectstore.Resilience.FailureThreshold,
+		Cooldown:         time.Duration(config.Objectstore.Resilience.Cooldown) * time.Second,
+	})
+}
+
+// newBackend creates a durable backend of the given kind, used for the primary and replicas.
+func newBackend(
+	ctx context.Context,
+	backend string,
+	storjConfig config.StorjObjectstore,
+	s3Config config.S3Objectstore,
+	memoryConfig config.MemoryObjectstore,
+) (objectstore.Client, error) {
+	switch backend {
+	case "memory":
+		return newMemoryStore(memoryConfig)
+	case "s3":
+		s3Store, err := s3.NewClient(ctx, s3.S3Config{
+			Endpoint:        s3Config.Endpoint,
+			Region:          s3Config.Region,
+			Bucket:          s3Config.Bucket,
+			AccessKeyID:     s3Config.AccessKeyID,
+			SecretAccessKey: s3Config.SecretAccessKey,
+			UsePathStyle:    s3Config.UsePathStyle,
+			PartSize:        s3Config.PartSize * 1024 * 1024,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create s3 store: %w", err)
+		}
+		return s3Store, nil
+	default:
+		storjStore, err := stoj.NewClient(ctx, stoj.StorjConfig{
+			Bucket:      storjConfig.Bucket,
+			AccessGrant: storjConfig.AccessGrant,
+			BaseURL:     storjConfig.BaseURL,
+			AuthService: storjConfig.AuthService,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create storj store: %w", err)
+		}
+		return storjStore, nil
+	}
+}
+
+// newCacheTier creates the fast backend selected by objectstore.cache.backend.
+func newCacheTier(config *config.Config) (objectstore.Client, error) {
+	switch config.Objectstore.Cache.Backend {
+	case "memory":
+		return newMemoryStore(config.Objectstore.Memory)
+	default:
+		localStore, err := local.NewClient(local.LocalConfig{
+			Root:    config.Objectstore.Local.Root,
+			BaseURL: config.Objectstore.Local.BaseURL,
+			// Write-back acknowledges uploads once they are in the cache
+			Fsync: config.Objectstore.Cache.WriteBack.Enabled,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create local store: %w", err)
+		}
+		return localStore, nil
+	}
+}
+
+// newEvictionPolicy creates the cache policy selected by objectstore.cache.policy.
+func newEvictionPolicy(config *config.Config) cache.EvictionPolicy {
+	// Max size from config (convert MB to bytes)
+	maxSizeBytes := config.Objectstore.Cache.MaxSize * 1024 * 1024
+
+	switch config.Objectstore.Cache.Policy {
+	case "lfu":
+		return cache.NewLFUEvictionPolicy(maxSizeBytes)
+	case "arc":
+		return cache.NewARCEvictionPolicy(maxSizeBytes)
+	case "wtinylfu":
+		return cache.NewTinyLFUEvictionPolicy(maxSizeBytes)
+	case "gdsf":
+		return cache.NewGDSFEvictionPolicy(maxSizeBytes)
+	default:
+		return cache.NewLRUEvictionPolicy(maxSizeBytes)
+	}
+}
+
+// newWriteBack returns the cache write-back config, nil when it is off. Only a
+// local cache keeps acknowledged uploads across restarts.
+func newWriteBack(config *config.Config, storage *sqlc.Storage) (*cache.WriteBackConfig, error) {
+	writeBack := config.Objectstore.Cache.WriteBack
+	if !writeBack.Enabled {
+		return nil, nil
+	}
+	if config.Objectstore.Cache.Backend != "local" {
+		return nil, fmt.Errorf("cache write-back requires the local cache backend, got %s", config.Objectstore.Cache.Backend)
+	}
+
+	return &cache.WriteBackConfig{
+		Log:         &cacheWriteBackLog{storage: storage},
+		Concurrency: writeBack.Concurrency,
+		BaseDelay:   time.Duration(writeBack.BaseDelay) * time.Second,
+		MaxDelay:    time.Duration(writeBack.MaxDelay) * time.Second,
 	}, nil
 }
 
-func getKey(templateID uuid.UUID, version int64) string {
-	return fmt.Sprintf("templates/%s/%d", templateID.String(), version)
+func newMemoryStore(memoryConfig config.MemoryObjectstore) (objectstore.Client, error) {
+	memoryStore, err := memory.NewClient(memory.MemoryConfig{
+		MaxObjectSize: memoryConfig.MaxObjectSize * 1024 * 1024,
+		MaxTotalSize:  memoryConfig.MaxTotalSize * 1024 * 1024,
+		Latency:       time.Duration(memoryConfig.Latency) * time.Millisecond,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create memory store: %w", err)
+	}
+	return memoryStore, nil
+}
+
+func newEncryptStore(config *config.Config, client objectstore.Client) (objectstore.Client, error) {
+	cipher, err := encrypt.ParseCipher(config.Objectstore.Encryption.Cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string][]byte, len(config.Objectstore.Encryption.Keys))
+	for _, k := range config.Objectstore.Encryption.Keys {
+		key, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("decode key %s: %w", k.ID, err)
+		}
+		keys[k.ID] = key
+	}
+
+	keyring, err := encrypt.NewKeyring(config.Objectstore.Encryption.CurrentKey, keys)
+	if err != nil {
+		return nil, fmt.Errorf("create keyring: %w", err)
+	}
+
+	return encrypt.NewEncryptClient(encrypt.EncryptConfig{
+		Client:         client,
+		Keyring:        keyring,
+		Cipher:         cipher,
+		AllowPlaintext: config.Objectstore.Encryption.AllowPlaintext,
+	})
+}
+
+// getBlobKey returns the content-addressed object key for a BLAKE3 hex digest.
+func getBlobKey(hash string) string {
+	return fmt.Sprintf("blobs/%s", hash)
+}
+
+// getChunkKey returns the object key of a chunk from its BLAKE3 hex digest.
+func getChunkKey(hash string) string {
+	return fmt.Sprintf("chunks/%s", hash)
+}
+
+// getUploadKey returns the object key a resumable push is assembled under, or
+// a streamed push stored whole is uploaded to.
+func getUploadKey(id uuid.UUID) string {
+	return fmt.Sprintf("uploads/%s", id.String())
 }
@@ -0,0 +1,549 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+
+	"github.com/beanbocchi/templar/config"
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/client/objectstore/cache"
+	"github.com/beanbocchi/templar/internal/db"
+	"github.com/beanbocchi/templar/internal/model"
+	"github.com/beanbocchi/templar/internal/utils/blake3"
+)
+
+// newTestConfig returns a config with memory primary and cache tiers, and
+// chunks small enough for test files to span several.
+func newTestConfig() *config.Config {
+	return &config.Config{
+		App: config.App{JobBuffer: 10},
+		Objectstore: config.Objectstore{
+			PresignedDefaultTTL: 60,
+			PresignedSecret:     "secret",
+			DownloadBaseURL:     "http://templar.test/api/v1/shared/files",
+			Redirect:            "never",
+			Primary:             "memory",
+			Resilience: config.Resilience{
+				MaxRetries:       2,
+				BaseDelay:        1,
+				MaxDelay:         5,
+				FailureThreshold: 5,
+				Cooldown:         1,
+			},
+			Multipart: config.Multipart{Expiry: 3600},
+			Chunking: config.Chunking{
+				Enabled:     true,
+				MinSize:     1,
+				AvgSize:     4,
+				MaxSize:     16,
+				Concurrency: 4,
+				Prefetch:    1,
+			},
+			Cache: config.CacheObjectstore{
+				Backend: "memory",
+				MaxSize: 1,
+				Policy:  "lru",
+			},
+		},
+	}
+}
+
+// newTestService creates a service over memory backends and a migrated
+// SQLite database in a temporary directory.
+func newTestService(t *testing.T, cfg *config.Config) *Service {
+	t.Helper()
+	sqliteDB, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "templar.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { sqliteDB.Close() })
+
+	driver, err := sqlite.WithInstance(sqliteDB, &sqlite.Config{MigrationsTable: "schema_migrations", DatabaseName: "templar"})
+	if err != nil {
+		t.Fatalf("create migrate driver: %v", err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://../../migrations", "sqlite", driver)
+	if err != nil {
+		t.Fatalf("create migrate: %v", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	s, err := NewService(cfg, sqliteDB)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return s
+}
+
+func randomContent(n int, seed int64) []byte {
+	content := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(content)
+	return content
+}
+
+// fileHeader returns content as an uploaded form file, like Handler.Push gets.
+func fileHeader(t *testing.T, content []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "template")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(int64(len(content)) + 1024)
+	if err != nil {
+		t.Fatalf("ReadForm: %v", err)
+	}
+	return form.File["file"][0]
+}
+
+func push(t *testing.T, s *Service, templateID uuid.UUID, version int64, content []byte) {
+	t.Helper()
+	if err := s.Push(context.Background(), PushParams{TemplateID: templateID, Version: version, File: fileHeader(t, content)}); err != nil {
+		t.Fatalf("Push version %d: %v", version, err)
+	}
+}
+
+func pull(t *testing.T, s *Service, templateID uuid.UUID, version int64) []byte {
+	t.Helper()
+	result, err := s.Pull(context.Background(), PullParams{TemplateID: templateID, Version: version})
+	if err != nil {
+		t.Fatalf("Pull version %d: %v", version, err)
+	}
+	defer result.Content.Close()
+
+	content, err := io.ReadAll(result.Content)
+	if err != nil {
+		t.Fatalf("read version %d: %v", version, err)
+	}
+	if int64(len(content)) != result.Size {
+		t.Fatalf("read %d bytes of version %d, size is %d", len(content), version, result.Size)
+	}
+	return content
+}
+
+// versionJob returns the job that pushed version.
+func versionJob(t *testing.T, s *Service, version int64) db.Job {
+	t.Helper()
+	jobs, err := s.storage.ListJobs(context.Background(), db.ListJobsParams{Limit: 100})
+	if err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	for _, job := range jobs {
+		if job.VersionNumber != nil && *job.VersionNumber == version {
+			return job
+		}
+	}
+	t.Fatalf("no job pushed version %d", version)
+	return db.Job{}
+}
+
+// countObjects counts the objects under prefix in the object store.
+func countObjects(t *testing.T, s *Service, prefix string) int {
+	t.Helper()
+	n := 0
+	it := s.objectStore.List(context.Background(), prefix)
+	for it.Next() {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return n
+}
+
+func TestPushPull(t *testing.T) {
+	s := newTestService(t, newTestConfig())
+	templateID := uuid.New()
+	content := randomContent(200<<10, 1)
+
+	push(t, s, templateID, 1, content)
+	if got := pull(t, s, templateID, 1); !bytes.Equal(got, content) {
+		t.Fatalf("pulled %d bytes, pushed %d", len(got), len(content))
+	}
+
+	job := versionJob(t, s, 1)
+	if job.Status != "completed" || job.Progress != 100 {
+		t.Fatalf("job is %s at %d%%, want completed at 100%%", job.Status, job.Progress)
+	}
+
+	version, err := s.storage.GetTemplateVersion(context.Background(), db.GetTemplateVersionParams{TemplateID: templateID.String(), VersionNumber: 1})
+	if err != nil {
+		t.Fatalf("GetTemplateVersion: %v", err)
+	}
+	hash, _ := blake3.Compute(bytes.NewReader(content))
+	if version.FileHash == nil || *version.FileHash != hash {
+		t.Fatalf("version hash %v, want %s", version.FileHash, hash)
+	}
+}
+
+func TestPushReusesStoredContent(t *testing.T) {
+	s := newTestService(t, newTestConfig())
+	templateID := uuid.New()
+	content := randomContent(200<<10, 2)
+
+	push(t, s, templateID, 1, content)
+	chunks := countObjects(t, s, "chunks/")
+
+	// The same file again stores nothing new
+	push(t, s, templateID, 2, content)
+	if n := countObjects(t, s, "chunks/"); n != chunks {
+		t.Fatalf("%d chunks after pushing the same file again, want %d", n, chunks)
+	}
+
+	// An edit in the middle only stores the chunks around it, until the
+	// boundaries line up again
+	edited := bytes.Clone(content)
+	copy(edited[100<<10:], "edited in the middle")
+	push(t, s, templateID, 3, edited)
+	if n := countObjects(t, s, "chunks/"); n <= chunks || n > chunks+5 {
+		t.Fatalf("%d chunks after a small edit, want a few more than %d", n, chunks)
+	}
+
+	for version, want := range map[int64][]byte{1: content, 2: content, 3: edited} {
+		if got := pull(t, s, templateID, version); !bytes.Equal(got, want) {
+			t.Fatalf("version %d pulled back wrong", version)
+		}
+	}
+}
+
+func TestPushEmpty(t *testing.T) {
+	s := newTestService(t, newTestConfig())
+	templateID := uuid.New()
+
+	push(t, s, templateID, 1, nil)
+	if err := s.PushStream(context.Background(), PushStreamParams{
+		TemplateID: templateID,
+		Version:    2,
+		Content:    bytes.NewReader(nil),
+		Size:       0,
+	}); err != nil {
+		t.Fatalf("PushStream: %v", err)
+	}
+
+	for version := range int64(2) {
+		if got := pull(t, s, templateID, version+1); len(got) != 0 {
+			t.Fatalf("pulled %d bytes of an empty version %d", len(got), version+1)
+		}
+	}
+}
+
+func TestPushFailureTombstonesChunks(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Objectstore.Memory.MaxTotalSize = 1
+	s := newTestService(t, cfg)
+	templateID := uuid.New()
+
+	// Fills the primary part way through
+	err := s.Push(context.Background(), PushParams{TemplateID: templateID, Version: 1, File: fileHeader(t, randomContent(2<<20, 5))})
+	if err == nil {
+		t.Fatal("Push over the store limit succeeded")
+	}
+	if countObjects(t, s, "chunks/") == 0 {
+		t.Fatal("no chunks uploaded before the store filled up")
+	}
+
+	it := s.objectStore.List(context.Background(), "chunks/")
+	for it.Next() {
+		if _, err := s.storage.GetObjectTombstone(context.Background(), it.Item().Key); err != nil {
+			t.Fatalf("chunk %s of the failed push not tombstoned: %v", it.Item().Key, err)
+		}
+	}
+	s.collectGarbage(context.Background(), 0)
+	if n := countObjects(t, s, "chunks/"); n != 0 {
+		t.Fatalf("%d chunks left after garbage collection", n)
+	}
+
+	// The store has room again
+	content := randomContent(100<<10, 6)
+	push(t, s, templateID, 1, content)
+	if got := pull(t, s, templateID, 1); !bytes.Equal(got, content) {
+		t.Fatalf("pulled %d bytes, pushed %d", len(got), len(content))
+	}
+}
+
+// flakyStore fails the first upload.
+type flakyStore struct {
+	objectstore.Client
+	failed atomic.Bool
+}
+
+func (f *flakyStore) Upload(ctx context.Context, key string, content io.Reader) error {
+	if f.failed.CompareAndSwap(false, true) {
+		io.Copy(io.Discard, io.LimitReader(content, 100))
+		return errors.New("connection reset")
+	}
+	return f.Client.Upload(ctx, key, content)
+}
+
+func TestPushRetriesChunkUploads(t *testing.T) {
+	cfg := newTestConfig()
+	s := newTestService(t, cfg)
+
+	// A retrying primary that fails once, under the cache decorator
+	memoryStore, err := newMemoryStore(cfg.Objectstore.Memory)
+	if err != nil {
+		t.Fatalf("newMemoryStore: %v", err)
+	}
+	primary, err := newResilientStore(cfg, &flakyStore{Client: memoryStore})
+	if err != nil {
+		t.Fatalf("newResilientStore: %v", err)
+	}
+	cacheTier, err := newMemoryStore(cfg.Objectstore.Memory)
+	if err != nil {
+		t.Fatalf("newMemoryStore: %v", err)
+	}
+	cacheStore, err := cache.NewCacheClient(cache.CacheConfig{Cache: cacheTier, Primary: primary, EvictionPolicy: newEvictionPolicy(cfg)})
+	if err != nil {
+		t.Fatalf("NewCacheClient: %v", err)
+	}
+	s.objectStore, s.uncompressedStore, s.cache = cacheStore, cacheStore, cacheStore
+
+	templateID := uuid.New()
+	content := randomContent(100<<10, 7)
+	push(t, s, templateID, 1, content)
+	if got := pull(t, s, templateID, 1); !bytes.Equal(got, content) {
+		t.Fatalf("pulled %d bytes, pushed %d", len(got), len(content))
+	}
+}
+
+func TestPushExistingVersion(t *testing.T) {
+	s := newTestService(t, newTestConfig())
+	templateID := uuid.New()
+	push(t, s, templateID, 1, []byte("first"))
+
+	err := s.Push(context.Background(), PushParams{TemplateID: templateID, Version: 1, File: fileHeader(t, []byte("second"))})
+	if !errors.Is(err, model.NewError("template_version.already_exists", "")) {
+		t.Fatalf("Push error = %v, want template_version.already_exists", err)
+	}
+	jobs, err := s.storage.ListJobs(context.Background(), db.ListJobsParams{Limit: 100})
+	if err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	statuses := map[string]int{}
+	for _, job := range jobs {
+		statuses[job.Status]++
+	}
+	if statuses["completed"] != 1 || statuses["error"] != 1 {
+		t.Fatalf("jobs by status %v, want one completed and one error", statuses)
+	}
+	if got := pull(t, s, templateID, 1); string(got) != "first" {
+		t.Fatalf("version 1 is %q after a second push, want %q", got, "first")
+	}
+}
+
+func TestPushStream(t *testing.T) {
+	s := newTestService(t, newTestConfig())
+	templateID := uuid.New()
+	content := randomContent(100<<10, 3)
+	hash, _ := blake3.Compute(bytes.NewReader(content))
+
+	if err := s.PushStream(context.Background(), PushStreamParams{
+		TemplateID: templateID,
+		Version:    1,
+		Content:    bytes.NewReader(content),
+		Size:       -1,
+		Hash:       hash,
+	}); err != nil {
+		t.Fatalf("PushStream: %v", err)
+	}
+	if got := pull(t, s, templateID, 1); !bytes.Equal(got, content) {
+		t.Fatalf("pulled %d bytes, pushed %d", len(got), len(content))
+	}
+	chunks := countObjects(t, s, "chunks/")
+
+	err := s.PushStream(context.Background(), PushStreamParams{
+		TemplateID: templateID,
+		Version:    2,
+		Content:    bytes.NewReader(content[1:]),
+		Size:       -1,
+		Hash:       hash,
+	})
+	if !errors.Is(err, model.NewError("push.hash_mismatch", "")) {
+		t.Fatalf("PushStream error = %v, want push.hash_mismatch", err)
+	}
+	if job := versionJob(t, s, 2); job.Status != "error" {
+		t.Fatalf("job of the mismatched push is %s, want error", job.Status)
+	}
+	if _, err := s.Pull(context.Background(), PullParams{TemplateID: templateID, Version: 2}); err == nil {
+		t.Fatal("mismatched push created a version")
+	}
+
+	// What the mismatched push uploaded is collected, what version 1 uses is kept
+	s.collectGarbage(context.Background(), 0)
+	if n := countObjects(t, s, "chunks/"); n != chunks {
+		t.Fatalf("%d chunks after garbage collection, want the %d of version 1", n, chunks)
+	}
+	if got := pull(t, s, templateID, 1); !bytes.Equal(got, content) {
+		t.Fatal("version 1 pulled back wrong after garbage collection")
+	}
+}
+
+func TestPushWhole(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Objectstore.Chunking.Enabled = false
+	cfg.Objectstore.Compression = config.Compression{Enabled: true, Level: 3}
+	s := newTestService(t, cfg)
+	// Parts far below the 5 MB S3 takes, to spread test files over several
+	s.parallel = objectstore.ParallelOptions{PartSize: 16 << 10, Concurrency: 3}
+	templateID := uuid.New()
+	content := randomContent(100<<10, 8)
+	hash, _ := blake3.Compute(bytes.NewReader(content))
+
+	push(t, s, templateID, 1, content)
+	blob, err := s.storage.GetBlobByHash(context.Background(), &hash)
+	if err != nil {
+		t.Fatalf("GetBlobByHash: %v", err)
+	}
+	if blob.Chunked || blob.Compressed || blob.ObjectKey != getBlobKey(hash) {
+		t.Fatalf("blob %s chunked %v compressed %v, want stored whole and uncompressed", blob.ObjectKey, blob.Chunked, blob.Compressed)
+	}
+	if n := countObjects(t, s, "chunks/"); n != 0 {
+		t.Fatalf("%d chunks stored without chunking", n)
+	}
+
+	// A stream stored whole, the same content again, and a mismatch
+	streamed := randomContent(100<<10, 9)
+	for version, content := range map[int64][]byte{2: streamed, 3: content} {
+		if err := s.PushStream(context.Background(), PushStreamParams{TemplateID: templateID, Version: version, Content: bytes.NewReader(content), Size: -1}); err != nil {
+			t.Fatalf("PushStream version %d: %v", version, err)
+		}
+	}
+	err = s.PushStream(context.Background(), PushStreamParams{TemplateID: templateID, Version: 4, Content: bytes.NewReader(streamed[1:]), Size: -1, Hash: hash})
+	if !errors.Is(err, model.NewError("push.hash_mismatch", "")) {
+		t.Fatalf("PushStream error = %v, want push.hash_mismatch", err)
+	}
+	// Only the new stream is kept, under its upload key
+	if n := countObjects(t, s, "uploads/"); n != 1 {
+		t.Fatalf("%d streams kept, want 1", n)
+	}
+
+	for version, want := range map[int64][]byte{1: content, 2: streamed, 3: content} {
+		if got := pull(t, s, templateID, version); !bytes.Equal(got, want) {
+			t.Fatalf("version %d pulled back wrong", version)
+		}
+	}
+}
+
+func TestPullRange(t *testing.T) {
+	s := newTestService(t, newTestConfig())
+	templateID := uuid.New()
+	content := randomContent(200<<10, 4)
+	push(t, s, templateID, 1, content)
+
+	result, err := s.Pull(context.Background(), PullParams{TemplateID: templateID, Version: 1})
+	if err != nil {
+		t.Fatalf("Pull: %v", err)
+	}
+	defer result.Content.Close()
+
+	// Seeking across chunks, like a resumed download
+	for _, offset := range []int64{150 << 10, 10, int64(len(content)) - 7} {
+		if _, err := result.Content.Seek(offset, io.SeekStart); err != nil {
+			t.Fatalf("Seek(%d): %v", offset, err)
+		}
+		got := make([]byte, 7)
+		if _, err := io.ReadFull(result.Content, got); err != nil {
+			t.Fatalf("read at %d: %v", offset, err)
+		}
+		if !bytes.Equal(got, content[offset:offset+7]) {
+			t.Fatalf("read at %d returned the wrong bytes", offset)
+		}
+	}
+}
+
+func TestPullNotFound(t *testing.T) {
+	s := newTestService(t, newTestConfig())
+
+	_, err := s.Pull(context.Background(), PullParams{TemplateID: uuid.New(), Version: 1})
+	if !errors.Is(err, model.NewError("template_version.not_found", "")) {
+		t.Fatalf("Pull error = %v, want template_version.not_found", err)
+	}
+}
+
+// signingStore signs URLs that name the object key, to redirect pulls to.
+type signingStore struct {
+	objectstore.Client
+}
+
+func (signingStore) GetURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "https://primary.test/" + key, nil
+}
+
+func TestPullURL(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Objectstore.Redirect = "always"
+	cfg.Objectstore.Compression = config.Compression{Enabled: true, Level: 3}
+	s := newTestService(t, cfg)
+	s.enableRedirects(signingStore{s.uncompressedStore})
+	templateID := uuid.New()
+	form := randomContent(100<<10, 10)
+	streamed := randomContent(100<<10, 11)
+
+	push(t, s, templateID, 1, form)
+	if err := s.PushStream(context.Background(), PushStreamParams{TemplateID: templateID, Version: 2, Content: bytes.NewReader(streamed), Size: -1}); err != nil {
+		t.Fatalf("PushStream: %v", err)
+	}
+
+	for version, content := range map[int64][]byte{1: form, 2: streamed} {
+		target, err := s.PullURL(context.Background(), PullURLParams{TemplateID: templateID, Version: version})
+		if err != nil {
+			t.Fatalf("PullURL version %d: %v", version, err)
+		}
+		key, ok := strings.CutPrefix(target.URL, "https://primary.test/")
+		if !ok {
+			t.Fatalf("version %d not redirected: %q", version, target.URL)
+		}
+		// The object redirected to is the file as pushed
+		body, err := s.uncompressedStore.Download(context.Background(), key)
+		if err != nil {
+			t.Fatalf("Download %s: %v", key, err)
+		}
+		got, _ := io.ReadAll(body)
+		body.Close()
+		if !bytes.Equal(got, content) {
+			t.Fatalf("version %d redirected to the wrong content", version)
+		}
+
+		// A proxied pull takes the version PullURL found
+		if target.Version == nil || target.Version.VersionNumber != version {
+			t.Fatalf("PullURL version %d found %+v", version, target.Version)
+		}
+		result, err := s.Pull(context.Background(), PullParams{TemplateID: templateID, Version: version, Found: target.Version})
+		if err != nil {
+			t.Fatalf("Pull: %v", err)
+		}
+		got, _ = io.ReadAll(result.Content)
+		result.Content.Close()
+		if !bytes.Equal(got, content) {
+			t.Fatalf("version %d pulled back wrong", version)
+		}
+	}
+
+	// Overridden for one pull
+	target, err := s.PullURL(context.Background(), PullURLParams{TemplateID: templateID, Version: 1, Redirect: "never"})
+	if err != nil || target.URL != "" {
+		t.Fatalf("PullURL with redirects off = %q, %v", target.URL, err)
+	}
+}
@@ -0,0 +1,455 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/google/uuid"
+
+	"github.com/beanbocchi/templar/internal/client/objectstore"
+	"github.com/beanbocchi/templar/internal/db"
+	"github.com/beanbocchi/templar/internal/model"
+	"github.com/beanbocchi/templar/internal/utils/blake3"
+	"github.com/beanbocchi/templar/internal/utils/ioutil"
+	"github.com/beanbocchi/templar/internal/utils/progressr"
+)
+
+// Upload is a resumable push and the parts it received so far.
+type Upload struct {
+	ID         string          `json:"id"`
+	TemplateID string          `json:"template_id"`
+	Version    int64           `json:"version"`
+	PartCount  int64           `json:"part_count"`
+	Parts      []db.UploadPart `json:"parts"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+type CreateUploadParams struct {
+	TemplateID uuid.UUID `validate:"required,uuid"`
+	Version    int64     `validate:"required,min=1"`
+	// PartCount is how many parts the file is sent in, up to 10000 as on S3
+	PartCount int64 `validate:"required,min=1,max=10000"`
+}
+
+// CreateUpload starts a resumable push of a template version. The file is
+// sent in numbered parts, which go straight to a multipart upload on the
+// object store. The part count is fixed up front, so the last part is known
+// when it arrives, encryption marks it.
+func (s *Service) CreateUpload(ctx context.Context, params CreateUploadParams) (Upload, error) {
+	if err := s.checkVersionFree(ctx, params.TemplateID, params.Version); err != nil {
+		return Upload{}, err
+	}
+
+	id := uuid.New()
+	key := getUploadKey(id)
+	multipartID, err := s.objectStore.CreateMultipart(ctx, key)
+	if errors.Is(err, model.ErrStoreUnavailable) {
+		return Upload{}, err
+	}
+	if err != nil {
+		return Upload{}, model.NewError("object_store.create_multipart", "Failed to start upload: %w").Fmt(err)
+	}
+
+	upload, err := s.storage.CreateUpload(ctx, db.CreateUploadParams{
+		ID:            id.String(),
+		TemplateID:    params.TemplateID.String(),
+		VersionNumber: params.Version,
+		ObjectKey:     key,
+		MultipartID:   multipartID,
+		PartCount:     params.PartCount,
+	})
+	if err != nil {
+		if err := s.objectStore.AbortMultipart(ctx, key, multipartID); err != nil {
+			slog.Warn("failed to abort multipart upload", "key", key, "error", err)
+		}
+		return Upload{}, fmt.Errorf("create upload: %w", err)
+	}
+
+	return newUpload(upload, []db.UploadPart{}), nil
+}
+
+type GetUploadParams struct {
+	UploadID uuid.UUID `validate:"required,uuid"`
+}
+
+// GetUpload returns an upload with the parts received so far, for a client
+// to find out which ones to resend.
+func (s *Service) GetUpload(ctx context.Context, params GetUploadParams) (Upload, error) {
+	upload, err := s.getUpload(ctx, params.UploadID)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	parts, err := s.storage.ListUploadParts(ctx, upload.ID)
+	if err != nil {
+		return Upload{}, fmt.Errorf("list upload parts: %w", err)
+	}
+	return newUpload(upload, parts), nil
+}
+
+type UploadPartParams struct {
+	UploadID uuid.UUID `validate:"required,uuid"`
+	// PartNumber goes up to the part count of the upload
+	PartNumber int64 `validate:"required,min=1,max=10000"`
+	// Checksum is the hex BLAKE3 hash of Content
+	Checksum string `validate:"required,len=64,hexadecimal"`
+	Content  io.Reader
+}
+
+// UploadPart stores one part of an upload, replacing a part sent before under
+// the same number. The part is only recorded once its checksum matches.
+func (s *Service) UploadPart(ctx context.Context, params UploadPartParams) (db.UploadPart, error) {
+	upload, err := s.getUpload(ctx, params.UploadID)
+	if err != nil {
+		return db.UploadPart{}, err
+	}
+	if params.PartNumber > upload.PartCount {
+		return db.UploadPart{}, model.NewError("upload_part.out_of_range", "Upload %s has %d parts, got part %d").Fmt(upload.ID, upload.PartCount, params.PartNumber)
+	}
+
+	partParams := db.DeleteUploadPartParams{
+		UploadID:   upload.ID,
+		PartNumber: params.PartNumber,
+	}
+
+	sizeReader := ioutil.NewSizeReader(params.Content)
+	hasher := blake3.New()
+	last := params.PartNumber == upload.PartCount
+	err = objectstore.UploadPart(ctx, s.objectStore, upload.ObjectKey, upload.MultipartID, int(params.PartNumber), io.TeeReader(sizeReader, hasher), last)
+	if err == nil && hasher.Sum() != params.Checksum {
+		err = model.NewError("upload_part.checksum_mismatch", "Part %d checksum mismatch: expected %s, got %s").Fmt(params.PartNumber, params.Checksum, hasher.Sum())
+	}
+	if err != nil {
+		// Whatever the store holds under this number now isn't what was recorded
+		if err := s.storage.DeleteUploadPart(ctx, partParams); err != nil {
+			slog.Warn("failed to delete upload part", "upload", upload.ID, "part", params.PartNumber, "error", err)
+		}
+
+		var errWithCode model.ErrorWithCode
+		switch {
+		case errors.As(err, &errWithCode):
+			return db.UploadPart{}, err
+		case errors.Is(err, objectstore.ErrNotFound):
+			// The multipart session expired on the store
+			return db.UploadPart{}, model.NewError("upload.not_found", "Upload %s not found").Fmt(upload.ID)
+		default:
+			return db.UploadPart{}, model.NewError("object_store.upload_part", "Failed to upload part %d: %w").Fmt(params.PartNumber, err)
+		}
+	}
+
+	if err := s.storage.PutUploadPart(ctx, db.PutUploadPartParams{
+		UploadID:   upload.ID,
+		PartNumber: params.PartNumber,
+		Size:       sizeReader.Size,
+		Checksum:   params.Checksum,
+	}); err != nil {
+		return db.UploadPart{}, fmt.Errorf("put upload part: %w", err)
+	}
+	if err := s.storage.TouchUpload(ctx, upload.ID); err != nil {
+		slog.Warn("failed to touch upload", "upload", upload.ID, "error", err)
+	}
+
+	return db.UploadPart{
+		UploadID:   upload.ID,
+		PartNumber: params.PartNumber,
+		Size:       sizeReader.Size,
+		Checksum:   params.Checksum,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+type CompleteUploadParams struct {
+	UploadID uuid.UUID `validate:"required,uuid"`
+	// Hash is the expected hex BLAKE3 hash of the whole file, optional
+	Hash string `validate:"omitempty,len=64,hexadecimal"`
+}
+
+// CompleteUpload assembles the parts, numbered from 1 to the part count, and
+// creates the template version. The file is read back once to hash it, as
+// parts may have arrived in any order. Once the parts are assembled they
+// can't be sent again, so the rest doesn't stop when the client goes away.
+func (s *Service) CompleteUpload(ctx context.Context, params CompleteUploadParams) (db.TemplateVersion, error) {
+	upload, err := s.getUpload(ctx, params.UploadID)
+	if err != nil {
+		return db.TemplateVersion{}, err
+	}
+	templateID, err := uuid.Parse(upload.TemplateID)
+	if err != nil {
+		return db.TemplateVersion{}, fmt.Errorf("parse template id: %w", err)
+	}
+
+	parts, err := s.storage.ListUploadParts(ctx, upload.ID)
+	if err != nil {
+		return db.TemplateVersion{}, fmt.Errorf("list upload parts: %w", err)
+	}
+	// An upload without a part count can't take parts, it never completes
+	var size int64
+	for i := range max(upload.PartCount, 1) {
+		if i >= int64(len(parts)) || parts[i].PartNumber != i+1 {
+			return db.TemplateVersion{}, model.NewError("upload.incomplete", "Upload %s is missing part %d").Fmt(upload.ID, i+1)
+		}
+		size += parts[i].Size
+	}
+
+	job, err := s.storage.CreateJob(ctx, db.CreateJobParams{
+		Type:          "template.push",
+		TemplateID:    upload.TemplateID,
+		VersionNumber: ptr.Int64(upload.VersionNumber),
+		Status:        "pending",
+		Progress:      0,
+		StartedAt:     time.Now(),
+	})
+	if err != nil {
+		return db.TemplateVersion{}, fmt.Errorf("create job: %w", err)
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	if err := s.checkVersionFree(ctx, templateID, upload.VersionNumber); err != nil {
+		s.failJob(ctx, job.ID, err)
+		return db.TemplateVersion{}, err
+	}
+	version, err := s.completeUpload(ctx, job.ID, upload, templateID, size, params.Hash)
+	if err != nil {
+		s.failJob(ctx, job.ID, err)
+		return db.TemplateVersion{}, err
+	}
+
+	s.storage.UpdateJob(ctx, db.UpdateJobParams{
+		ID:          job.ID,
+		Status:      ptr.String("completed"),
+		Progress:    ptr.Int64(100),
+		CompletedAt: ptr.Time(time.Now()),
+	})
+
+	return version, nil
+}
+
+func (s *Service) completeUpload(
+	ctx context.Context,
+	jobID int64,
+	upload db.Upload,
+	templateID uuid.UUID,
+	size int64,
+	expectedHash string,
+) (db.TemplateVersion, error) {
+	if err := s.ensureTemplate(ctx, templateID); err != nil {
+		return db.TemplateVersion{}, err
+	}
+
+	if err := s.objectStore.CompleteMultipart(ctx, upload.ObjectKey, upload.MultipartID); err != nil {
+		if errors.Is(err, objectstore.ErrNotFound) {
+			return db.TemplateVersion{}, model.NewError("upload.not_found", "Upload %s not found").Fmt(upload.ID)
+		}
+		return db.TemplateVersion{}, fmt.Errorf("complete multipart: %w", err)
+	}
+
+	// From here the parts are gone, the upload can't be resumed. It is
+	// deleted once the version is created, or the assembled file is.
+	hash, err := s.hashObject(ctx, jobID, upload.ObjectKey, size)
+	if err == nil && expectedHash != "" && hash != expectedHash {
+		err = model.NewError("upload.hash_mismatch", "Upload %s hash mismatch: expected %s, got %s").Fmt(upload.ID, expectedHash, hash)
+	}
+	if err != nil {
+		s.discardUpload(ctx, upload)
+		return db.TemplateVersion{}, err
+	}
+
+	info, err := s.objectStore.Stat(ctx, upload.ObjectKey)
+	if err != nil {
+		s.discardUpload(ctx, upload)
+		return db.TemplateVersion{}, fmt.Errorf("stat upload: %w", err)
+	}
+
+	// Same races with DeleteVersion as Push
+	var reused bool
+	for attempt := 1; ; attempt++ {
+		reused, err = s.storeUpload(ctx, upload, templateID, hash, size, info.Size)
+		if !errors.Is(err, errContentDeleted) || attempt == maxStoreAttempts {
+			break
+		}
+	}
+	if err != nil {
+		s.discardUpload(ctx, upload)
+		return db.TemplateVersion{}, err
+	}
+	if reused {
+		s.deleteObject(ctx, upload.ObjectKey)
+	}
+	if err := s.deleteUpload(ctx, upload.ID); err != nil {
+		slog.Warn("failed to delete upload", "upload", upload.ID, "error", err)
+	}
+
+	version, err := s.storage.GetTemplateVersion(ctx, db.GetTemplateVersionParams{
+		TemplateID:    templateID.String(),
+		VersionNumber: upload.VersionNumber,
+	})
+	if err != nil {
+		return db.TemplateVersion{}, fmt.Errorf("get template version: %w", err)
+	}
+	return version, nil
+}
+
+// discardUpload deletes an assembled upload that didn't become a version.
+func (s *Service) discardUpload(ctx context.Context, upload db.Upload) {
+	s.deleteObject(ctx, upload.ObjectKey)
+	if err := s.deleteUpload(ctx, upload.ID); err != nil {
+		slog.Warn("failed to delete upload", "upload", upload.ID, "error", err)
+	}
+}
+
+// storeUpload creates the version from an assembled upload. A file that was
+// pushed before reuses the stored blob, and reused reports that the upload
+// isn't needed anymore. Otherwise the upload is kept whole as a new blob.
+func (s *Service) storeUpload(
+	ctx context.Context,
+	upload db.Upload,
+	templateID uuid.UUID,
+	hash string,
+	size int64,
+	storedSize int64,
+) (reused bool, err error) {
+	versionParams := createVersionParams{
+		TemplateID: templateID,
+		Version:    upload.VersionNumber,
+		ObjectKey:  upload.ObjectKey,
+		Hash:       hash,
+		Size:       size,
+		Whole:      true,
+		StoredSize: storedSize,
+		// Parts are uploaded through the compressing store
+		Compressed: s.compress,
+	}
+
+	blob, err := s.storage.GetBlobByHash(ctx, ptr.String(hash))
+	switch {
+	case err == nil:
+		versionParams.ObjectKey = blob.ObjectKey
+		versionParams.Whole = false
+		reused = true
+	case !errors.Is(err, sql.ErrNoRows):
+		return false, fmt.Errorf("get blob: %w", err)
+	}
+
+	return reused, s.createVersion(ctx, versionParams)
+}
+
+// hashObject reads an object back to hash it, reporting progress on the job.
+func (s *Service) hashObject(ctx context.Context, jobID int64, key string, size int64) (string, error) {
+	reader, err := s.objectStore.Download(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("download upload: %w", err)
+	}
+	defer reader.Close()
+
+	progressReader := progressr.NewReader(reader, size)
+	stop := s.monitorProgress(ctx, jobID, progressReader)
+	defer stop()
+
+	sizeReader := ioutil.NewSizeReader(progressReader)
+	hash, err := blake3.Compute(sizeReader)
+	if err != nil {
+		return "", fmt.Errorf("hash upload: %w", err)
+	}
+	if sizeReader.Size != size {
+		return "", fmt.Errorf("assembled upload has %d bytes, parts have %d", sizeReader.Size, size)
+	}
+	return hash, nil
+}
+
+type AbortUploadParams struct {
+	UploadID uuid.UUID `validate:"required,uuid"`
+}
+
+// AbortUpload cancels an upload and drops the parts received.
+func (s *Service) AbortUpload(ctx context.Context, params AbortUploadParams) error {
+	upload, err := s.getUpload(ctx, params.UploadID)
+	if err != nil {
+		return err
+	}
+	return s.abortUpload(ctx, upload)
+}
+
+func (s *Service) abortUpload(ctx context.Context, upload db.Upload) error {
+	err := s.objectStore.AbortMultipart(ctx, upload.ObjectKey, upload.MultipartID)
+	if err != nil && !errors.Is(err, objectstore.ErrNotFound) {
+		return fmt.Errorf("abort multipart: %w", err)
+	}
+	return s.deleteUpload(ctx, upload.ID)
+}
+
+// expireUploads aborts the uploads that received nothing since before, and
+// returns how many were aborted.
+func (s *Service) expireUploads(ctx context.Context, before time.Time) (int, error) {
+	uploads, err := s.storage.ListIdleUploads(ctx, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("list idle uploads: %w", err)
+	}
+
+	var errs []error
+	expired := 0
+	for _, upload := range uploads {
+		if err := s.abortUpload(ctx, upload); err != nil {
+			errs = append(errs, fmt.Errorf("upload %s: %w", upload.ID, err))
+			continue
+		}
+		expired++
+	}
+	return expired, errors.Join(errs...)
+}
+
+func (s *Service) getUpload(ctx context.Context, id uuid.UUID) (db.Upload, error) {
+	upload, err := s.storage.GetUpload(ctx, id.String())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.Upload{}, model.NewError("upload.not_found", "Upload %s not found").Fmt(id.String())
+		}
+		return db.Upload{}, fmt.Errorf("get upload: %w", err)
+	}
+	return upload, nil
+}
+
+func (s *Service) deleteUpload(ctx context.Context, id string) error {
+	tx, err := s.storage.BeginTx()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.DeleteUploadParts(ctx, id); err != nil {
+		return fmt.Errorf("delete upload parts: %w", err)
+	}
+	if err := tx.DeleteUpload(ctx, id); err != nil {
+		return fmt.Errorf("delete upload: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// deleteObject removes an object nothing refers to, a failure only leaks it.
+func (s *Service) deleteObject(ctx context.Context, key string) {
+	if err := s.objectStore.Delete(ctx, key); err != nil {
+		slog.Warn("failed to delete object", "key", key, "error", err)
+	}
+}
+
+func newUpload(upload db.Upload, parts []db.UploadPart) Upload {
+	return Upload{
+		ID:         upload.ID,
+		TemplateID: upload.TemplateID,
+		Version:    upload.VersionNumber,
+		PartCount:  upload.PartCount,
+		Parts:      parts,
+		CreatedAt:  upload.CreatedAt,
+		UpdatedAt:  upload.UpdatedAt,
+	}
+}
@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/beanbocchi/templar/internal/model"
+	"github.com/beanbocchi/templar/internal/service"
+	"github.com/beanbocchi/templar/pkg/response"
+)
+
+type CacheVersionRequest struct {
+	TemplateID uuid.UUID `param:"template_id" validate:"required,uuid"`
+	Version    int64     `param:"version" validate:"required,min=1"`
+}
+
+func (h *Handler) bindCacheVersion(c echo.Context) (service.CacheVersionParams, error) {
+	var req CacheVersionRequest
+	if err := c.Bind(&req); err != nil {
+		return service.CacheVersionParams{}, err
+	}
+	if err := c.Validate(&req); err != nil {
+		return service.CacheVersionParams{}, err
+	}
+
+	return service.CacheVersionParams{
+		TemplateID: req.TemplateID,
+		Version:    req.Version,
+	}, nil
+}
+
+// PinVersion pins a template version in the cache and answers with the job
+// warming it.
+func (h *Handler) PinVersion(c echo.Context) error {
+	params, err := h.bindCacheVersion(c)
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	job, err := h.svc.PinVersion(c.Request().Context(), params)
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromDTO(c.Response().Writer, http.StatusAccepted, job)
+}
+
+func (h *Handler) UnpinVersion(c echo.Context) error {
+	params, err := h.bindCacheVersion(c)
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	if err := h.svc.UnpinVersion(c.Request().Context(), params); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromMessage(c.Response().Writer, http.StatusOK, "Template version unpinned")
+}
+
+// WarmVersion starts fetching a template version into the cache and answers
+// with the job doing it.
+func (h *Handler) WarmVersion(c echo.Context) error {
+	params, err := h.bindCacheVersion(c)
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	job, err := h.svc.WarmVersion(c.Request().Context(), params)
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromDTO(c.Response().Writer, http.StatusAccepted, job)
+}
+
+func (h *Handler) ListPinnedVersions(c echo.Context) error {
+	pins, err := h.svc.ListPinnedVersions(c.Request().Context())
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromDTO(c.Response().Writer, http.StatusOK, pins)
+}
+
+func (h *Handler) GetCacheStats(c echo.Context) error {
+	return response.FromDTO(c.Response().Writer, http.StatusOK, h.svc.GetCacheStats())
+}
+
+type ListCacheEntriesRequest struct {
+	model.PaginationParams
+}
+
+func (h *Handler) ListCacheEntries(c echo.Context) error {
+	var req ListCacheEntriesRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	entries, err := h.svc.ListCacheEntries(c.Request().Context(), service.ListCacheEntriesParams{
+		PaginationParams: req.PaginationParams,
+	})
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromDTO(c.Response().Writer, http.StatusOK, entries)
+}
+
+// EvictCacheEntryRequest takes the key as a query parameter, cache keys contain slashes.
+type EvictCacheEntryRequest struct {
+	Key string `query:"key" validate:"required"`
+}
+
+func (h *Handler) EvictCacheEntry(c echo.Context) error {
+	var req EvictCacheEntryRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	if err := h.svc.EvictCacheEntry(c.Request().Context(), service.EvictCacheEntryParams{Key: req.Key}); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromMessage(c.Response().Writer, http.StatusOK, "Cache entry evicted")
+}
+
+// PurgeCache drops every unpinned cache entry.
+func (h *Handler) PurgeCache(c echo.Context) error {
+	purged, err := h.svc.PurgeCache(c.Request().Context())
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromMessage(c.Response().Writer, http.StatusOK, fmt.Sprintf("Purged %d cache entries", purged))
+}
@@ -0,0 +1,36 @@
+package transport
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/beanbocchi/templar/internal/service"
+	"github.com/beanbocchi/templar/pkg/response"
+)
+
+type DeleteVersionRequest struct {
+	TemplateID uuid.UUID `param:"template_id" validate:"required,uuid"`
+	Version    int64     `param:"version" validate:"required,min=1"`
+}
+
+func (h *Handler) DeleteVersion(c echo.Context) error {
+	var req DeleteVersionRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	if err := h.svc.DeleteVersion(c.Request().Context(), service.DeleteVersionParams{
+		TemplateID: req.TemplateID,
+		Version:    req.Version,
+	}); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromMessage(c.Response().Writer, http.StatusOK, "Template version deleted")
+}
@@ -0,0 +1,146 @@
+package transport
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/beanbocchi/templar/internal/service"
+	"github.com/beanbocchi/templar/pkg/response"
+)
+
+type CreateDownloadLinkRequest struct {
+	TemplateID   uuid.UUID `json:"template_id" form:"template_id" validate:"required,uuid"`
+	Version      int64     `json:"version" form:"version" validate:"required,min=1"`
+	TTL          int64     `json:"ttl" form:"ttl" validate:"gte=0"`
+	MaxDownloads int64     `json:"max_downloads" form:"max_downloads" validate:"gte=0"`
+	SingleUse    bool      `json:"single_use" form:"single_use" validate:"excluded_with=MaxDownloads"`
+}
+
+// CreateDownloadLink issues a signed URL that downloads a template version
+// without credentials.
+func (h *Handler) CreateDownloadLink(c echo.Context) error {
+	var req CreateDownloadLinkRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	maxDownloads := req.MaxDownloads
+	if req.SingleUse {
+		maxDownloads = 1
+	}
+
+	link, err := h.svc.CreateDownloadLink(c.Request().Context(), service.CreateDownloadLinkParams{
+		TemplateID:   req.TemplateID,
+		Version:      req.Version,
+		TTL:          req.TTL,
+		MaxDownloads: maxDownloads,
+	})
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromDTO(c.Response().Writer, http.StatusCreated, link)
+}
+
+type DownloadLinkRequest struct {
+	LinkID uuid.UUID `param:"link_id" validate:"required,uuid"`
+}
+
+func (h *Handler) GetDownloadLink(c echo.Context) error {
+	var req DownloadLinkRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	link, err := h.svc.GetDownloadLink(c.Request().Context(), service.GetDownloadLinkParams{
+		LinkID: req.LinkID,
+	})
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromDTO(c.Response().Writer, http.StatusOK, link)
+}
+
+func (h *Handler) RevokeDownloadLink(c echo.Context) error {
+	var req DownloadLinkRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	if err := h.svc.RevokeDownloadLink(c.Request().Context(), service.RevokeDownloadLinkParams{
+		LinkID: req.LinkID,
+	}); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromMessage(c.Response().Writer, http.StatusOK, "Download link revoked")
+}
+
+type SharedFileRequest struct {
+	LinkID    uuid.UUID `param:"link_id" validate:"required,uuid"`
+	Expires   int64     `query:"expires" validate:"required"`
+	Signature string    `query:"signature" validate:"required"`
+}
+
+// SharedFile serves a template version through a download link. Range
+// requests are honored, and count as a download unless every range starts
+// past the beginning of the file.
+func (h *Handler) SharedFile(c echo.Context) error {
+	var req SharedFileRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	result, err := h.svc.OpenDownloadLink(c.Request().Context(), service.OpenDownloadLinkParams{
+		LinkID:    req.LinkID,
+		Expires:   req.Expires,
+		Signature: req.Signature,
+		Resumed:   resumesDownload(c.Request()),
+	})
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+	defer result.Content.Close()
+
+	serveVersion(c, result)
+	return nil
+}
+
+// resumesDownload reports whether a request only asks for content past the
+// start of the file, as a client continuing a download does. Suffix ranges
+// ("bytes=-500") and ranges that don't parse could cover the start, so they
+// count as a new download.
+func resumesDownload(r *http.Request) bool {
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok {
+		return false
+	}
+	for _, rng := range strings.Split(spec, ",") {
+		start, _, ok := strings.Cut(strings.TrimSpace(rng), "-")
+		if !ok {
+			return false
+		}
+		offset, err := strconv.ParseInt(start, 10, 64)
+		if err != nil || offset <= 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -2,7 +2,6 @@ package transport
 
 import (
 	"fmt"
-	"io"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -13,10 +12,16 @@ import (
 )
 
 type PullRequest struct {
-	TemplateID uuid.UUID `json:"template_id" validate:"required,uuid"`
-	Version    int64     `json:"version" validate:"required,min=1"`
+	TemplateID uuid.UUID `json:"template_id" param:"template_id" validate:"required,uuid"`
+	Version    int64     `json:"version" param:"version" validate:"required,min=1"`
+	// Redirect overrides the configured redirect mode for this pull
+	Redirect string `json:"redirect" query:"redirect" validate:"omitempty,oneof=never always uncached"`
 }
 
+// Pull streams a template version. Range and If-Range are honored (If-Range
+// only on GET, per RFC 9110), answering 206 with Content-Range so interrupted
+// downloads can resume. When the redirect mode allows it, the client is sent
+// to the primary with a 302 instead.
 func (h *Handler) Pull(c echo.Context) error {
 	var req PullRequest
 	if err := c.Bind(&req); err != nil {
@@ -27,25 +32,42 @@ func (h *Handler) Pull(c echo.Context) error {
 		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
 	}
 
-	file, err := h.svc.Pull(c.Request().Context(), service.PullParams{
+	target, err := h.svc.PullURL(c.Request().Context(), service.PullURLParams{
 		TemplateID: req.TemplateID,
 		Version:    req.Version,
+		Redirect:   req.Redirect,
 	})
 	if err != nil {
 		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
 	}
-	defer file.Close()
+	if target.URL != "" {
+		return c.Redirect(http.StatusFound, target.URL)
+	}
 
-	c.Response().Header().Set(echo.HeaderContentType, "application/octet-stream")
-	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=template_%s_%d", req.TemplateID.String(), req.Version))
-	c.Response().WriteHeader(http.StatusOK)
-
-	if _, err := io.Copy(c.Response().Writer, file); err != nil {
-		// Cannot send error response after headers are already sent (WriteHeader was called)
-		// Just log the error - the client will see an incomplete download
-		c.Logger().Errorf("failed to stream file: %v", err)
-		return nil
+	result, err := h.svc.Pull(c.Request().Context(), service.PullParams{
+		TemplateID: req.TemplateID,
+		Version:    req.Version,
+		Found:      target.Version,
+	})
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
 	}
+	defer result.Content.Close()
 
+	serveVersion(c, result)
 	return nil
 }
+
+// serveVersion writes an opened template version as the response body.
+func serveVersion(c echo.Context, result *service.PullResult) {
+	c.Response().Header().Set(echo.HeaderContentType, "application/octet-stream")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=template_%s_%d", result.Version.TemplateID, result.Version.VersionNumber))
+	if result.Version.FileHash != nil {
+		c.Response().Header().Set("ETag", fmt.Sprintf("%q", *result.Version.FileHash))
+	}
+
+	// ServeContent handles Range/If-Range, Content-Length and Accept-Ranges.
+	// Stream errors after the headers are sent leave the client with a short
+	// body, which it can resume from.
+	http.ServeContent(c.Response(), c.Request(), "", result.Version.CreatedAt, result.Content)
+}
@@ -40,3 +40,44 @@ func (h *Handler) Push(c echo.Context) error {
 
 	return response.FromMessage(c.Response().Writer, http.StatusOK, "Template pushed, will be available in a few seconds")
 }
+
+type PushStreamRequest struct {
+	TemplateID uuid.UUID `param:"template_id" validate:"required,uuid"`
+	Version    int64     `param:"version" validate:"required,min=1"`
+	Hash       string    `header:"X-Content-Hash" validate:"omitempty,len=64,hexadecimal"`
+}
+
+// PushStream pushes the raw request body, streamed to the object store as it
+// arrives instead of being spooled like a form upload. The body may be
+// checked against a hex BLAKE3 hash in X-Content-Hash.
+func (h *Handler) PushStream(c echo.Context) error {
+	contentType := c.Request().Header.Get(echo.HeaderContentType)
+	if contentType != "" && contentType != echo.MIMEOctetStream {
+		return response.FromError(c.Response().Writer, http.StatusUnsupportedMediaType, echo.ErrUnsupportedMediaType)
+	}
+
+	// Only the path and headers are bound, binding would read the body
+	var req PushStreamRequest
+	binder := &echo.DefaultBinder{}
+	if err := binder.BindPathParams(c, &req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := binder.BindHeaders(c, &req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	if err := h.svc.PushStream(c.Request().Context(), service.PushStreamParams{
+		TemplateID: req.TemplateID,
+		Version:    req.Version,
+		Content:    c.Request().Body,
+		Size:       c.Request().ContentLength,
+		Hash:       req.Hash,
+	}); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromMessage(c.Response().Writer, http.StatusOK, "Template pushed")
+}
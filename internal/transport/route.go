@@ -15,9 +15,32 @@ func SetupRoute(e *echo.Echo, svc *service.Service) {
 	api := e.Group("/api/v1")
 
 	api.POST("/push", h.Push)
+	api.POST("/push/:template_id/:version", h.PushStream)
+	api.POST("/uploads", h.CreateUpload)
+	api.GET("/uploads/:upload_id", h.GetUpload)
+	api.PUT("/uploads/:upload_id/parts/:part_number", h.UploadPart)
+	api.POST("/uploads/:upload_id/complete", h.CompleteUpload)
+	api.DELETE("/uploads/:upload_id", h.AbortUpload)
 	api.POST("/pull", h.Pull)
+	api.GET("/pull/:template_id/:version", h.Pull)
 	api.GET("/templates", h.ListTemplate)
 	api.GET("/versions", h.ListVersions)
 	api.GET("/versions/:template_id/:version", h.GetTemplateVersion)
+	api.DELETE("/versions/:template_id/:version", h.DeleteVersion)
 	api.GET("/jobs", h.ListJobs)
+	api.POST("/links", h.CreateDownloadLink)
+	api.GET("/links/:link_id", h.GetDownloadLink)
+	api.DELETE("/links/:link_id", h.RevokeDownloadLink)
+	api.GET("/shared/files/:link_id", h.SharedFile)
+
+	admin := api.Group("/admin")
+	admin.GET("/cache", h.GetCacheStats)
+	admin.GET("/cache/entries", h.ListCacheEntries)
+	admin.DELETE("/cache/entries", h.EvictCacheEntry)
+	admin.POST("/cache/purge", h.PurgeCache)
+	admin.GET("/cache/pins", h.ListPinnedVersions)
+	admin.POST("/cache/pins/:template_id/:version", h.PinVersion)
+	admin.DELETE("/cache/pins/:template_id/:version", h.UnpinVersion)
+	admin.POST("/cache/warm/:template_id/:version", h.WarmVersion)
+	admin.GET("/multipart", h.ListMultipartSessions)
 }
@@ -0,0 +1,305 @@
+package transport
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+
+	"github.com/beanbocchi/templar/config"
+	"github.com/beanbocchi/templar/internal/service"
+	"github.com/beanbocchi/templar/internal/utils/blake3"
+)
+
+// newTestServer serves the API over a service with memory backends and a
+// migrated SQLite database in a temporary directory.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	sqliteDB, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "templar.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { sqliteDB.Close() })
+
+	driver, err := sqlite.WithInstance(sqliteDB, &sqlite.Config{MigrationsTable: "schema_migrations", DatabaseName: "templar"})
+	if err != nil {
+		t.Fatalf("create migrate driver: %v", err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://../../migrations", "sqlite", driver)
+	if err != nil {
+		t.Fatalf("create migrate: %v", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	svc, err := service.NewService(&config.Config{
+		App: config.App{JobBuffer: 10},
+		Objectstore: config.Objectstore{
+			PresignedDefaultTTL: 60,
+			PresignedSecret:     "secret",
+			DownloadBaseURL:     "http://templar.test/api/v1/shared/files",
+			Redirect:            "never",
+			Primary:             "memory",
+			Resilience: config.Resilience{
+				MaxRetries:       2,
+				BaseDelay:        1,
+				MaxDelay:         5,
+				FailureThreshold: 5,
+				Cooldown:         1,
+			},
+			Multipart: config.Multipart{Expiry: 3600},
+			Chunking: config.Chunking{
+				Enabled:     true,
+				MinSize:     1,
+				AvgSize:     4,
+				MaxSize:     16,
+				Concurrency: 4,
+				Prefetch:    1,
+			},
+			Cache: config.CacheObjectstore{
+				Backend: "memory",
+				MaxSize: 1,
+				Policy:  "lru",
+			},
+		},
+	}, sqliteDB)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	e, err := NewEcho(svc)
+	if err != nil {
+		t.Fatalf("NewEcho: %v", err)
+	}
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func randomContent(n int, seed int64) []byte {
+	content := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(content)
+	return content
+}
+
+func do(t *testing.T, req *http.Request) (*http.Response, []byte) {
+	t.Helper()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	return res, body
+}
+
+// errorCode returns the code of an error response.
+func errorCode(t *testing.T, body []byte) string {
+	t.Helper()
+	var res struct {
+		Error *struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil || res.Error == nil {
+		t.Fatalf("not an error response: %s", body)
+	}
+	return res.Error.Code
+}
+
+// pushForm pushes content as a form upload, like the CLI does.
+func pushForm(t *testing.T, server *httptest.Server, templateID uuid.UUID, version int64, content []byte) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("template_id", templateID.String())
+	writer.WriteField("version", fmt.Sprint(version))
+	part, err := writer.CreateFormFile("file", "template")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/push", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if res, body := do(t, req); res.StatusCode != http.StatusOK {
+		t.Fatalf("push status %d: %s", res.StatusCode, body)
+	}
+}
+
+func pullURL(server *httptest.Server, templateID uuid.UUID, version int64) string {
+	return fmt.Sprintf("%s/api/v1/pull/%s/%d", server.URL, templateID, version)
+}
+
+func TestPushPull(t *testing.T) {
+	server := newTestServer(t)
+	templateID := uuid.New()
+	content := randomContent(100<<10, 1)
+	pushForm(t, server, templateID, 1, content)
+
+	req, _ := http.NewRequest(http.MethodGet, pullURL(server, templateID, 1), nil)
+	res, body := do(t, req)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("pull status %d: %s", res.StatusCode, body)
+	}
+	if !bytes.Equal(body, content) {
+		t.Fatalf("pulled %d bytes, pushed %d", len(body), len(content))
+	}
+	hash, _ := blake3.Compute(bytes.NewReader(content))
+	if etag := res.Header.Get("ETag"); etag != fmt.Sprintf("%q", hash) {
+		t.Fatalf("ETag = %s, want the content hash %s", etag, hash)
+	}
+
+	// A resumed download gets the rest of the file
+	req, _ = http.NewRequest(http.MethodGet, pullURL(server, templateID, 1), nil)
+	req.Header.Set("Range", "bytes=50000-")
+	req.Header.Set("If-Range", res.Header.Get("ETag"))
+	res, body = do(t, req)
+	if res.StatusCode != http.StatusPartialContent {
+		t.Fatalf("ranged pull status %d, want 206", res.StatusCode)
+	}
+	if want := fmt.Sprintf("bytes 50000-%d/%d", len(content)-1, len(content)); res.Header.Get("Content-Range") != want {
+		t.Fatalf("Content-Range = %s, want %s", res.Header.Get("Content-Range"), want)
+	}
+	if !bytes.Equal(body, content[50000:]) {
+		t.Fatal("ranged pull returned the wrong bytes")
+	}
+}
+
+func TestPushStream(t *testing.T) {
+	server := newTestServer(t)
+	templateID := uuid.New()
+	content := randomContent(50<<10, 2)
+	hash, _ := blake3.Compute(bytes.NewReader(content))
+
+	pushURL := fmt.Sprintf("%s/api/v1/push/%s/%d", server.URL, templateID, 1)
+	req, _ := http.NewRequest(http.MethodPost, pushURL, bytes.NewReader(content[1:]))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Content-Hash", hash)
+	res, body := do(t, req)
+	if res.StatusCode == http.StatusOK {
+		t.Fatal("push with the wrong hash succeeded")
+	}
+	if code := errorCode(t, body); code != "push.hash_mismatch" {
+		t.Fatalf("error code %s, want push.hash_mismatch", code)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, pushURL, bytes.NewReader(content))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Content-Hash", hash)
+	if res, body := do(t, req); res.StatusCode != http.StatusOK {
+		t.Fatalf("push status %d: %s", res.StatusCode, body)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, pullURL(server, templateID, 1), nil)
+	if _, body := do(t, req); !bytes.Equal(body, content) {
+		t.Fatalf("pulled %d bytes, pushed %d", len(body), len(content))
+	}
+}
+
+func TestPushStreamContentType(t *testing.T) {
+	server := newTestServer(t)
+
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/v1/push/%s/1", server.URL, uuid.New()), strings.NewReader("content"))
+	req.Header.Set("Content-Type", "text/plain")
+	if res, _ := do(t, req); res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("status %d, want 415", res.StatusCode)
+	}
+}
+
+func TestPullNotFound(t *testing.T) {
+	server := newTestServer(t)
+
+	req, _ := http.NewRequest(http.MethodGet, pullURL(server, uuid.New(), 1), nil)
+	res, body := do(t, req)
+	if res.StatusCode == http.StatusOK {
+		t.Fatal("pull of a missing version succeeded")
+	}
+	if code := errorCode(t, body); code != "template_version.not_found" {
+		t.Fatalf("error code %s, want template_version.not_found", code)
+	}
+}
+
+func TestSharedFileExhausted(t *testing.T) {
+	server := newTestServer(t)
+	templateID := uuid.New()
+	content := randomContent(10<<10, 3)
+	pushForm(t, server, templateID, 1, content)
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/links", strings.NewReader(fmt.Sprintf(`{"template_id":%q,"version":1,"single_use":true}`, templateID)))
+	req.Header.Set("Content-Type", "application/json")
+	res, body := do(t, req)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create link status %d: %s", res.StatusCode, body)
+	}
+	var link struct {
+		Data struct {
+			URL string `json:"url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &link); err != nil {
+		t.Fatalf("decode link: %v", err)
+	}
+	// Links are issued under the configured base URL
+	linkURL := server.URL + strings.TrimPrefix(link.Data.URL, "http://templar.test")
+
+	download := func(rng string) (*http.Response, []byte) {
+		req, _ := http.NewRequest(http.MethodGet, linkURL, nil)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		return do(t, req)
+	}
+
+	if res, body := download("bytes=1-"); res.StatusCode != http.StatusForbidden || errorCode(t, body) != "download_link.invalid" {
+		t.Fatalf("resume before any download: status %d", res.StatusCode)
+	}
+	if res, body := download(""); res.StatusCode != http.StatusOK || !bytes.Equal(body, content) {
+		t.Fatalf("download status %d: %s", res.StatusCode, body)
+	}
+	if res, body := download("bytes=5000-"); res.StatusCode != http.StatusPartialContent || !bytes.Equal(body, content[5000:]) {
+		t.Fatalf("resumed download status %d", res.StatusCode)
+	}
+
+	// Ranges that may cover the start need a download left
+	for _, rng := range []string{"", "bytes=0-", "bytes=-100", "bytes=5000-,0-10", "bytes=x-"} {
+		if res, body := download(rng); res.StatusCode != http.StatusForbidden || errorCode(t, body) != "download_link.invalid" {
+			t.Fatalf("Range %q on an exhausted link: status %d", rng, res.StatusCode)
+		}
+	}
+
+	// Resuming the one download is capped
+	exhausted := false
+	for range 100 {
+		res, _ := download("bytes=1-")
+		if res.StatusCode == http.StatusForbidden {
+			exhausted = true
+			break
+		}
+		if res.StatusCode != http.StatusPartialContent {
+			t.Fatalf("resumed download status %d", res.StatusCode)
+		}
+	}
+	if !exhausted {
+		t.Fatal("an exhausted link resumed 100 times")
+	}
+}
@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/beanbocchi/templar/internal/service"
+	"github.com/beanbocchi/templar/pkg/response"
+)
+
+type CreateUploadRequest struct {
+	TemplateID uuid.UUID `json:"template_id" form:"template_id" validate:"required,uuid"`
+	Version    int64     `json:"version" form:"version" validate:"required,min=1"`
+	PartCount  int64     `json:"part_count" form:"part_count" validate:"required,min=1,max=10000"`
+}
+
+func (h *Handler) CreateUpload(c echo.Context) error {
+	var req CreateUploadRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	upload, err := h.svc.CreateUpload(c.Request().Context(), service.CreateUploadParams{
+		TemplateID: req.TemplateID,
+		Version:    req.Version,
+		PartCount:  req.PartCount,
+	})
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromDTO(c.Response().Writer, http.StatusCreated, upload)
+}
+
+type UploadRequest struct {
+	UploadID uuid.UUID `param:"upload_id" validate:"required,uuid"`
+}
+
+func (h *Handler) GetUpload(c echo.Context) error {
+	var req UploadRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	upload, err := h.svc.GetUpload(c.Request().Context(), service.GetUploadParams{
+		UploadID: req.UploadID,
+	})
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromDTO(c.Response().Writer, http.StatusOK, upload)
+}
+
+type UploadPartRequest struct {
+	UploadID   uuid.UUID `param:"upload_id" validate:"required,uuid"`
+	PartNumber int64     `param:"part_number" validate:"required,min=1,max=10000"`
+	Checksum   string    `header:"X-Content-Hash" validate:"required,len=64,hexadecimal"`
+}
+
+// UploadPart stores the raw request body as one part of an upload. The body
+// isn't bound, only the path and the checksum header are.
+func (h *Handler) UploadPart(c echo.Context) error {
+	var req UploadPartRequest
+	binder := &echo.DefaultBinder{}
+	if err := binder.BindPathParams(c, &req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := binder.BindHeaders(c, &req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	part, err := h.svc.UploadPart(c.Request().Context(), service.UploadPartParams{
+		UploadID:   req.UploadID,
+		PartNumber: req.PartNumber,
+		Checksum:   req.Checksum,
+		Content:    c.Request().Body,
+	})
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromDTO(c.Response().Writer, http.StatusOK, part)
+}
+
+type CompleteUploadRequest struct {
+	UploadID uuid.UUID `param:"upload_id" validate:"required,uuid"`
+	Hash     string    `json:"hash" form:"hash" validate:"omitempty,len=64,hexadecimal"`
+}
+
+// CompleteUpload assembles the parts and answers with the template version.
+func (h *Handler) CompleteUpload(c echo.Context) error {
+	var req CompleteUploadRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	version, err := h.svc.CompleteUpload(c.Request().Context(), service.CompleteUploadParams{
+		UploadID: req.UploadID,
+		Hash:     req.Hash,
+	})
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromDTO(c.Response().Writer, http.StatusOK, version)
+}
+
+func (h *Handler) AbortUpload(c echo.Context) error {
+	var req UploadRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+	if err := c.Validate(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	if err := h.svc.AbortUpload(c.Request().Context(), service.AbortUploadParams{
+		UploadID: req.UploadID,
+	}); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromMessage(c.Response().Writer, http.StatusOK, "Upload aborted")
+}
+
+type ListMultipartSessionsRequest struct {
+	Prefix string `query:"prefix"`
+}
+
+func (h *Handler) ListMultipartSessions(c echo.Context) error {
+	var req ListMultipartSessionsRequest
+	if err := c.Bind(&req); err != nil {
+		return response.FromError(c.Response().Writer, http.StatusBadRequest, err)
+	}
+
+	sessions, err := h.svc.ListMultipartSessions(c.Request().Context(), service.ListMultipartSessionsParams{
+		Prefix: req.Prefix,
+	})
+	if err != nil {
+		return response.FromError(c.Response().Writer, http.StatusInternalServerError, err)
+	}
+
+	return response.FromDTO(c.Response().Writer, http.StatusOK, sessions)
+}
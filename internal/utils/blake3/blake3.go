@@ -14,3 +14,21 @@ func Compute(data io.Reader) (string, error) {
 	}
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
+
+// Hasher computes the BLAKE3 hex digest of everything written to it.
+type Hasher struct {
+	hash *blake3.Hasher
+}
+
+func New() *Hasher {
+	return &Hasher{hash: blake3.New()}
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	return h.hash.Write(p)
+}
+
+// Sum returns the hex digest of the bytes written so far.
+func (h *Hasher) Sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
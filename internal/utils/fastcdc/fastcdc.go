@@ -0,0 +1,137 @@
+// Package fastcdc splits a stream into content-defined chunks using FastCDC
+// (Xia et al., USENIX ATC '16) with normalized chunking. Boundaries depend on
+// the content only, so an insert or delete in a stream changes the chunks
+// around the edit while the rest keep their hashes.
+package fastcdc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Options bounds the chunk sizes in bytes. Most chunks land close to AvgSize.
+type Options struct {
+	MinSize int
+	AvgSize int
+	MaxSize int
+}
+
+// Validate checks that MinSize < AvgSize < MaxSize.
+func (o Options) Validate() error {
+	if o.MinSize < 64 {
+		return fmt.Errorf("min size must be at least 64 bytes, got %d", o.MinSize)
+	}
+	if o.AvgSize <= o.MinSize || o.MaxSize <= o.AvgSize {
+		return fmt.Errorf("chunk sizes must satisfy min < avg < max, got %d/%d/%d", o.MinSize, o.AvgSize, o.MaxSize)
+	}
+	return nil
+}
+
+// gear maps each byte to a pseudo-random value for the rolling hash. The table
+// must never change: it decides where chunks are cut, and so which chunks
+// already stored are reused.
+var gear [256]uint64
+
+func init() {
+	// splitmix64 with a fixed seed
+	state := uint64(0x74656d706c6172) // "templar"
+	for i := range gear {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunker cuts a stream into chunks. It is not safe for concurrent use.
+type Chunker struct {
+	r     io.Reader
+	opts  Options
+	maskS uint64
+	maskL uint64
+
+	buf   []byte
+	start int
+	end   int
+	eof   bool
+}
+
+// NewChunker returns a Chunker reading from r.
+func NewChunker(r io.Reader, opts Options) (*Chunker, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Normalized chunking: a harder mask below AvgSize and an easier one above
+	// it pull the chunk size distribution towards AvgSize.
+	avgBits := bits.Len(uint(opts.AvgSize)) - 1
+	return &Chunker{
+		r:     r,
+		opts:  opts,
+		maskS: mask(avgBits + 2),
+		maskL: mask(avgBits - 2),
+		buf:   make([]byte, opts.MaxSize),
+	}, nil
+}
+
+// mask returns a mask of the n high bits. The gear hash shifts left, so the
+// high bits depend on the most bytes (a 64 byte window).
+func mask(n int) uint64 {
+	n = max(1, min(n, 63))
+	return ^uint64(0) << (64 - n)
+}
+
+// Next returns the next chunk, or io.EOF once the stream is exhausted. The
+// returned slice is only valid until the next call.
+func (c *Chunker) Next() ([]byte, error) {
+	// Move the unconsumed tail to the front and top the buffer up
+	if c.start > 0 {
+		c.end = copy(c.buf, c.buf[c.start:c.end])
+		c.start = 0
+	}
+	if !c.eof && c.end < len(c.buf) {
+		n, err := io.ReadFull(c.r, c.buf[c.end:])
+		c.end += n
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.end == 0 {
+		return nil, io.EOF
+	}
+
+	cut := c.cutPoint(c.buf[:c.end])
+	c.start = cut
+	return c.buf[:cut], nil
+}
+
+// cutPoint returns the length of the chunk at the start of data.
+func (c *Chunker) cutPoint(data []byte) int {
+	n := len(data)
+	if n <= c.opts.MinSize {
+		return n
+	}
+	normal := min(c.opts.AvgSize, n)
+
+	var fp uint64
+	i := c.opts.MinSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,153 @@
+package fastcdc_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/beanbocchi/templar/internal/utils/fastcdc"
+)
+
+var testOptions = fastcdc.Options{MinSize: 256, AvgSize: 1024, MaxSize: 4096}
+
+func randomContent(n int) []byte {
+	content := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(content)
+	return content
+}
+
+// split returns the chunks of r, copied as the chunker reuses its buffer.
+func split(t *testing.T, r io.Reader, opts fastcdc.Options) [][]byte {
+	t.Helper()
+	chunker, err := fastcdc.NewChunker(r, opts)
+	if err != nil {
+		t.Fatalf("NewChunker: %v", err)
+	}
+
+	var chunks [][]byte
+	for {
+		chunk, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			return chunks
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		chunks = append(chunks, bytes.Clone(chunk))
+	}
+}
+
+func TestChunkBounds(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content []byte
+	}{
+		{"empty", nil},
+		{"one byte", randomContent(1)},
+		{"below min", randomContent(testOptions.MinSize - 1)},
+		{"min", randomContent(testOptions.MinSize)},
+		{"max", randomContent(testOptions.MaxSize)},
+		{"max plus one", randomContent(testOptions.MaxSize + 1)},
+		{"random", randomContent(1 << 20)},
+		{"zeros", make([]byte, 10*testOptions.MaxSize+7)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			chunks := split(t, bytes.NewReader(test.content), testOptions)
+
+			if got := bytes.Join(chunks, nil); !bytes.Equal(got, test.content) {
+				t.Fatalf("chunks join to %d bytes, want %d", len(got), len(test.content))
+			}
+			for i, chunk := range chunks {
+				if len(chunk) == 0 || len(chunk) > testOptions.MaxSize {
+					t.Fatalf("chunk %d has %d bytes, want 1 to %d", i, len(chunk), testOptions.MaxSize)
+				}
+				// Only the last chunk can be cut short by the end of the stream
+				if i < len(chunks)-1 && len(chunk) < testOptions.MinSize {
+					t.Fatalf("chunk %d of %d has %d bytes, below the minimum", i, len(chunks), len(chunk))
+				}
+			}
+		})
+	}
+}
+
+func TestAverageSize(t *testing.T) {
+	content := randomContent(4 << 20)
+	chunks := split(t, bytes.NewReader(content), testOptions)
+
+	avg := len(content) / len(chunks)
+	if avg < testOptions.AvgSize/2 || avg > testOptions.AvgSize*2 {
+		t.Fatalf("average chunk size %d, want close to %d", avg, testOptions.AvgSize)
+	}
+}
+
+func TestBoundariesDependOnContentOnly(t *testing.T) {
+	content := randomContent(256 << 10)
+	want := split(t, bytes.NewReader(content), testOptions)
+
+	// Short reads don't move the boundaries
+	got := split(t, iotest.OneByteReader(bytes.NewReader(content)), testOptions)
+	if len(got) != len(want) {
+		t.Fatalf("%d chunks with one byte reads, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("chunk %d differs with one byte reads", i)
+		}
+	}
+}
+
+func TestEditKeepsOtherChunks(t *testing.T) {
+	content := randomContent(512 << 10)
+	edited := bytes.Clone(content[:len(content)/2])
+	edited = append(edited, []byte("inserted in the middle")...)
+	edited = append(edited, content[len(content)/2:]...)
+
+	before := make(map[string]bool)
+	for _, chunk := range split(t, bytes.NewReader(content), testOptions) {
+		before[string(chunk)] = true
+	}
+	after := split(t, bytes.NewReader(edited), testOptions)
+
+	changed := 0
+	for _, chunk := range after {
+		if !before[string(chunk)] {
+			changed++
+		}
+	}
+	// The chunk holding the insert, and maybe its neighbours until the
+	// boundaries line up again
+	if changed > 3 {
+		t.Fatalf("%d of %d chunks changed after a single insert", changed, len(after))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, opts := range []fastcdc.Options{
+		{MinSize: 32, AvgSize: 1024, MaxSize: 4096},
+		{MinSize: 1024, AvgSize: 1024, MaxSize: 4096},
+		{MinSize: 256, AvgSize: 4096, MaxSize: 4096},
+	} {
+		t.Run(fmt.Sprint(opts), func(t *testing.T) {
+			if err := opts.Validate(); err == nil {
+				t.Fatal("Validate accepted invalid options")
+			}
+			if _, err := fastcdc.NewChunker(bytes.NewReader(nil), opts); err == nil {
+				t.Fatal("NewChunker accepted invalid options")
+			}
+		})
+	}
+}
+
+// Zeros have no content-defined cut point, every chunk is cut at MaxSize.
+func TestZerosCutAtMax(t *testing.T) {
+	chunks := split(t, bytes.NewReader(make([]byte, 10*testOptions.MaxSize+7)), testOptions)
+	for i, chunk := range chunks[:len(chunks)-1] {
+		if len(chunk) != testOptions.MaxSize {
+			t.Fatalf("chunk %d has %d bytes, want %d", i, len(chunk), testOptions.MaxSize)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package ioutil
+
+import (
+	"io"
+)
+
+// LimitedReadCloser reads at most N bytes from the wrapped reader and closes it on Close.
+type LimitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// NewLimitedReadCloser limits rc to n bytes. A negative n means no limit.
+func NewLimitedReadCloser(rc io.ReadCloser, n int64) io.ReadCloser {
+	if n < 0 {
+		return rc
+	}
+	return &LimitedReadCloser{Reader: io.LimitReader(rc, n), Closer: rc}
+}
@@ -30,3 +30,31 @@ func (p *Reader) Progress() float64 {
 	}
 	return float64(p.current.Load()) / float64(p.total)
 }
+
+// ReaderAt counts the bytes read through ReadAt, for content read in parts
+// at once.
+type ReaderAt struct {
+	io.ReaderAt
+	total   int64
+	current atomic.Int64
+}
+
+func NewReaderAt(reader io.ReaderAt, total int64) *ReaderAt {
+	return &ReaderAt{
+		ReaderAt: reader,
+		total:    total,
+	}
+}
+
+func (p *ReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n, err := p.ReaderAt.ReadAt(b, off)
+	p.current.Add(int64(n))
+	return n, err
+}
+
+func (p *ReaderAt) Progress() float64 {
+	if p.total <= 0 {
+		return 0
+	}
+	return min(float64(p.current.Load())/float64(p.total), 1)
+}
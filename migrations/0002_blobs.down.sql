@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS "idx_blobs_hash";
+
+-- Drop tables
+DROP TABLE IF EXISTS "blobs";
@@ -0,0 +1,17 @@
+-- CreateTable
+CREATE TABLE "blobs" (
+    "object_key" TEXT NOT NULL PRIMARY KEY,
+    "hash" TEXT,
+    "size" INTEGER,
+    "ref_count" INTEGER NOT NULL DEFAULT 0,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- CreateIndex
+CREATE INDEX "idx_blobs_hash" ON "blobs"("hash");
+
+-- Backfill: versions pushed before content addressing each own a per-version object
+INSERT INTO "blobs" ("object_key", "hash", "size", "ref_count")
+SELECT "object_key", MAX("file_hash"), MAX("file_size"), COUNT(*)
+FROM "template_versions"
+GROUP BY "object_key";
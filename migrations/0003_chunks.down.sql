@@ -0,0 +1,6 @@
+-- Drop tables
+DROP TABLE IF EXISTS "blob_chunks";
+DROP TABLE IF EXISTS "chunks";
+
+-- AlterTable
+ALTER TABLE "blobs" DROP COLUMN "chunked";
@@ -0,0 +1,23 @@
+-- AlterTable
+ALTER TABLE "blobs" ADD COLUMN "chunked" BOOLEAN NOT NULL DEFAULT false;
+
+-- CreateTable
+CREATE TABLE "chunks" (
+    "hash" TEXT NOT NULL PRIMARY KEY,
+    "object_key" TEXT NOT NULL,
+    "size" INTEGER NOT NULL,
+    "ref_count" INTEGER NOT NULL DEFAULT 0,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- CreateTable
+CREATE TABLE "blob_chunks" (
+    "blob_key" TEXT NOT NULL,
+    "seq" INTEGER NOT NULL,
+    "chunk_hash" TEXT NOT NULL,
+    "offset" INTEGER NOT NULL,
+    "size" INTEGER NOT NULL,
+    PRIMARY KEY ("blob_key", "seq"),
+    CONSTRAINT "blob_chunks_blob_key_fkey" FOREIGN KEY ("blob_key") REFERENCES "blobs" ("object_key") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "blob_chunks_chunk_hash_fkey" FOREIGN KEY ("chunk_hash") REFERENCES "chunks" ("hash") ON DELETE RESTRICT ON UPDATE CASCADE
+);
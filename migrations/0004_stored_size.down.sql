@@ -0,0 +1,8 @@
+-- AlterTable
+ALTER TABLE "chunks" DROP COLUMN "stored_size";
+
+-- AlterTable
+ALTER TABLE "blobs" DROP COLUMN "stored_size";
+
+-- AlterTable
+ALTER TABLE "template_versions" DROP COLUMN "stored_size";
@@ -0,0 +1,13 @@
+-- AlterTable
+ALTER TABLE "template_versions" ADD COLUMN "stored_size" INTEGER;
+
+-- AlterTable
+ALTER TABLE "blobs" ADD COLUMN "stored_size" INTEGER;
+
+-- AlterTable
+ALTER TABLE "chunks" ADD COLUMN "stored_size" INTEGER;
+
+-- Backfill: everything stored so far is uncompressed
+UPDATE "template_versions" SET "stored_size" = "file_size";
+UPDATE "blobs" SET "stored_size" = "size";
+UPDATE "chunks" SET "stored_size" = "size";
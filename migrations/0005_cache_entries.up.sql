@@ -0,0 +1,6 @@
+-- CreateTable
+CREATE TABLE "cache_entries" (
+    "key" TEXT NOT NULL PRIMARY KEY,
+    "size" INTEGER NOT NULL,
+    "accessed_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
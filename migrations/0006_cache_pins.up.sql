@@ -0,0 +1,6 @@
+-- CreateTable
+CREATE TABLE "cache_pins" (
+    "version_id" TEXT NOT NULL PRIMARY KEY,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT "cache_pins_version_id_fkey" FOREIGN KEY ("version_id") REFERENCES "template_versions" ("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
@@ -0,0 +1,7 @@
+-- CreateTable
+CREATE TABLE "object_digests" (
+    "key" TEXT NOT NULL PRIMARY KEY,
+    "size" INTEGER NOT NULL,
+    "hash" TEXT NOT NULL,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
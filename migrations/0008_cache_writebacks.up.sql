@@ -0,0 +1,7 @@
+-- CreateTable
+CREATE TABLE "cache_writebacks" (
+    "key" TEXT NOT NULL PRIMARY KEY,
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "last_error" TEXT,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
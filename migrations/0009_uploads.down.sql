@@ -0,0 +1,3 @@
+-- Drop tables
+DROP TABLE IF EXISTS "upload_parts";
+DROP TABLE IF EXISTS "uploads";
@@ -0,0 +1,24 @@
+-- CreateTable
+CREATE TABLE "uploads" (
+    "id" TEXT NOT NULL PRIMARY KEY,
+    "template_id" TEXT NOT NULL,
+    "version_number" INTEGER NOT NULL,
+    "object_key" TEXT NOT NULL,
+    "multipart_id" TEXT NOT NULL,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- CreateTable
+CREATE TABLE "upload_parts" (
+    "upload_id" TEXT NOT NULL,
+    "part_number" INTEGER NOT NULL,
+    "size" INTEGER NOT NULL,
+    "checksum" TEXT NOT NULL,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY ("upload_id", "part_number"),
+    CONSTRAINT "upload_parts_upload_id_fkey" FOREIGN KEY ("upload_id") REFERENCES "uploads" ("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- CreateIndex
+CREATE INDEX "idx_uploads_updated_at" ON "uploads"("updated_at");
@@ -0,0 +1,13 @@
+-- CreateTable
+CREATE TABLE "download_links" (
+    "id" TEXT NOT NULL PRIMARY KEY,
+    "template_id" TEXT NOT NULL,
+    "version_number" INTEGER NOT NULL,
+    "max_downloads" INTEGER,
+    "downloads" INTEGER NOT NULL DEFAULT 0,
+    "expires_at" DATETIME NOT NULL,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- CreateIndex
+CREATE INDEX "idx_download_links_expires_at" ON "download_links"("expires_at");
@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS "idx_chunks_object_key";
+
+-- Drop tables
+DROP TABLE IF EXISTS "object_tombstones";
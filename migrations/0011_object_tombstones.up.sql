@@ -0,0 +1,9 @@
+-- CreateTable
+CREATE TABLE "object_tombstones" (
+    "object_key" TEXT NOT NULL PRIMARY KEY,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "claimed_at" DATETIME
+);
+
+-- CreateIndex
+CREATE INDEX "idx_chunks_object_key" ON "chunks"("object_key");
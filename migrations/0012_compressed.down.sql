@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "chunks" DROP COLUMN "compressed";
+
+-- AlterTable
+ALTER TABLE "blobs" DROP COLUMN "compressed";
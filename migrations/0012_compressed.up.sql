@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "blobs" ADD COLUMN "compressed" BOOLEAN NOT NULL DEFAULT false;
+
+-- AlterTable
+ALTER TABLE "chunks" ADD COLUMN "compressed" BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "uploads" DROP COLUMN "part_count";
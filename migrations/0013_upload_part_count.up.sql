@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "uploads" ADD COLUMN "part_count" INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "download_links" DROP COLUMN "resumes";
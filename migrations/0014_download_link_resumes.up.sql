@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "download_links" ADD COLUMN "resumes" INTEGER NOT NULL DEFAULT 0;
@@ -1,6 +1,7 @@
 package response
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 	"runtime/debug"
@@ -16,6 +17,13 @@ const (
 	ContentTypeJSON = "application/json"
 )
 
+// statusByCode maps domain error codes that have a fixed HTTP status,
+// overriding the status the handler asked for.
+var statusByCode = map[string]int{
+	model.ErrStoreUnavailable.Code():    http.StatusServiceUnavailable,
+	model.ErrDownloadLinkInvalid.Code(): http.StatusForbidden,
+}
+
 // writeError writes an error response with proper error handling
 func writeError(w http.ResponseWriter, httpCode int, err error) error {
 	// Default code and message
@@ -23,9 +31,13 @@ func writeError(w http.ResponseWriter, httpCode int, err error) error {
 	message := http.StatusText(httpCode)
 
 	// Use the error's message if it implements ErrorWithCode (domain errors)
-	if errWithCode, ok := err.(model.ErrorWithCode); ok {
+	var errWithCode model.ErrorWithCode
+	if errors.As(err, &errWithCode) {
 		errCode = errWithCode.Code()
 		message = errWithCode.Error()
+		if status, ok := statusByCode[errCode]; ok {
+			httpCode = status
+		}
 	}
 	debug.PrintStack()
 
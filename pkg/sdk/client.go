@@ -1,9 +1,9 @@
 package sdk
 
 import (
-	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -15,10 +15,14 @@ import (
 	"github.com/zeebo/blake3"
 )
 
+// defaultMaxResumes is how many times Pull resumes an interrupted download.
+const defaultMaxResumes = 5
+
 // Client is the Templar SDK client
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	maxResumes int
 }
 
 // NewClient creates a new SDK client
@@ -29,6 +33,7 @@ func NewClient(baseURL string) *Client {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		maxResumes: defaultMaxResumes,
 	}
 }
 
@@ -37,6 +42,7 @@ func NewClientWithHTTPClient(baseURL string, httpClient *http.Client) *Client {
 	return &Client{
 		baseURL:    baseURL,
 		httpClient: httpClient,
+		maxResumes: defaultMaxResumes,
 	}
 }
 
@@ -189,40 +195,15 @@ type PullRequest struct {
 	Version    int64     `json:"version"`
 }
 
-// Pull streams a template to dst with minimal buffering
+// Pull streams a template to dst with minimal buffering. If the connection
+// drops mid-stream, the download resumes from the last received byte using an
+// HTTP Range request, up to maxResumes times.
 func (c *Client) Pull(req PullRequest, dst io.Writer) error {
 	expectedHash, err := c.getHash(req.TemplateID, req.Version)
 	if err != nil {
 		return fmt.Errorf("get hash: %w", err)
 	}
 
-	payload, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("marshal pull request: %w", err)
-	}
-
-	httpReq, err := http.NewRequest("POST", fmt.Sprintf("%s/pull", c.baseURL), bytes.NewReader(payload))
-	if err != nil {
-		return fmt.Errorf("create pull request: %w", err)
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return fmt.Errorf("send pull request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var commonResp response.CommonResponse
-		if err := json.NewDecoder(resp.Body).Decode(&commonResp); err == nil && commonResp.Error != nil {
-			return commonResp.Error
-		}
-		return fmt.Errorf("pull failed with status %d", resp.StatusCode)
-	}
-
-	reader := resp.Body
-
 	var writer io.Writer = dst
 	var hasher *blake3.Hasher
 	if expectedHash != "" {
@@ -231,8 +212,23 @@ func (c *Client) Pull(req PullRequest, dst io.Writer) error {
 		writer = io.MultiWriter(dst, h)
 	}
 
-	if _, err := io.Copy(writer, reader); err != nil {
-		return fmt.Errorf("stream download: %w", err)
+	target := &pullTarget{url: fmt.Sprintf("%s/pull/%s/%d", c.baseURL, req.TemplateID.String(), req.Version)}
+	if expectedHash != "" {
+		target.etag = fmt.Sprintf("%q", expectedHash)
+	}
+
+	var received int64
+	for attempt := 0; ; attempt++ {
+		n, err := c.pullFrom(target, writer, received)
+		received += n
+		if err == nil {
+			break
+		}
+
+		var streamErr *streamError
+		if !errors.As(err, &streamErr) || attempt >= c.maxResumes {
+			return err
+		}
 	}
 
 	if hasher != nil {
@@ -244,3 +240,78 @@ func (c *Client) Pull(req PullRequest, dst io.Writer) error {
 
 	return nil
 }
+
+// streamError marks a failure while reading the response body, which Pull retries.
+type streamError struct {
+	err error
+}
+
+func (e *streamError) Error() string {
+	return fmt.Sprintf("stream download: %v", e.err)
+}
+
+func (e *streamError) Unwrap() error {
+	return e.err
+}
+
+// pullTarget is where a pull resumes from. A pull the server redirected to
+// the object store resumes there, guarded by the store's ETag.
+type pullTarget struct {
+	url  string
+	etag string
+}
+
+// pullFrom downloads the template starting at offset and returns the number of bytes written.
+func (c *Client) pullFrom(target *pullTarget, dst io.Writer, offset int64) (int64, error) {
+	httpReq, err := http.NewRequest("GET", target.url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("create pull request: %w", err)
+	}
+	if offset > 0 {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if target.etag != "" {
+			// Only resume if the content is still the one we started with
+			httpReq.Header.Set("If-Range", target.etag)
+		}
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		if offset > 0 {
+			return 0, &streamError{err: err}
+		}
+		return 0, fmt.Errorf("send pull request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case offset == 0 && resp.StatusCode == http.StatusOK:
+		if redirected := resp.Request.URL.String(); redirected != target.url {
+			target.url = redirected
+			target.etag = resp.Header.Get("ETag")
+		}
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		var start int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+			return 0, fmt.Errorf("unexpected content range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+		}
+	case offset > 0 && resp.StatusCode == http.StatusOK:
+		return 0, fmt.Errorf("template changed during download, cannot resume")
+	default:
+		var commonResp response.CommonResponse
+		if err := json.NewDecoder(resp.Body).Decode(&commonResp); err == nil && commonResp.Error != nil {
+			return 0, commonResp.Error
+		}
+		return 0, fmt.Errorf("pull failed with status %d", resp.StatusCode)
+	}
+
+	n, err := io.Copy(dst, resp.Body)
+	if err != nil {
+		return n, &streamError{err: err}
+	}
+	if resp.ContentLength >= 0 && n < resp.ContentLength {
+		return n, &streamError{err: io.ErrUnexpectedEOF}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,196 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zeebo/blake3"
+
+	"github.com/beanbocchi/templar/pkg/response"
+)
+
+// DefaultPartSize is the part size ResumablePush uses when none is set. S3
+// refuses parts under 5 MiB, except the last one.
+const DefaultPartSize = 16 * 1024 * 1024
+
+// Upload is a resumable push and the parts the server received so far
+type Upload struct {
+	ID         string       `json:"id"`
+	TemplateID string       `json:"template_id"`
+	Version    int64        `json:"version"`
+	PartCount  int64        `json:"part_count"`
+	Parts      []UploadPart `json:"parts"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// UploadPart is a part received by the server
+type UploadPart struct {
+	PartNumber int64  `json:"part_number"`
+	Size       int64  `json:"size"`
+	Checksum   string `json:"checksum"`
+}
+
+// CreateUpload starts a resumable push of partCount parts. Keep the ID to
+// resume it with ResumablePush after a crash.
+func (c *Client) CreateUpload(templateID uuid.UUID, version int64, partCount int64) (*Upload, error) {
+	body, err := json.Marshal(map[string]any{
+		"template_id": templateID.String(),
+		"version":     version,
+		"part_count":  partCount,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	commonResp, err := c.doPOST("/uploads", bytes.NewReader(body), "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	var upload Upload
+	if err := decodeData(commonResp, &upload); err != nil {
+		return nil, fmt.Errorf("decode upload: %w", err)
+	}
+	return &upload, nil
+}
+
+// GetUpload returns an upload and the parts the server received
+func (c *Client) GetUpload(uploadID string) (*Upload, error) {
+	commonResp, err := c.doGET(fmt.Sprintf("/uploads/%s", uploadID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var upload Upload
+	if err := decodeData(commonResp, &upload); err != nil {
+		return nil, fmt.Errorf("decode upload: %w", err)
+	}
+	return &upload, nil
+}
+
+// AbortUpload cancels an upload, the parts received are dropped
+func (c *Client) AbortUpload(uploadID string) error {
+	httpReq, err := http.NewRequest("DELETE", fmt.Sprintf("%s/uploads/%s", c.baseURL, uploadID), nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	_, err = c.doRequest(httpReq)
+	return err
+}
+
+// ResumablePushRequest is the request parameters for ResumablePush
+type ResumablePushRequest struct {
+	TemplateID uuid.UUID
+	Version    int64
+	File       io.ReaderAt
+	Size       int64
+	// PartSize is the size of every part but the last, DefaultPartSize when zero
+	PartSize int64
+	// UploadID resumes an upload from CreateUpload, a new one is started when empty
+	UploadID string
+}
+
+// ResumablePush uploads a template in parts. Parts the server already has
+// are skipped, and a part that fails is sent again up to maxResumes times,
+// so an interrupted push only resends what is missing. The server checks
+// every part and the whole file against their BLAKE3 hashes.
+func (c *Client) ResumablePush(req ResumablePushRequest) (*PushResponse, error) {
+	partSize := req.PartSize
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+
+	// Hash the parts and the file up front, the checksums decide what to resend
+	hasher := blake3.New()
+	checksums := make([]string, max(1, (req.Size+partSize-1)/partSize))
+	for i := range checksums {
+		partHasher := blake3.New()
+		section := io.NewSectionReader(req.File, int64(i)*partSize, partSize)
+		if _, err := io.Copy(io.MultiWriter(hasher, partHasher), section); err != nil {
+			return nil, fmt.Errorf("hash part %d: %w", i+1, err)
+		}
+		checksums[i] = hex.EncodeToString(partHasher.Sum(nil))
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	var upload *Upload
+	var err error
+	if req.UploadID == "" {
+		upload, err = c.CreateUpload(req.TemplateID, req.Version, int64(len(checksums)))
+	} else {
+		upload, err = c.GetUpload(req.UploadID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if upload.PartCount != int64(len(checksums)) {
+		return nil, fmt.Errorf("upload %s has %d parts, the file has %d at this part size", upload.ID, upload.PartCount, len(checksums))
+	}
+
+	received := make(map[int64]UploadPart, len(upload.Parts))
+	for _, part := range upload.Parts {
+		received[part.PartNumber] = part
+	}
+
+	for i, checksum := range checksums {
+		partNumber := int64(i + 1)
+		offset := int64(i) * partSize
+		size := min(partSize, req.Size-offset)
+		if part, ok := received[partNumber]; ok && part.Size == size && part.Checksum == checksum {
+			continue
+		}
+
+		for attempt := 0; ; attempt++ {
+			err := c.uploadPart(upload.ID, partNumber, io.NewSectionReader(req.File, offset, size), size, checksum)
+			if err == nil {
+				break
+			}
+			if attempt >= c.maxResumes {
+				return nil, fmt.Errorf("upload %s part %d: %w", upload.ID, partNumber, err)
+			}
+		}
+	}
+
+	body, err := json.Marshal(map[string]string{"hash": hash})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	if _, err := c.doPOST(fmt.Sprintf("/uploads/%s/complete", upload.ID), bytes.NewReader(body), "application/json"); err != nil {
+		return nil, fmt.Errorf("complete upload %s: %w", upload.ID, err)
+	}
+
+	return &PushResponse{
+		Message: "Template pushed",
+		Hash:    hash,
+	}, nil
+}
+
+func (c *Client) uploadPart(uploadID string, partNumber int64, content io.Reader, size int64, checksum string) error {
+	httpReq, err := http.NewRequest("PUT", fmt.Sprintf("%s/uploads/%s/parts/%d", c.baseURL, uploadID, partNumber), content)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	httpReq.ContentLength = size
+	httpReq.Header.Set("Content-Type", "application/octet-stream")
+	httpReq.Header.Set("X-Content-Hash", checksum)
+
+	_, err = c.doRequest(httpReq)
+	return err
+}
+
+// decodeData decodes the data of a response into v
+func decodeData(commonResp *response.CommonResponse, v any) error {
+	dataBytes, err := json.Marshal(commonResp.Data)
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+	return json.Unmarshal(dataBytes, v)
+}
@@ -39,13 +39,232 @@ SELECT * FROM "template_versions"
 WHERE "template_id" = ?;
 
 -- name: CreateTemplateVersion :one
-INSERT INTO "template_versions" ("id", "template_id", "version_number", "object_key", "file_size", "file_hash")
-VALUES (?, ?, ?, ?, ?, ?)
+INSERT INTO "template_versions" ("id", "template_id", "version_number", "object_key", "file_size", "file_hash", "stored_size")
+VALUES (?, ?, ?, ?, ?, ?, ?)
 RETURNING *;
 
 -- name: DeleteTemplateVersion :exec
 DELETE FROM "template_versions" WHERE "id" = ?;
 
+-- name: GetBlobByHash :one
+SELECT * FROM "blobs"
+WHERE "hash" = ? AND "ref_count" > 0
+ORDER BY "created_at"
+LIMIT 1;
+
+-- name: GetBlob :one
+SELECT * FROM "blobs" WHERE "object_key" = ?;
+
+-- name: AcquireBlob :one
+INSERT INTO "blobs" ("object_key", "hash", "size", "chunked", "stored_size", "compressed", "ref_count")
+VALUES (?, ?, ?, ?, ?, ?, 1)
+ON CONFLICT ("object_key") DO UPDATE SET "ref_count" = "ref_count" + 1
+RETURNING *;
+
+-- name: ReleaseBlob :one
+UPDATE "blobs" SET "ref_count" = "ref_count" - 1
+WHERE "object_key" = ?
+RETURNING *;
+
+-- name: DeleteBlob :exec
+DELETE FROM "blobs" WHERE "object_key" = ? AND "ref_count" <= 0;
+
+-- name: GetChunk :one
+SELECT * FROM "chunks"
+WHERE "hash" = ? AND "ref_count" > 0;
+
+-- name: AcquireChunk :one
+INSERT INTO "chunks" ("hash", "object_key", "size", "stored_size", "compressed", "ref_count")
+VALUES (?, ?, ?, ?, ?, 1)
+ON CONFLICT ("hash") DO UPDATE SET "ref_count" = "ref_count" + 1
+RETURNING *;
+
+-- name: ReleaseChunk :one
+UPDATE "chunks" SET "ref_count" = "ref_count" - 1
+WHERE "hash" = ?
+RETURNING *;
+
+-- name: DeleteChunk :exec
+DELETE FROM "chunks" WHERE "hash" = ? AND "ref_count" <= 0;
+
+-- name: CreateBlobChunk :exec
+INSERT INTO "blob_chunks" ("blob_key", "seq", "chunk_hash", "offset", "size")
+VALUES (?, ?, ?, ?, ?);
+
+-- name: ListBlobChunks :many
+SELECT "blob_chunks".*, "chunks"."compressed" FROM "blob_chunks"
+JOIN "chunks" ON "chunks"."hash" = "blob_chunks"."chunk_hash"
+WHERE "blob_key" = ?
+ORDER BY "seq";
+
+-- name: DeleteBlobChunks :exec
+DELETE FROM "blob_chunks" WHERE "blob_key" = ?;
+
+-- name: ListObjectKeys :many
+SELECT "object_key" FROM "chunks" WHERE "ref_count" > 0
+UNION ALL
+SELECT "object_key" FROM "blobs" WHERE "ref_count" > 0 AND NOT "chunked";
+
+-- name: ListCacheEntries :many
+SELECT * FROM "cache_entries";
+
+-- name: ListCacheEntriesByAccess :many
+SELECT * FROM "cache_entries"
+ORDER BY "accessed_at" DESC, "key"
+LIMIT ?
+OFFSET ?;
+
+-- name: PutCacheEntry :exec
+INSERT INTO "cache_entries" ("key", "size", "accessed_at")
+VALUES (?, ?, ?)
+ON CONFLICT ("key") DO UPDATE SET "size" = excluded."size", "accessed_at" = excluded."accessed_at";
+
+-- name: TouchCacheEntry :exec
+UPDATE "cache_entries" SET "accessed_at" = ? WHERE "key" = ?;
+
+-- name: DeleteCacheEntry :exec
+DELETE FROM "cache_entries" WHERE "key" = ?;
+
+-- name: CreateCachePin :execrows
+INSERT INTO "cache_pins" ("version_id") VALUES (?)
+ON CONFLICT ("version_id") DO NOTHING;
+
+-- name: DeleteCachePin :execrows
+DELETE FROM "cache_pins" WHERE "version_id" = ?;
+
+-- name: ListCachePins :many
+SELECT "template_versions".*, "cache_pins"."created_at" AS "pinned_at" FROM "cache_pins"
+JOIN "template_versions" ON "template_versions"."id" = "cache_pins"."version_id"
+ORDER BY "cache_pins"."created_at";
+
+-- name: ListPinnedObjectKeys :many
+SELECT "chunks"."object_key" FROM "cache_pins"
+JOIN "template_versions" ON "template_versions"."id" = "cache_pins"."version_id"
+JOIN "blob_chunks" ON "blob_chunks"."blob_key" = "template_versions"."object_key"
+JOIN "chunks" ON "chunks"."hash" = "blob_chunks"."chunk_hash"
+UNION ALL
+SELECT "template_versions"."object_key" FROM "cache_pins"
+JOIN "template_versions" ON "template_versions"."id" = "cache_pins"."version_id"
+LEFT JOIN "blobs" ON "blobs"."object_key" = "template_versions"."object_key"
+WHERE "blobs"."chunked" IS NULL OR NOT "blobs"."chunked";
+
+-- name: GetObjectDigest :one
+SELECT * FROM "object_digests" WHERE "key" = ?;
+
+-- name: PutObjectDigest :exec
+INSERT INTO "object_digests" ("key", "size", "hash")
+VALUES (?, ?, ?)
+ON CONFLICT ("key") DO UPDATE SET "size" = excluded."size", "hash" = excluded."hash", "created_at" = CURRENT_TIMESTAMP;
+
+-- name: DeleteObjectDigest :exec
+DELETE FROM "object_digests" WHERE "key" = ?;
+
+-- name: ListCacheWritebacks :many
+SELECT * FROM "cache_writebacks"
+ORDER BY "created_at";
+
+-- name: PutCacheWriteback :exec
+INSERT INTO "cache_writebacks" ("key") VALUES (?)
+ON CONFLICT ("key") DO UPDATE SET "attempts" = 0, "last_error" = NULL;
+
+-- name: FailCacheWriteback :exec
+UPDATE "cache_writebacks" SET "attempts" = "attempts" + 1, "last_error" = ? WHERE "key" = ?;
+
+-- name: DeleteCacheWriteback :exec
+DELETE FROM "cache_writebacks" WHERE "key" = ?;
+
+-- name: CreateUpload :one
+INSERT INTO "uploads" ("id", "template_id", "version_number", "object_key", "multipart_id", "part_count")
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetUpload :one
+SELECT * FROM "uploads" WHERE "id" = ?;
+
+-- name: TouchUpload :exec
+UPDATE "uploads" SET "updated_at" = CURRENT_TIMESTAMP WHERE "id" = ?;
+
+-- name: ListIdleUploads :many
+SELECT * FROM "uploads" WHERE "updated_at" < ?
+ORDER BY "updated_at";
+
+-- name: DeleteUpload :exec
+DELETE FROM "uploads" WHERE "id" = ?;
+
+-- name: PutUploadPart :exec
+INSERT INTO "upload_parts" ("upload_id", "part_number", "size", "checksum")
+VALUES (?, ?, ?, ?)
+ON CONFLICT ("upload_id", "part_number") DO UPDATE SET "size" = excluded."size", "checksum" = excluded."checksum", "created_at" = CURRENT_TIMESTAMP;
+
+-- name: ListUploadParts :many
+SELECT * FROM "upload_parts" WHERE "upload_id" = ?
+ORDER BY "part_number";
+
+-- name: DeleteUploadPart :exec
+DELETE FROM "upload_parts" WHERE "upload_id" = ? AND "part_number" = ?;
+
+-- name: DeleteUploadParts :exec
+DELETE FROM "upload_parts" WHERE "upload_id" = ?;
+
+-- name: CreateDownloadLink :one
+INSERT INTO "download_links" ("id", "template_id", "version_number", "max_downloads", "expires_at")
+VALUES (?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetDownloadLink :one
+SELECT * FROM "download_links" WHERE "id" = ?;
+
+-- name: UseDownloadLink :one
+UPDATE "download_links" SET "downloads" = "downloads" + 1
+WHERE "id" = ? AND ("max_downloads" IS NULL OR "downloads" < "max_downloads")
+RETURNING *;
+
+-- name: ResumeDownloadLink :one
+UPDATE "download_links" SET "resumes" = "resumes" + 1
+WHERE "id" = sqlc.arg('id') AND "resumes" < "downloads" * sqlc.arg('resumes_per_download')
+RETURNING *;
+
+-- name: DeleteDownloadLink :exec
+DELETE FROM "download_links" WHERE "id" = ?;
+
+-- name: DeleteExpiredDownloadLinks :exec
+DELETE FROM "download_links" WHERE "expires_at" < ?;
+
+-- name: CreateObjectTombstone :exec
+INSERT INTO "object_tombstones" ("object_key") VALUES (?)
+ON CONFLICT ("object_key") DO NOTHING;
+
+-- name: GetObjectTombstone :one
+SELECT * FROM "object_tombstones" WHERE "object_key" = ?;
+
+-- name: ListObjectTombstones :many
+SELECT * FROM "object_tombstones"
+WHERE ("claimed_at" IS NULL AND "created_at" < sqlc.arg('created_before'))
+   OR "claimed_at" < sqlc.arg('claimed_before')
+ORDER BY "created_at";
+
+-- name: ClaimObjectTombstone :execrows
+UPDATE "object_tombstones" SET "claimed_at" = sqlc.arg('claimed_at')
+WHERE "object_key" = sqlc.arg('object_key')
+  AND ("claimed_at" IS NULL OR "claimed_at" < sqlc.arg('claimed_before'))
+  AND NOT EXISTS (SELECT 1 FROM "chunks" WHERE "object_key" = sqlc.arg('object_key'))
+  AND NOT EXISTS (SELECT 1 FROM "blobs" WHERE "object_key" = sqlc.arg('object_key'));
+
+-- name: UnclaimObjectTombstone :exec
+UPDATE "object_tombstones" SET "claimed_at" = NULL WHERE "object_key" = ?;
+
+-- name: ReviveObjectTombstone :exec
+DELETE FROM "object_tombstones" WHERE "object_key" = ? AND "claimed_at" IS NULL;
+
+-- name: DeleteObjectTombstone :exec
+DELETE FROM "object_tombstones" WHERE "object_key" = ?;
+
+-- name: DeleteReferencedObjectTombstones :exec
+DELETE FROM "object_tombstones"
+WHERE "claimed_at" IS NULL
+  AND (EXISTS (SELECT 1 FROM "chunks" WHERE "chunks"."object_key" = "object_tombstones"."object_key")
+    OR EXISTS (SELECT 1 FROM "blobs" WHERE "blobs"."object_key" = "object_tombstones"."object_key"));
+
 -- name: ListJobs :many
 SELECT * FROM "jobs"
 ORDER BY "created_at" DESC